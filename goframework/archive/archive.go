@@ -0,0 +1,602 @@
+package goframework_archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+type ArchiveFormat string
+
+const (
+	FormatAuto   ArchiveFormat = ""
+	FormatZip    ArchiveFormat = "zip"
+	FormatTar    ArchiveFormat = "tar"
+	FormatTarGz  ArchiveFormat = "tar.gz"
+	FormatTarZst ArchiveFormat = "tar.zst"
+)
+
+// Returned (wrapped) when an entry would be written outside the destination directory
+var ErrPathTraversal = errors.New("archive entry escapes destination")
+
+// Returned (wrapped) when one of the ExtractOptions size/entry limits are exceeded
+var ErrLimitExceeded = errors.New("archive limit exceeded")
+
+// Called after each extracted entry, err is non-nil if the entry failed
+type EntryProgressorFn func(progressPtr fwcommon.NetworkProgressReportInterface, entry string, err error)
+
+type ExtractOptions struct {
+	Format        ArchiveFormat     // FormatAuto detects the format from magic bytes (and the remote name for plain tar)
+	MaxTotalSize  int64             // Max total uncompressed bytes written (and bytes of a zip spooled from a stream), <=0 for no limit
+	MaxEntrySize  int64             // Max uncompressed bytes of a single entry, <=0 for no limit
+	MaxEntries    int               // Max number of entries, <=0 for no limit
+	Overwrite     bool              // Overwrite existing files, else existing files fail the extraction
+	AllowSymlinks bool              // Extract symlinks (only if they resolve inside the destination, nothing is extracted beneath them), else they are skipped
+	TempDir       string            // Where zip archives are spooled when extracted from a stream, "" for os.TempDir()
+	Progressor    EntryProgressorFn // Optional per-entry callback
+}
+
+// Defaults: Auto format, MaxTotalSize:8GiB, MaxEntrySize:4GiB, MaxEntries:100000, Overwrite:false, AllowSymlinks:false
+func (op *ExtractOptions) Default() *ExtractOptions {
+	op.Format = FormatAuto
+	op.MaxTotalSize = 8 << 30
+	op.MaxEntrySize = 4 << 30
+	op.MaxEntries = 100000
+	op.Overwrite = false
+	op.AllowSymlinks = false
+	op.TempDir = ""
+	op.Progressor = nil
+	return op
+}
+
+// Archive extraction Class-like
+type Archiver struct {
+	log fwcommon.LoggerInterface   // Pointer
+	deb fwcommon.DebuggerInterface // Pointer
+}
+
+func NewArchiver(logPtr fwcommon.LoggerInterface, debPtr fwcommon.DebuggerInterface) *Archiver {
+	return &Archiver{
+		log: logPtr,
+		deb: debPtr,
+	}
+}
+
+func (a *Archiver) logThroughError(err error) error {
+	if fwcommon.FrameworkFlags.IsEnabled(fwcommon.Net_InternalErrorLog) {
+		return a.log.LogThroughError(err)
+	}
+	return err
+}
+
+// Extracts an archive streamed from a (stream=true) fetch into dest, entries are reported as stepping on the reports NetworkEvent.
+// The report is fully consumed and closed. Returns the paths written.
+func (a *Archiver) Extract(report fwcommon.NetworkProgressReportInterface, dest string, options *ExtractOptions) ([]string, error) {
+	defer report.Close()
+
+	if options == nil {
+		options = (&ExtractOptions{}).Default()
+	}
+
+	event := report.GetNetworkEvent()
+
+	// Steps are entries now, so they must not be recalculated from transferred/size on reads
+	event.EventStepMode = fwcommon.EventStepManual
+	report.SetSteppingCurrent(0)
+
+	st := &extractState{
+		archiver: a,
+		report:   report,
+		options:  options,
+	}
+
+	paths, err := st.extract(report, dest, event.Remote)
+	if err != nil {
+		event.EventState = fwcommon.NetStateFailed
+		event.EventSuccess = false
+		a.update(report)
+		return paths, a.logThroughError(err)
+	}
+	return paths, nil
+}
+
+// Extracts an archive file on disk into dest, without any network event. Returns the paths written.
+func (a *Archiver) ExtractFile(archivePath string, dest string, options *ExtractOptions) ([]string, error) {
+	if options == nil {
+		options = (&ExtractOptions{}).Default()
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, a.logThroughError(err)
+	}
+	defer f.Close()
+
+	st := &extractState{
+		archiver: a,
+		options:  options,
+	}
+
+	paths, err := st.extract(f, dest, archivePath)
+	if err != nil {
+		return paths, a.logThroughError(err)
+	}
+	return paths, nil
+}
+
+// Sends the current event state to the debugger
+func (a *Archiver) update(report fwcommon.NetworkProgressReportInterface) {
+	if report != nil && a.deb != nil && a.deb.IsActive() {
+		a.deb.NetUpdateFull(*report.GetNetworkEvent())
+	}
+}
+
+type extractState struct {
+	archiver *Archiver
+	report   fwcommon.NetworkProgressReportInterface // nil for ExtractFile
+	options  *ExtractOptions
+
+	entries  int
+	total    int64
+	paths    []string
+	dest     string   // Absolute dest, entry paths are built from it
+	realDest string   // dest with its symlinks resolved
+	links    []string // Symlinks created from this archive, nothing is extracted beneath them
+}
+
+func (st *extractState) extract(src io.Reader, dest string, nameHint string) ([]string, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination %s: %w", dest, err)
+	}
+	if st.realDest, err = filepath.EvalSymlinks(dest); err != nil {
+		return nil, err
+	}
+	st.dest = dest
+
+	br := bufio.NewReaderSize(src, 512)
+	format := st.options.Format
+	if format == FormatAuto {
+		format = detectFormat(br, nameHint)
+	}
+
+	switch format {
+	case FormatZip:
+		// Files are read with random access directly (ReaderAt ignores what the peek consumed)
+		if f, ok := src.(*os.File); ok {
+			err = st.extractZip(f, dest)
+			return st.paths, err
+		}
+		err = st.extractZip(br, dest)
+		return st.paths, err
+	case FormatTar:
+		err = st.extractTar(br, dest)
+		return st.paths, err
+	case FormatTarGz:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gz.Close()
+		err = st.extractTar(gz, dest)
+		return st.paths, err
+	case FormatTarZst:
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		defer zr.Close()
+		err = st.extractTar(zr, dest)
+		return st.paths, err
+	default:
+		return nil, fmt.Errorf("unknown or unsupported archive format for %s", nameHint)
+	}
+}
+
+// Detects the format from magic bytes, plain tar is detected by its "ustar" magic or the name
+func detectFormat(br *bufio.Reader, nameHint string) ArchiveFormat {
+	head, _ := br.Peek(262)
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return FormatZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return FormatTarGz
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return FormatTarZst
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return FormatTar
+	}
+
+	name := strings.ToLower(nameHint)
+	if i := strings.IndexAny(name, "?#"); i != -1 {
+		name = name[:i]
+	}
+	if strings.HasSuffix(name, ".tar") {
+		return FormatTar
+	}
+	return FormatAuto
+}
+
+// Resolves an entry name inside dest, rejecting absolute paths and anything that escapes dest
+func safeJoin(dest string, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: %s", ErrPathTraversal, name)
+	}
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w: %s", ErrPathTraversal, name)
+	}
+	return target, nil
+}
+
+// Whether path is dest or inside it, compared as text
+func within(dest string, path string) bool {
+	rel, err := filepath.Rel(dest, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) && !filepath.IsAbs(rel)
+}
+
+// Resolves the symlinks on disk in path, the part that does not exist yet is kept as-is (it is created as plain dirs)
+func resolveExisting(path string) (string, error) {
+	for existing := path; ; existing = filepath.Dir(existing) {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			rest, err := filepath.Rel(existing, path)
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(real, rest), nil
+		}
+		if !errors.Is(err, os.ErrNotExist) || filepath.Dir(existing) == existing {
+			return "", err
+		}
+	}
+}
+
+// Resolves linkname from dir the way the OS would, following every link on the way (also dangling ones), the part that does not exist is taken as-is
+func resolveLinkTarget(dir string, linkname string, depth int) (string, error) {
+	if depth > 40 {
+		return "", fmt.Errorf("too many levels of symlinks")
+	}
+	cur := dir
+	if filepath.IsAbs(linkname) {
+		cur = filepath.VolumeName(linkname) + string(os.PathSeparator)
+		linkname = linkname[len(filepath.VolumeName(linkname)):]
+	}
+	for _, part := range strings.Split(filepath.ToSlash(linkname), "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+			continue
+		}
+		next := filepath.Join(cur, part)
+		fi, err := os.Lstat(next)
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			cur = next
+			continue
+		}
+		link, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if cur, err = resolveLinkTarget(cur, link, depth+1); err != nil {
+			return "", err
+		}
+	}
+	return cur, nil
+}
+
+// Checks that every symlink from the archive still resolves inside dest, a new link can change where earlier ones lead
+// (ex. one whose target went through a path that did not exist yet)
+func (st *extractState) checkLinks() error {
+	for _, link := range st.links {
+		rel, err := filepath.Rel(st.dest, link)
+		if err != nil {
+			return err
+		}
+		real, err := resolveLinkTarget(st.realDest, rel, 0)
+		if err != nil || !within(st.realDest, real) {
+			return fmt.Errorf("%w: symlink %s resolves to %s", ErrPathTraversal, link, real)
+		}
+	}
+	return nil
+}
+
+// Checks that dir, with the links already on disk resolved, is still inside dest and not beneath a symlink from the archive.
+// Returns the resolved dir.
+func (st *extractState) checkDir(dir string) (string, error) {
+	for _, link := range st.links {
+		if strings.HasPrefix(dir+string(os.PathSeparator), link+string(os.PathSeparator)) {
+			return "", fmt.Errorf("%w: %s is beneath the symlink %s", ErrPathTraversal, dir, link)
+		}
+	}
+	real, err := resolveExisting(dir)
+	if err != nil {
+		return "", err
+	}
+	if !within(st.realDest, real) {
+		return "", fmt.Errorf("%w: %s resolves to %s", ErrPathTraversal, dir, real)
+	}
+	return real, nil
+}
+
+// Creates a dir entry after checking it does not lead out of dest
+func (st *extractState) writeDir(target string) error {
+	if _, err := st.checkDir(target); err != nil {
+		return err
+	}
+	return os.MkdirAll(target, 0755)
+}
+
+// Counts an entry against MaxEntries
+func (st *extractState) countEntry() error {
+	st.entries++
+	if st.options.MaxEntries > 0 && st.entries > st.options.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, st.options.MaxEntries)
+	}
+	return nil
+}
+
+// Marks an entry as done, steps the event and calls the progressors
+func (st *extractState) entryDone(name string, err error) {
+	if st.report != nil {
+		if err == nil {
+			st.report.IncrSteppingCurrent()
+		}
+		st.archiver.update(st.report)
+	}
+	if st.options.Progressor != nil {
+		st.options.Progressor(st.report, name, err)
+	}
+}
+
+// Writes a single file entry enforcing the size limits
+func (st *extractState) writeFile(target string, src io.Reader, mode os.FileMode) error {
+	if _, err := st.checkDir(filepath.Dir(target)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	// Never write through a symlink, it may point anywhere
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: %s is a symlink", ErrPathTraversal, target)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !st.options.Overwrite {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	f, err := os.OpenFile(target, flags, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Limit to whatever is left of the entry and total budgets, reading one byte more to detect overflow
+	limit := int64(-1)
+	if st.options.MaxEntrySize > 0 {
+		limit = st.options.MaxEntrySize
+	}
+	if st.options.MaxTotalSize > 0 {
+		left := st.options.MaxTotalSize - st.total
+		if limit < 0 || left < limit {
+			limit = left
+		}
+	}
+	if limit >= 0 {
+		src = io.LimitReader(src, limit+1)
+	}
+
+	n, err := io.Copy(f, src)
+	st.total += n
+	if err != nil {
+		return err
+	}
+	if limit >= 0 && n > limit {
+		return fmt.Errorf("%w: %s exceeds the size limit", ErrLimitExceeded, filepath.Base(target))
+	}
+	st.paths = append(st.paths, target)
+	return nil
+}
+
+// Creates a symlink if allowed and the link target stays inside dest, resolved from where the link really ends up on disk through the links there
+func (st *extractState) writeSymlink(target string, linkname string) error {
+	if !st.options.AllowSymlinks {
+		return nil
+	}
+	realParent, err := st.checkDir(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if filepath.IsAbs(linkname) {
+		return fmt.Errorf("%w: symlink %s -> %s", ErrPathTraversal, target, linkname)
+	}
+	if real, err := resolveLinkTarget(realParent, linkname, 0); err != nil || !within(st.realDest, real) {
+		return fmt.Errorf("%w: symlink %s -> %s", ErrPathTraversal, target, linkname)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if st.options.Overwrite {
+		os.Remove(target)
+	}
+	if err := os.Symlink(linkname, target); err != nil {
+		return err
+	}
+	st.links = append(st.links, target)
+	if err := st.checkLinks(); err != nil {
+		os.Remove(target)
+		st.links = st.links[:len(st.links)-1]
+		return err
+	}
+	st.paths = append(st.paths, target)
+	return nil
+}
+
+func (st *extractState) extractTar(src io.Reader, dest string) error {
+	tr := tar.NewReader(src)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		if err := st.countEntry(); err != nil {
+			return err
+		}
+
+		// Entry count is only known once read, so the max grows with each entry
+		if st.report != nil {
+			st.report.SetSteppingMax(st.entries)
+		}
+
+		target, err := safeJoin(dest, header.Name)
+		if err != nil {
+			st.entryDone(header.Name, err)
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = st.writeDir(target)
+		case tar.TypeReg:
+			if st.options.MaxEntrySize > 0 && header.Size > st.options.MaxEntrySize {
+				err = fmt.Errorf("%w: %s exceeds the size limit", ErrLimitExceeded, header.Name)
+			} else {
+				err = st.writeFile(target, tr, os.FileMode(header.Mode))
+			}
+		case tar.TypeSymlink:
+			err = st.writeSymlink(target, header.Linkname)
+		default:
+			// Hardlinks, devices, fifos etc. are never extracted
+			st.archiver.log.Debug(fmt.Sprintf("Skipping unsupported tar entry '%s' (type %c)", header.Name, header.Typeflag))
+		}
+
+		st.entryDone(header.Name, err)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", header.Name, err)
+		}
+	}
+}
+
+func (st *extractState) extractZip(src io.Reader, dest string) error {
+	// Zip needs random access, so files are used directly and streams are spooled to a temp file (still reading through the report for progress)
+	var ra io.ReaderAt
+	var size int64
+	if f, ok := src.(*os.File); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		ra, size = f, fi.Size()
+	} else {
+		tmp, err := os.CreateTemp(st.options.TempDir, "fwarchive-*.zip")
+		if err != nil {
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		// The spool is on disk too, so it counts against the total budget, reading one byte more to detect overflow
+		if st.options.MaxTotalSize > 0 {
+			src = io.LimitReader(src, st.options.MaxTotalSize+1)
+		}
+		size, err = io.Copy(tmp, src)
+		if err != nil {
+			return fmt.Errorf("failed to spool zip archive: %w", err)
+		}
+		if st.options.MaxTotalSize > 0 && size > st.options.MaxTotalSize {
+			return fmt.Errorf("%w: zip archive exceeds the size limit", ErrLimitExceeded)
+		}
+		ra = tmp
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	if st.options.MaxEntries > 0 && len(zr.File) > st.options.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, st.options.MaxEntries)
+	}
+	if st.report != nil {
+		st.report.SetSteppingMax(len(zr.File))
+	}
+
+	for _, zf := range zr.File {
+		if err := st.countEntry(); err != nil {
+			return err
+		}
+
+		target, err := safeJoin(dest, zf.Name)
+		if err != nil {
+			st.entryDone(zf.Name, err)
+			return err
+		}
+
+		mode := zf.Mode()
+		switch {
+		case mode.IsDir():
+			err = st.writeDir(target)
+		case mode&os.ModeSymlink != 0:
+			err = st.extractZipSymlink(target, zf)
+		case st.options.MaxEntrySize > 0 && int64(zf.UncompressedSize64) > st.options.MaxEntrySize:
+			err = fmt.Errorf("%w: %s exceeds the size limit", ErrLimitExceeded, zf.Name)
+		default:
+			var rc io.ReadCloser
+			rc, err = zf.Open()
+			if err == nil {
+				err = st.writeFile(target, rc, mode)
+				rc.Close()
+			}
+		}
+
+		st.entryDone(zf.Name, err)
+		if err != nil {
+			return fmt.Errorf("failed to extract %s: %w", zf.Name, err)
+		}
+	}
+	return nil
+}
+
+func (st *extractState) extractZipSymlink(target string, zf *zip.File) error {
+	if !st.options.AllowSymlinks {
+		return nil
+	}
+	rc, err := zf.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	linkname, err := io.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return err
+	}
+	return st.writeSymlink(target, string(linkname))
+}
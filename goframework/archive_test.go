@@ -0,0 +1,227 @@
+package libgoframework
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	fwarchive "github.com/sbamboo/goframework/archive"
+)
+
+var archiveTestFiles = map[string]string{
+	"readme.txt":       "hello from the archive",
+	"nested/data.json": `{"ok":true}`,
+}
+
+func buildTestTar(files map[string]string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	return buf.Bytes()
+}
+
+func buildTestZip(files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestArchiveExtract(t *testing.T) {
+	tarball := buildTestTar(archiveTestFiles)
+
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	gzw.Write(tarball)
+	gzw.Close()
+
+	zw, _ := zstd.NewWriter(nil)
+	zst := zw.EncodeAll(tarball, nil)
+	zw.Close()
+
+	archives := map[string][]byte{
+		"/test.zip":     buildTestZip(archiveTestFiles),
+		"/test.tar":     tarball,
+		"/test.tar.gz":  gz.Bytes(),
+		"/test.tar.zst": zst,
+		"/evil.zip":     buildTestZip(map[string]string{"../escape.txt": "nope"}),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(archives[r.URL.Path])
+	}))
+	defer server.Close()
+
+	netOptions := (&NetFetchOptions{}).Default()
+	fw := SetupFramework(netOptions)
+
+	for _, name := range []string{"/test.zip", "/test.tar", "/test.tar.gz", "/test.tar.zst"} {
+		dest := t.TempDir()
+
+		report, err := fw.Net.Fetch(MethodGet, server.URL+name, true, false, nil, nil, nil, Ptr("archive"+name), nil, netOptions, nil)
+		if err != nil {
+			t.Fatalf("%s: fetch failed: %v", name, err)
+		}
+
+		paths, err := fw.Archive.Extract(report, dest, nil)
+		if err != nil {
+			t.Fatalf("%s: extract failed: %v", name, err)
+		}
+		if len(paths) != len(archiveTestFiles) {
+			t.Errorf("%s: expected %d paths, got %d", name, len(archiveTestFiles), len(paths))
+		}
+		for file, content := range archiveTestFiles {
+			got, err := os.ReadFile(filepath.Join(dest, file))
+			if err != nil || string(got) != content {
+				t.Errorf("%s: %s not extracted correctly: %v", name, file, err)
+			}
+		}
+
+		event := report.GetNetworkEvent()
+		if event.EventStepMax == nil || event.EventStepCurrent == nil || *event.EventStepCurrent != len(archiveTestFiles) || *event.EventStepMax != len(archiveTestFiles) {
+			t.Errorf("%s: expected stepping %d/%d, got %v/%v", name, len(archiveTestFiles), len(archiveTestFiles), event.EventStepCurrent, event.EventStepMax)
+		}
+	}
+
+	// --- Path traversal ---
+	dest := t.TempDir()
+	report, err := fw.Net.Fetch(MethodGet, server.URL+"/evil.zip", true, false, nil, nil, nil, Ptr("archive.evil"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("evil: fetch failed: %v", err)
+	}
+	_, err = fw.Archive.Extract(report, filepath.Join(dest, "out"), nil)
+	if !errors.Is(err, fwarchive.ErrPathTraversal) {
+		t.Errorf("expected ErrPathTraversal, got: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(dest, "escape.txt")); statErr == nil {
+		t.Errorf("traversal entry was written outside the destination")
+	}
+
+	// --- Size limit ---
+	report, err = fw.Net.Fetch(MethodGet, server.URL+"/test.tar.gz", true, false, nil, nil, nil, Ptr("archive.limit"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("limit: fetch failed: %v", err)
+	}
+	options := (&ExtractOptions{}).Default()
+	options.MaxTotalSize = 5
+	_, err = fw.Archive.Extract(report, t.TempDir(), options)
+	if !errors.Is(err, fwarchive.ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded, got: %v", err)
+	}
+
+	// --- A streamed zip is spooled within the size limit too, even if its entries would fit ---
+	report, err = fw.Net.Fetch(MethodGet, server.URL+"/test.zip", true, false, nil, nil, nil, Ptr("archive.spool"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("spool: fetch failed: %v", err)
+	}
+	options.MaxTotalSize = int64(len(archives["/test.zip"]) - 1)
+	options.TempDir = t.TempDir()
+	_, err = fw.Archive.Extract(report, t.TempDir(), options)
+	if !errors.Is(err, fwarchive.ErrLimitExceeded) {
+		t.Errorf("expected the zip spool to hit ErrLimitExceeded, got: %v", err)
+	}
+	if spooled, _ := os.ReadDir(options.TempDir); len(spooled) != 0 {
+		t.Errorf("expected the spool file to be removed, found %d", len(spooled))
+	}
+}
+
+func TestArchiveSymlinks(t *testing.T) {
+	type entry struct{ name, link, content string }
+	extract := func(dest string, entries ...entry) error {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, e := range entries {
+			if e.link != "" {
+				tw.WriteHeader(&tar.Header{Name: e.name, Linkname: e.link, Mode: 0777, Typeflag: tar.TypeSymlink})
+				continue
+			}
+			tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg})
+			tw.Write([]byte(e.content))
+		}
+		tw.Close()
+		file := filepath.Join(t.TempDir(), "links.tar")
+		os.WriteFile(file, buf.Bytes(), 0644)
+
+		options := (&ExtractOptions{}).Default()
+		options.AllowSymlinks = true
+		_, err := SetupFramework((&NetFetchOptions{}).Default()).Archive.ExtractFile(file, dest, options)
+		return err
+	}
+
+	// Links inside dest work
+	dest := filepath.Join(t.TempDir(), "out")
+	if err := extract(dest, entry{name: "nested/data.json", content: "{}"}, entry{name: "latest", link: "nested"}); err != nil {
+		t.Fatalf("expected a link inside dest to extract: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "latest", "data.json")); string(got) != "{}" {
+		t.Errorf("expected the link to point at nested, got %q", got)
+	}
+
+	// Chained links that each look fine as text but together point out of dest
+	root := t.TempDir()
+	dest = filepath.Join(root, "out")
+	err := extract(dest, entry{name: "y", link: "."}, entry{name: "y/z", link: ".."}, entry{name: "y/z/evil.txt", content: "nope"})
+	if !errors.Is(err, fwarchive.ErrPathTraversal) {
+		t.Errorf("expected chained links to be refused with ErrPathTraversal, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "evil.txt")); err == nil {
+		t.Errorf("a file was written outside the destination through chained links")
+	}
+
+	// A link target is resolved through the links the archive already made, d/b -> .. makes b/../../x leave dest
+	root = t.TempDir()
+	dest = filepath.Join(root, "out")
+	err = extract(dest, entry{name: "d/b", link: ".."}, entry{name: "d/a", link: "b/../../x"})
+	if !errors.Is(err, fwarchive.ErrPathTraversal) {
+		t.Errorf("expected a link through an earlier link out of dest to be refused, got: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "d", "a")); err == nil {
+		t.Errorf("the escaping link was created")
+	}
+
+	// A later link can not redirect an earlier one out of dest, c/../x is fine until c -> .
+	root = t.TempDir()
+	dest = filepath.Join(root, "out")
+	err = extract(dest, entry{name: "a", link: "c/../x"}, entry{name: "c", link: "."})
+	if !errors.Is(err, fwarchive.ErrPathTraversal) {
+		t.Errorf("expected a link redirecting an earlier one out of dest to be refused, got: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "c")); err == nil {
+		t.Errorf("the redirecting link was created")
+	}
+
+	// Links already on disk are followed when checking
+	root = t.TempDir()
+	dest = filepath.Join(root, "out")
+	os.MkdirAll(dest, 0755)
+	if err := os.Symlink(root, filepath.Join(dest, "up")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := extract(dest, entry{name: "up/evil.txt", content: "nope"}); !errors.Is(err, fwarchive.ErrPathTraversal) {
+		t.Errorf("expected an existing link out of dest to be refused, got: %v", err)
+	}
+	if err := extract(dest, entry{name: "up", content: "nope"}); !errors.Is(err, fwarchive.ErrPathTraversal) {
+		t.Errorf("expected writing through an existing link to be refused, got: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "evil.txt")); err == nil {
+		t.Errorf("a file was written outside the destination through an existing link")
+	}
+}
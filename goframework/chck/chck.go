@@ -2,13 +2,9 @@ package goframework_chck
 
 import (
 	"crypto"
-	"crypto/ed25519"
-	"crypto/rsa"
 	"crypto/sha1"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/hex"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"hash"
@@ -44,21 +40,24 @@ func (cptr *Chck) newHasher(algo fwcommon.HashAlgorithm) (hash.Hash, error) {
 	}
 }
 
-// Takes a PEM-encoded public key and turns it as a Go crypto-public-key object
-func (cptr *Chck) parsePublicKey(pemBytes []byte) (any, error) {
-	block, _ := pem.Decode(pemBytes)
-	if block == nil {
-		return nil, cptr.log.LogThroughError(errors.New("invalid public key PEM"))
-	}
+// Returns a fresh hasher for incremental hashing, finish it with HashSum
+func (cptr *Chck) NewHasher(algo fwcommon.HashAlgorithm) (hash.Hash, error) {
+	return cptr.newHasher(algo)
+}
 
-	// Explicitly reject private keys
-	if strings.Contains(strings.ToUpper(block.Type), "PRIVATE") {
-		return nil, cptr.log.LogThroughError(
-			errors.New("private key supplied where public key expected"),
-		)
+// Formats the sum of a hasher from NewHasher the same way as Hash/HashBuff (CRC32 is string of int)
+func (cptr *Chck) HashSum(h hash.Hash, algo fwcommon.HashAlgorithm) string {
+	if algo == fwcommon.CRC32 {
+		if h32, ok := h.(hash.Hash32); ok {
+			return fmt.Sprint(h32.Sum32())
+		}
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	pubKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+// Takes a PEM-encoded public key and turns it as a Go crypto-public-key object
+func (cptr *Chck) parsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	pubKey, err := ParsePublicKeyPEM(pemBytes)
 	if err != nil {
 		return nil, cptr.log.LogThroughError(err)
 	}
@@ -149,54 +148,19 @@ func (cptr *Chck) ChckStr(content string, sum string, algo fwcommon.HashAlgorith
 	return hash != "" && strings.EqualFold(hash, sum)
 }
 
-// Verifies a signature against a byte array
+// Verifies a signature against a byte array, an empty algo picks the algorithm from the key type
 func (cptr *Chck) verifySignature(data []byte, algo fwcommon.SigAlgorithm, pubKeyPEM []byte, signature []byte) bool {
 	pubKey, err := cptr.parsePublicKey(pubKeyPEM)
 	if err != nil {
 		return false
 	}
 
-	switch algo {
-
-	case fwcommon.ED25519:
-		key, ok := pubKey.(ed25519.PublicKey)
-		if !ok {
-			cptr.log.LogThroughError(
-				errors.New("public key is not Ed25519"),
-			)
-			return false
-		}
-
-		return ed25519.Verify(key, data, signature)
-
-	case fwcommon.RSA:
-		key, ok := pubKey.(*rsa.PublicKey)
-		if !ok {
-			cptr.log.LogThroughError(
-				errors.New("public key is not RSA"),
-			)
-			return false
-		}
-
-		hash := sha256.Sum256(data)
-		if err := rsa.VerifyPKCS1v15(
-			key,
-			crypto.SHA256,
-			hash[:],
-			signature,
-		); err != nil {
-			cptr.log.LogThroughError(err)
-			return false
-		}
-
-		return true
-
-	default:
-		cptr.log.LogThroughError(
-			errors.New("unsupported signature algorithm"),
-		)
+	if err := VerifyMessage(algo, pubKey, data, signature); err != nil {
+		cptr.log.LogThroughError(err)
 		return false
 	}
+
+	return true
 }
 
 // Verifies the signature of a signed file (priv/pub)
@@ -0,0 +1,113 @@
+package goframework_chck
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) by VerifyDigest and VerifyMessage when a signature does not verify
+var ErrSignatureVerification = errors.New("signature verification failed")
+
+// Takes a PEM-encoded public key and turns it into a Go crypto public key, private keys are rejected
+func ParsePublicKeyPEM(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+
+	// Explicitly reject private keys
+	if strings.Contains(strings.ToUpper(block.Type), "PRIVATE") {
+		return nil, errors.New("private key supplied where public key expected")
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// SigAlgorithmFor returns algo if it fits the key, or the algorithm of the key's type if algo is empty.
+// An RSA key gives RSA (PKCS#1 v1.5), VerifyDigest also accepts PSS for it then.
+func SigAlgorithmFor(key crypto.PublicKey, algo fwcommon.SigAlgorithm) (fwcommon.SigAlgorithm, error) {
+	var fits []fwcommon.SigAlgorithm
+	switch key.(type) {
+	case ed25519.PublicKey:
+		fits = []fwcommon.SigAlgorithm{fwcommon.ED25519}
+	case *ecdsa.PublicKey:
+		fits = []fwcommon.SigAlgorithm{fwcommon.ECDSA}
+	case *rsa.PublicKey:
+		fits = []fwcommon.SigAlgorithm{fwcommon.RSA, fwcommon.RSA_PSS}
+	default:
+		return "", fmt.Errorf("unsupported public key type %T", key)
+	}
+	if algo == "" {
+		return fits[0], nil
+	}
+	for _, fit := range fits {
+		if fit == algo {
+			return algo, nil
+		}
+	}
+	return "", fmt.Errorf("public key %T can not verify %s signatures", key, algo)
+}
+
+// VerifyDigest checks a signature over the digest of some content made with hash, the way go-update verifies updates.
+// ECDSA and RSA verify the digest as a hash, Ed25519 (which does not sign hashes) takes the digest bytes as its message.
+// With algo empty the algorithm follows the key type.
+func VerifyDigest(algo fwcommon.SigAlgorithm, key crypto.PublicKey, hash crypto.Hash, digest []byte, signature []byte) error {
+	explicit := algo != ""
+	algo, err := SigAlgorithmFor(key, algo)
+	if err != nil {
+		return err
+	}
+
+	ok := false
+	switch algo {
+	case fwcommon.ED25519:
+		ok = ed25519.Verify(key.(ed25519.PublicKey), digest, signature)
+	case fwcommon.ECDSA:
+		ok = ecdsa.VerifyASN1(key.(*ecdsa.PublicKey), digest, signature)
+	case fwcommon.RSA, fwcommon.RSA_PSS:
+		rsaKey := key.(*rsa.PublicKey)
+		if algo == fwcommon.RSA {
+			ok = rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature) == nil
+		}
+		if algo == fwcommon.RSA_PSS || (!ok && !explicit) {
+			ok = rsa.VerifyPSS(rsaKey, hash, digest, signature, nil) == nil
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSignatureVerification, algo)
+	}
+	return nil
+}
+
+// VerifyMessage checks a signature over message: Ed25519 signs the message itself, ECDSA and RSA its sha256.
+func VerifyMessage(algo fwcommon.SigAlgorithm, key crypto.PublicKey, message []byte, signature []byte) error {
+	resolved, err := SigAlgorithmFor(key, algo)
+	if err != nil {
+		return err
+	}
+	if resolved == fwcommon.ED25519 {
+		return VerifyDigest(algo, key, 0, message, signature)
+	}
+	sum := sha256.Sum256(message)
+	return VerifyDigest(algo, key, crypto.SHA256, sum[:], signature) // algo as given, an RSA key without one also accepts PSS
+}
+
+// Verifier implements go-update's Verifier with VerifyDigest, Algorithm empty to follow the key type.
+// go-update only hands over the checksum, so Ed25519 signatures have to be over the digest here, unlike with VerifyMessage and the updater.
+type Verifier struct {
+	Algorithm fwcommon.SigAlgorithm
+}
+
+func (v Verifier) VerifySignature(checksum []byte, signature []byte, hash crypto.Hash, publicKey crypto.PublicKey) error {
+	return VerifyDigest(v.Algorithm, publicKey, hash, checksum, signature)
+}
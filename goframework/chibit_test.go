@@ -0,0 +1,837 @@
+package libgoframework
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	fwnet "github.com/sbamboo/goframework/net"
+)
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChibitV2(t *testing.T) {
+	const uuid = "5b000da3-0a3e-475d-a262-dc395b45dbf7"
+	part1 := []byte(strings.Repeat("first chunk ", 100))
+	part2 := []byte(strings.Repeat("second chunk ", 100))
+	full := append(append([]byte{}, part1...), part2...)
+
+	zw, _ := zstd.NewWriter(nil)
+	part2Compressed := zw.EncodeAll(part2, nil)
+	zw.Close()
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+
+	files := map[string][]byte{
+		"/chibits/chunks/" + sha256Hex(part1):           part1,
+		"/chibits/chunks/" + sha256Hex(part2) + ".zstd": part2Compressed,
+		"/chibits/entries/" + uuid + ".v1.json":         []byte(`{"filename":"v1.bin","checksum":{"algorithm":"sha256","hash":"` + sha256Hex(full) + `"},"size":0,"type":"split","chunks":[],"max-size":0,"chibit-version":"1.0"}`),
+	}
+
+	var server *httptest.Server
+	entryUUID := uuid // The uuid the entry names itself
+	buildEntry := func(signWith ed25519.PrivateKey, tamper bool) {
+		entry := map[string]any{
+			"chibit-version": "2.0",
+			"filename":       "pack.bin",
+			"size":           len(full),
+			"checksum":       map[string]any{"algorithm": "sha256", "hash": sha256Hex(full)},
+			"chunk-bases":    []string{"../chunks/"},
+			"chunks": []map[string]any{
+				{"hash": sha256Hex(part1), "algorithm": "sha256", "size": len(part1)},
+				// The explicit mirror is broken so the content-addressed base is used
+				{"hash": sha256Hex(part2), "algorithm": "sha256", "size": len(part2), "compression": "zstd", "urls": []string{server.URL + "/missing"}},
+			},
+		}
+		if entryUUID != "" {
+			entry["uuid"] = entryUUID
+		}
+		raw, _ := json.Marshal(entry)
+		if signWith != nil {
+			canonical, err := ChibitCanonicalEntry(raw)
+			if err != nil {
+				t.Fatalf("canonical entry: %v", err)
+			}
+			entry["signature"] = map[string]any{"algorithm": "ed25519", "key-id": "main", "value": base64.StdEncoding.EncodeToString(ed25519.Sign(signWith, canonical))}
+		}
+		if tamper {
+			entry["filename"] = "evil.bin"
+		}
+		raw, _ = json.MarshalIndent(entry, "", "    ")
+		files["/chibits/entries/"+uuid+".json"] = raw
+	}
+
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chibits/chibits.json" {
+			// Offers both versions, the V2 entry should be negotiated
+			w.Write([]byte(`{"` + uuid + `": {"1.0": "` + server.URL + `/chibits/entries/` + uuid + `.v1.json", "2.0": "` + server.URL + `/chibits/entries/` + uuid + `.json"}}`))
+			return
+		}
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+
+	netOptions := (&NetFetchOptions{}).Default()
+	fw := SetupFramework(netOptions)
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	fetch := func(options *NetFetchOptions) (NetworkProgressReportInterface, error) {
+		return fw.Net.FetchWithChibits(MethodGet, "chibit:"+uuid+"@"+server.URL, false, false, nil, nil, nil, Ptr("chibit.v2"), nil, options, nil, fw.Chck, nil)
+	}
+
+	trusted := *netOptions
+	trusted.ChibitTrustedKeys = []ChibitTrustedKey{{ID: "main", Algorithm: ED25519, PublicKeyPEM: pubPEM}}
+
+	// --- Signed entry, verified ---
+	buildEntry(priv, false)
+	report, err := fetch(&trusted)
+	if err != nil {
+		t.Fatalf("signed V2 fetch failed: %v", err)
+	}
+	if !bytes.Equal(report.GetNonStreamBytes(), full) {
+		t.Errorf("assembled content mismatch, got %d bytes expected %d", len(report.GetNonStreamBytes()), len(full))
+	}
+
+	// --- Tampered entry ---
+	buildEntry(priv, true)
+	if _, err := fetch(&trusted); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected a tampered entry to fail verification, got: %v", err)
+	}
+
+	// --- Signed by another key ---
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	buildEntry(otherPriv, false)
+	if _, err := fetch(&trusted); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected an untrusted signature to fail verification, got: %v", err)
+	}
+
+	// --- Signed entry of another uuid, or one that does not name its uuid ---
+	for _, other := range []string{"9f0c2b1e-7d4a-4e8b-a1c3-5e6f7a8b9c0d", ""} {
+		entryUUID = other
+		buildEntry(priv, false)
+		if _, err := fetch(&trusted); !errors.Is(err, ErrChibitVerification) {
+			t.Errorf("expected a signed entry naming %q to fail verification, got: %v", other, err)
+		}
+	}
+	entryUUID = uuid
+
+	// --- Unsigned entry without trusted keys ---
+	buildEntry(nil, false)
+	if _, err := fetch(netOptions); err != nil {
+		t.Errorf("unsigned V2 fetch failed: %v", err)
+	}
+
+	// --- Corrupted chunk ---
+	files["/chibits/chunks/"+sha256Hex(part1)] = []byte("corrupted")
+	if _, err := fetch(netOptions); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected a corrupted chunk to fail verification, got: %v", err)
+	}
+}
+
+func TestChibitStreaming(t *testing.T) {
+	const uuid = "0e1f6a5c-3b8e-4f6a-9d7e-2c4b1a0f9e8d"
+	chunks := [][]byte{
+		[]byte(strings.Repeat("a", 4096)),
+		[]byte(strings.Repeat("b", 4096)),
+		[]byte(strings.Repeat("c", 1000)),
+	}
+	full := bytes.Join(chunks, nil)
+
+	var server *httptest.Server
+	var requested []string
+	checksum := crc32.ChecksumIEEE(full)
+	declared := int64(len(full))
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		switch {
+		case r.URL.Path == "/chibits/chibits.json":
+			w.Write([]byte(`{"` + uuid + `": "` + server.URL + `/chibits/entries/` + uuid + `.json"}`))
+		case r.URL.Path == "/chibits/entries/"+uuid+".json":
+			urls := []string{}
+			for i := range chunks {
+				urls = append(urls, server.URL+"/chunks/"+fmt.Sprint(i))
+			}
+			entry, _ := json.Marshal(map[string]any{
+				"filename":       "pack.bin",
+				"checksum":       map[string]any{"algorithm": "crc32", "hash": checksum},
+				"size":           declared,
+				"type":           "split",
+				"chunks":         urls,
+				"max-size":       4096,
+				"chibit-version": "1.0",
+			})
+			w.Write(entry)
+		case strings.HasPrefix(r.URL.Path, "/chunks/"):
+			var i int
+			fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/chunks/"), &i)
+			w.Write(chunks[i])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	fetch := func(stream bool, file bool, fileout *string) (NetworkProgressReportInterface, error) {
+		requested = nil
+		return fw.Net.FetchWithChibits(MethodGet, "chibit:"+uuid+"@"+server.URL, stream, file, fileout, nil, nil, Ptr("chibit.stream"), nil, nil, nil, fw.Chck, nil)
+	}
+
+	// --- Stream, chunks are only fetched as they are read ---
+	report, err := fetch(true, false, nil)
+	if err != nil {
+		t.Fatalf("stream fetch failed: %v", err)
+	}
+	if len(requested) != 2 {
+		t.Errorf("expected only the index and entry before reading, got %v", requested)
+	}
+	if report.GetNetworkEvent().Size != int64(len(full)) {
+		t.Errorf("expected Size %d up front, got %d", len(full), report.GetNetworkEvent().Size)
+	}
+	content, err := io.ReadAll(report)
+	report.Close()
+	if err != nil || !bytes.Equal(content, full) {
+		t.Fatalf("streamed content mismatch (%d bytes): %v", len(content), err)
+	}
+	if report.GetNetworkEvent().Transferred != int64(len(full)) {
+		t.Errorf("expected Transferred %d, got %d", len(full), report.GetNetworkEvent().Transferred)
+	}
+
+	// --- File ---
+	out := filepath.Join(t.TempDir(), "pack.bin")
+	report, err = fetch(false, true, &out)
+	if err != nil {
+		t.Fatalf("file fetch failed: %v", err)
+	}
+	if written, _ := os.ReadFile(out); !bytes.Equal(written, full) {
+		t.Errorf("file content mismatch, got %d bytes", len(written))
+	}
+	if event := report.GetNetworkEvent(); event.Transferred != event.Size || event.Size != int64(len(full)) {
+		t.Errorf("expected Transferred == Size == %d, got %d/%d", len(full), event.Transferred, event.Size)
+	}
+
+	// --- Buffered, the string copy is only made when asked for ---
+	report, err = fetch(false, false, nil)
+	if err == nil && report.(*fwnet.NetProgressReport).Content != nil {
+		t.Errorf("expected the buffered content to be held once, as bytes")
+	}
+	if err != nil || !bytes.Equal(report.GetNonStreamBytes(), full) || *report.GetNonStreamContent() != string(full) {
+		t.Errorf("buffered fetch mismatch: %v", err)
+	}
+
+	// --- Checksum mismatch removes the file ---
+	checksum++
+	if _, err := fetch(false, true, &out); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected a checksum mismatch to fail verification, got: %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected the unverified file to be removed, stat: %v", err)
+	}
+
+	// --- A huge declared size fails instead of being allocated up front ---
+	checksum--
+	declared = 1e15
+	if _, err := fetch(false, false, nil); err == nil {
+		t.Errorf("expected a size mismatch to fail the fetch")
+	}
+}
+
+func TestChibitOversizedChunks(t *testing.T) {
+	const endlessUUID = "3f2a1b0c-9d8e-4f7a-8b6c-5d4e3f2a1b0c"
+	const bombUUID = "4a3b2c1d-0e9f-4a8b-9c7d-6e5f4a3b2c1d"
+	declared := []byte(strings.Repeat("x", 1000))
+
+	zw, _ := zstd.NewWriter(nil)
+	bomb := zw.EncodeAll(make([]byte, 32*1024*1024), nil)
+	zw.Close()
+
+	var server *httptest.Server
+	entry := func(uuid string, source string, compression string) []byte {
+		raw, _ := json.Marshal(map[string]any{
+			"chibit-version": "2.0",
+			"uuid":           uuid,
+			"filename":       "pack.bin",
+			"size":           len(declared),
+			"chunks":         []map[string]any{{"hash": sha256Hex(declared), "size": len(declared), "compression": compression, "urls": []string{server.URL + source}}},
+		})
+		return raw
+	}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chibits/chibits.json":
+			w.Write([]byte(`{"` + endlessUUID + `": "entries/endless.json", "` + bombUUID + `": "entries/bomb.json"}`))
+		case "/chibits/entries/endless.json":
+			w.Write(entry(endlessUUID, "/endless", ""))
+		case "/chibits/entries/bomb.json":
+			w.Write(entry(bombUUID, "/bomb", "zstd"))
+		case "/endless":
+			buf := make([]byte, 32*1024)
+			for r.Context().Err() == nil {
+				if _, err := w.Write(buf); err != nil {
+					return
+				}
+			}
+		case "/bomb":
+			w.Write(bomb)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	// A source is cut off just past the declared size, streamed and prefetched alike
+	for _, concurrency := range []int{1, 2} {
+		options := (&NetFetchOptions{}).Default()
+		options.ChibitConcurrency = concurrency
+		options.ChibitChunkRetries = 0
+		for _, uuid := range []string{endlessUUID, bombUUID} {
+			_, err := fw.Net.FetchWithChibits(MethodGet, "chibit:"+uuid+"@"+server.URL, false, false, nil, nil, nil, Ptr("chibit.oversized"), nil, options, nil, fw.Chck, nil)
+			if !errors.Is(err, ErrChibitVerification) {
+				t.Errorf("%s (concurrency %d): expected ErrChibitVerification, got %v", uuid, concurrency, err)
+			}
+		}
+	}
+}
+
+func TestChibitV2ResumesBrokenSource(t *testing.T) {
+	const uuid = "9c4a2e71-5d3b-4c8f-a1e6-7b0d3f2c5a94"
+	chunk := []byte(strings.Repeat("resumable chunk content ", 500))
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chibits/chibits.json":
+			w.Write([]byte(`{"` + uuid + `": "` + server.URL + `/chibits/entries/` + uuid + `.json"}`))
+		case "/chibits/entries/" + uuid + ".json":
+			w.Write([]byte(`{"chibit-version":"2.0","filename":"resume.bin","size":` + fmt.Sprint(len(chunk)) + `,"chunk-bases":["` + server.URL + `/good/"],"chunks":[{"hash":"` + sha256Hex(chunk) + `","size":` + fmt.Sprint(len(chunk)) + `,"urls":["` + server.URL + `/broken"]}]}`))
+		case "/broken":
+			// Announces the full chunk but drops the connection halfway
+			w.Header().Set("Content-Length", fmt.Sprint(len(chunk)))
+			w.Write(chunk[:len(chunk)/2])
+		case "/good/" + sha256Hex(chunk):
+			w.Write(chunk)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	// Resuming only applies to streamed chunks
+	options := (&NetFetchOptions{}).Default()
+	options.ChibitConcurrency = 1
+	report, err := fw.Net.FetchWithChibits(MethodGet, "chibit:"+uuid+"@"+server.URL, false, false, nil, nil, nil, Ptr("chibit.resume"), nil, options, nil, fw.Chck, nil)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if !bytes.Equal(report.GetNonStreamBytes(), chunk) {
+		t.Errorf("resumed content mismatch, got %d bytes expected %d", len(report.GetNonStreamBytes()), len(chunk))
+	}
+}
+
+func TestChibitParallelChunks(t *testing.T) {
+	const uuid = "3f9b7c12-8e4d-4a6b-b5c3-1d2e9f0a7b68"
+	var chunks [][]byte
+	for i := 0; i < 6; i++ {
+		chunks = append(chunks, []byte(strings.Repeat(fmt.Sprint(i), 2048+i)))
+	}
+	full := bytes.Join(chunks, nil)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	failuresLeft := map[string]int{}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/chibits/chibits.json":
+			w.Write([]byte(`{"` + uuid + `": "` + server.URL + `/chibits/entries/` + uuid + `.json"}`))
+		case r.URL.Path == "/chibits/entries/"+uuid+".json":
+			descs := []map[string]any{}
+			for i, c := range chunks {
+				desc := map[string]any{"hash": sha256Hex(c), "size": len(c)}
+				if i == 4 {
+					// The mirror serves the wrong content, the chunk base has the right one
+					desc["urls"] = []string{server.URL + "/chunks/" + sha256Hex(chunks[0])}
+				}
+				descs = append(descs, desc)
+			}
+			entry, _ := json.Marshal(map[string]any{"chibit-version": "2.0", "filename": "parallel.bin", "size": len(full), "chunk-bases": []string{"/chunks/"}, "chunks": descs})
+			w.Write(entry)
+		case strings.HasPrefix(r.URL.Path, "/chunks/"):
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			fail := failuresLeft[r.URL.Path] > 0
+			if fail {
+				failuresLeft[r.URL.Path]--
+			}
+			mu.Unlock()
+			defer func() {
+				mu.Lock()
+				inFlight--
+				mu.Unlock()
+			}()
+
+			time.Sleep(30 * time.Millisecond)
+			if fail {
+				http.Error(w, "try again", http.StatusServiceUnavailable)
+				return
+			}
+			for _, c := range chunks {
+				if r.URL.Path == "/chunks/"+sha256Hex(c) {
+					w.Write(c)
+					return
+				}
+			}
+			http.NotFound(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	options := (&NetFetchOptions{}).Default()
+	options.ChibitConcurrency = 3
+	options.ChibitChunkRetries = 1
+	fetch := func() (NetworkProgressReportInterface, error) {
+		return fw.Net.FetchWithChibits(MethodGet, "chibit:"+uuid+"@"+server.URL, false, false, nil, nil, nil, Ptr("chibit.parallel"), nil, options, nil, fw.Chck, nil)
+	}
+
+	// Chunk 2 fails once and is retried
+	failuresLeft["/chunks/"+sha256Hex(chunks[2])] = 1
+	report, err := fetch()
+	if err != nil {
+		t.Fatalf("parallel fetch failed: %v", err)
+	}
+	if !bytes.Equal(report.GetNonStreamBytes(), full) {
+		t.Errorf("chunks were not assembled in order")
+	}
+	if maxInFlight < 2 || maxInFlight > options.ChibitConcurrency {
+		t.Errorf("expected between 2 and %d chunks in flight, got %d", options.ChibitConcurrency, maxInFlight)
+	}
+	event := report.GetNetworkEvent()
+	if event.EventStepMax == nil || *event.EventStepMax != len(chunks) || event.EventStepCurrent == nil || *event.EventStepCurrent != len(chunks) {
+		t.Errorf("expected the chibit event to step once per chunk, got %v/%v", event.EventStepCurrent, event.EventStepMax)
+	}
+	if event.Transferred != int64(len(full)) || event.Size != int64(len(full)) {
+		t.Errorf("expected Transferred == Size == %d, got %d/%d", len(full), event.Transferred, event.Size)
+	}
+
+	// Without retries a failing chunk fails the chibit
+	options.ChibitChunkRetries = 0
+	failuresLeft["/chunks/"+sha256Hex(chunks[2])] = 1
+	if _, err := fetch(); err == nil {
+		t.Errorf("expected a failing chunk without retries to fail the fetch")
+	}
+}
+
+func TestChibitPublishRoundTrip(t *testing.T) {
+	repo := t.TempDir()
+	server := httptest.NewServer(http.FileServer(http.Dir(repo)))
+	defer server.Close()
+
+	content := make([]byte, 10000)
+	rand.Read(content)
+	file := filepath.Join(t.TempDir(), "pack.bin")
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	trusted := (&NetFetchOptions{}).Default()
+	trusted.ChibitTrustedKeys = []ChibitTrustedKey{{ID: "release", PublicKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})}}
+
+	cases := []struct {
+		name    string
+		options ChibitPublishOptions
+		chunks  int
+	}{
+		{"v1 crc32", ChibitPublishOptions{Version: "1.0", Algorithm: CRC32, MaxSize: 3000}, 4},
+		{"v2 single absolute", ChibitPublishOptions{BaseURL: server.URL + "/"}, 1},
+		// The same content in the same chunk store, once per compression
+		{"v2 plain", ChibitPublishOptions{MaxSize: 4000}, 3},
+		{"v2 gzip", ChibitPublishOptions{MaxSize: 4000, Compression: "gzip"}, 3},
+		// Last, signing also signs the index which can then only be updated by signed publishes
+		{"v2 zstd signed", ChibitPublishOptions{MaxSize: 4000, Compression: "zstd", SignatureAlgorithm: ED25519, SignatureKeyID: "release", Signer: func(data []byte) ([]byte, error) { return ed25519.Sign(priv, data), nil }}, 3},
+	}
+
+	var uris []string
+	for _, c := range cases {
+		published, err := PublishChibit(repo, file, c.options, fw.Chck)
+		if err != nil {
+			t.Fatalf("%s: publish failed: %v", c.name, err)
+		}
+		if len(published.ChunkPaths) != c.chunks {
+			t.Errorf("%s: expected %d chunks, got %d", c.name, c.chunks, len(published.ChunkPaths))
+		}
+
+		uri := published.URI
+		if c.options.BaseURL == "" {
+			uri += "@" + server.URL
+		}
+		report, err := fw.Net.FetchWithChibits(MethodGet, uri, false, false, nil, nil, nil, Ptr("chibit.publish"), nil, trusted, nil, fw.Chck, nil)
+		if err != nil {
+			t.Fatalf("%s: fetch of %s failed: %v", c.name, uri, err)
+		}
+		if !bytes.Equal(report.GetNonStreamBytes(), content) {
+			t.Errorf("%s: fetched content does not match the published file", c.name)
+		}
+		uris = append(uris, uri)
+	}
+
+	// Later publishes of the same content with another compression leave the earlier chunks alone
+	for _, uri := range uris {
+		report, err := fw.Net.FetchWithChibits(MethodGet, uri, false, false, nil, nil, nil, Ptr("chibit.publish"), nil, trusted, nil, fw.Chck, nil)
+		if err != nil || !bytes.Equal(report.GetNonStreamBytes(), content) {
+			t.Errorf("refetch of %s failed: %v", uri, err)
+		}
+	}
+
+	// Every publish was added to the same index
+	var index map[string]json.RawMessage
+	raw, _ := os.ReadFile(filepath.Join(repo, "chibits", "chibits.json"))
+	if err := json.Unmarshal(raw, &index); err != nil || len(index) != len(cases) {
+		t.Errorf("expected %d chibits in the index, got %d (%v)", len(cases), len(index), err)
+	}
+
+	// A given uuid has to be one, it names files in the repo
+	for _, uuid := range []string{"../../x", "not-a-uuid"} {
+		if _, err := PublishChibit(t.TempDir(), file, ChibitPublishOptions{UUID: uuid}, fw.Chck); !errors.Is(err, ErrInvalidChibitURI) {
+			t.Errorf("%q: expected ErrInvalidChibitURI, got %v", uuid, err)
+		}
+	}
+}
+
+func TestChibitLocalReposAndIndexCache(t *testing.T) {
+	repo := t.TempDir()
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	contents := map[string][]byte{}
+	for i := 0; i < 2; i++ {
+		content := []byte(strings.Repeat(fmt.Sprintf("local repo file %d ", i), 300))
+		file := filepath.Join(t.TempDir(), "file.bin")
+		os.WriteFile(file, content, 0644)
+		published, err := PublishChibit(repo, file, ChibitPublishOptions{MaxSize: 2048}, fw.Chck)
+		if err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+		contents[published.UUID] = content
+	}
+
+	fetch := func(uri string, options *NetFetchOptions) []byte {
+		t.Helper()
+		report, err := fw.Net.FetchWithChibits(MethodGet, uri, false, false, nil, nil, nil, Ptr("chibit.local"), nil, options, nil, fw.Chck, nil)
+		if err != nil {
+			t.Fatalf("fetch of %s failed: %v", uri, err)
+		}
+		return report.GetNonStreamBytes()
+	}
+
+	// --- Plain path and file:// repos ---
+	fileRepo := (&url.URL{Scheme: "file", Path: filepath.ToSlash(repo)}).String()
+	for uuid, content := range contents {
+		for _, r := range []string{repo, fileRepo} {
+			if got := fetch("chibit:"+uuid+"@"+r, nil); !bytes.Equal(got, content) {
+				t.Errorf("content from %s mismatch", r)
+			}
+		}
+	}
+
+	// --- Batch ---
+	uuids := []string{"00000000-0000-4000-8000-000000000000"}
+	for uuid := range contents {
+		uuids = append(uuids, uuid)
+	}
+	entries, err := fw.Net.FetchChibitUUIDs(uuids, nil, nil, nil, nil, repo, nil)
+	if len(entries) != len(contents) {
+		t.Errorf("expected %d resolved entries, got %d", len(contents), len(entries))
+	}
+	if err == nil || !strings.Contains(err.Error(), uuids[0]) {
+		t.Errorf("expected the unknown uuid to be reported, got: %v", err)
+	}
+
+	// --- Index cache over http ---
+	var mu sync.Mutex
+	indexStatus := []int{}
+	files := http.FileServer(http.Dir(repo))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chibits/chibits.json" {
+			files.ServeHTTP(w, r)
+			return
+		}
+		content, _ := os.ReadFile(filepath.Join(repo, "chibits", "chibits.json"))
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256(content))
+		status := http.StatusOK
+		if r.Header.Get("If-None-Match") == etag {
+			status = http.StatusNotModified
+		}
+		mu.Lock()
+		indexStatus = append(indexStatus, status)
+		mu.Unlock()
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			w.Write(content)
+		}
+	}))
+	defer server.Close()
+
+	options := (&NetFetchOptions{}).Default()
+	options.ChibitIndexMaxAge = 0
+	var uuid string
+	for uuid = range contents {
+		break
+	}
+	uri := "chibit:" + uuid + "@" + server.URL
+	fetch(uri, options)
+	if got := fetch(uri, options); !bytes.Equal(got, contents[uuid]) {
+		t.Errorf("content from a revalidated index mismatch")
+	}
+	options.ChibitIndexMaxAge = 60000
+	fetch(uri, options)
+	fw.Net.ClearChibitIndexCache()
+	fetch(uri, options)
+
+	// Fetched, revalidated, served from the cache without a request, fetched again after clearing
+	if fmt.Sprint(indexStatus) != fmt.Sprint([]int{http.StatusOK, http.StatusNotModified, http.StatusOK}) {
+		t.Errorf("unexpected index requests: %v", indexStatus)
+	}
+}
+
+func TestChibitURIReposAndFallbacks(t *testing.T) {
+	repo := t.TempDir()
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	content := []byte(strings.Repeat("second repo ", 500))
+	file := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(file, content, 0644)
+	published, err := PublishChibit(repo, file, ChibitPublishOptions{MaxSize: 2048}, fw.Chck)
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+
+	fallbackHits := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallbackHits = append(fallbackHits, r.URL.Path)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("fallback"))
+	}))
+	defer server.Close()
+
+	fetch := func(uri ChibitURI) ([]byte, error) {
+		report, err := fw.Net.FetchWithChibits(MethodGet, uri.String(), false, false, nil, nil, nil, Ptr("chibit.uri"), nil, nil, nil, fw.Chck, nil)
+		if err != nil {
+			return nil, err
+		}
+		return report.GetNonStreamBytes(), nil
+	}
+
+	// The first repo does not have the uuid, the second does
+	got, err := fetch(ChibitURI{UUID: published.UUID, Repos: []string{t.TempDir(), repo}, Fallbacks: []string{server.URL + "/ok"}})
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("expected the content from the second repo, got %q (%v)", got, err)
+	}
+	if len(fallbackHits) != 0 {
+		t.Errorf("fallbacks should not be used when a repo resolves, got %v", fallbackHits)
+	}
+
+	// No repo has it, the broken fallback is skipped
+	got, err = fetch(ChibitURI{UUID: published.UUID, Repos: []string{t.TempDir()}, Fallbacks: []string{server.URL + "/broken", server.URL + "/ok"}})
+	if err != nil || string(got) != "fallback" {
+		t.Errorf("expected the second fallback, got %q (%v)", got, err)
+	}
+	if fmt.Sprint(fallbackHits) != "[/broken /ok]" {
+		t.Errorf("expected the fallbacks to be tried in order, got %v", fallbackHits)
+	}
+
+	// A missing repo is an error instead of a nil dereference
+	if _, err := fetch(ChibitURI{UUID: published.UUID}); err == nil {
+		t.Errorf("expected an error without any repo")
+	}
+	if _, err := fw.Net.FetchWithChibits(MethodGet, "chibit:not-a-uuid@"+repo, false, false, nil, nil, nil, nil, nil, nil, nil, fw.Chck, nil); !errors.Is(err, ErrInvalidChibitURI) {
+		t.Errorf("expected ErrInvalidChibitURI, got %v", err)
+	}
+}
+
+func TestChibitDetachedSignatures(t *testing.T) {
+	fw := SetupFramework((&NetFetchOptions{}).Default())
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(pub)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	otherDER, _ := x509.MarshalPKIXPublicKey(otherPub)
+	keyOptions := func(der []byte, strict bool) *NetFetchOptions {
+		options := (&NetFetchOptions{}).Default()
+		options.ChibitTrustedKeys = []ChibitTrustedKey{{ID: "release", PublicKeyPEM: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})}}
+		options.ChibitRequireSignatures = strict
+		return options
+	}
+	trusted := keyOptions(pubDER, true)
+	signer := func(data []byte) ([]byte, error) { return ed25519.Sign(priv, data), nil }
+
+	content := []byte(strings.Repeat("signed ", 1000))
+	file := filepath.Join(t.TempDir(), "file.bin")
+	os.WriteFile(file, content, 0644)
+
+	fetch := func(uri string, options *NetFetchOptions) error {
+		t.Helper()
+		report, err := fw.Net.FetchWithChibits(MethodGet, uri, false, false, nil, nil, nil, Ptr("chibit.signatures"), nil, options, nil, fw.Chck, nil)
+		if err == nil && !bytes.Equal(report.GetNonStreamBytes(), content) {
+			t.Errorf("%s: content mismatch", uri)
+		}
+		return err
+	}
+
+	// --- Signed repo ---
+	signedRepo := t.TempDir()
+	var published []*ChibitPublished
+	for _, options := range []ChibitPublishOptions{
+		{Version: "1.0", MaxSize: 3000},
+		{MaxSize: 3000, Detached: true},
+		{MaxSize: 3000},
+	} {
+		options.SignatureAlgorithm = ED25519
+		options.SignatureKeyID = "release"
+		options.Signer = signer
+		p, err := PublishChibit(signedRepo, file, options, fw.Chck)
+		if err != nil {
+			t.Fatalf("publish failed: %v", err)
+		}
+		published = append(published, p)
+	}
+	if _, err := os.Stat(published[1].EntryPath + ".sig"); err != nil {
+		t.Errorf("expected a detached entry signature: %v", err)
+	}
+	if _, err := os.Stat(published[2].EntryPath + ".sig"); err == nil {
+		t.Errorf("expected the V2 entry to embed its signature")
+	}
+	for _, p := range published {
+		if err := fetch(p.URI+"@"+signedRepo, trusted); err != nil {
+			t.Errorf("%s: strict fetch failed: %v", p.EntryPath, err)
+		}
+		if err := fetch(p.URI+"@"+signedRepo, keyOptions(otherDER, false)); !errors.Is(err, ErrChibitVerification) {
+			t.Errorf("%s: expected an untrusted key to fail verification, got %v", p.EntryPath, err)
+		}
+	}
+
+	// An unsigned publish would invalidate the index signature
+	if _, err := PublishChibit(signedRepo, file, ChibitPublishOptions{}, fw.Chck); err == nil {
+		t.Errorf("expected publishing without a signer into a signed repo to fail")
+	}
+
+	// --- Tampering ---
+	entry, _ := os.ReadFile(published[0].EntryPath)
+	os.WriteFile(published[0].EntryPath, append(entry, ' '), 0644)
+	if err := fetch(published[0].URI+"@"+signedRepo, trusted); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected a modified entry to fail verification, got %v", err)
+	}
+	os.WriteFile(published[0].EntryPath, entry, 0644)
+
+	indexPath := filepath.Join(signedRepo, "chibits", "chibits.json")
+	index, _ := os.ReadFile(indexPath)
+	os.WriteFile(indexPath, append(index, '\n'), 0644)
+	fw.Net.ClearChibitIndexCache()
+	if err := fetch(published[1].URI+"@"+signedRepo, trusted); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected a modified index to fail verification, got %v", err)
+	}
+
+	// --- Unsigned index ---
+	os.WriteFile(indexPath, index, 0644)
+	os.Remove(indexPath + ".sig")
+	fw.Net.ClearChibitIndexCache()
+	if err := fetch(published[1].URI+"@"+signedRepo, trusted); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected strict mode to reject an unsigned index, got %v", err)
+	}
+	if err := fetch(published[1].URI+"@"+signedRepo, keyOptions(pubDER, false)); err != nil {
+		t.Errorf("expected a signed entry in an unsigned index to pass outside strict mode, got %v", err)
+	}
+
+	// A signed entry served under another uuid
+	swapped := strings.ReplaceAll(string(index), filepath.Base(published[0].EntryPath), filepath.Base(published[2].EntryPath))
+	if swapped == string(index) {
+		t.Fatalf("the index does not list %s", filepath.Base(published[0].EntryPath))
+	}
+	os.WriteFile(indexPath, []byte(swapped), 0644)
+	fw.Net.ClearChibitIndexCache()
+	if err := fetch(published[0].URI+"@"+signedRepo, keyOptions(pubDER, false)); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected an entry served under another uuid to fail verification, got %v", err)
+	}
+
+	// --- Unsigned repo ---
+	unsignedRepo := t.TempDir()
+	p, err := PublishChibit(unsignedRepo, file, ChibitPublishOptions{}, fw.Chck)
+	if err != nil {
+		t.Fatalf("publish failed: %v", err)
+	}
+	if err := fetch(p.URI+"@"+unsignedRepo, trusted); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected strict mode to reject an unsigned entry, got %v", err)
+	}
+	if err := fetch(p.URI+"@"+unsignedRepo, keyOptions(pubDER, false)); err != nil {
+		t.Errorf("expected an unsigned entry to pass outside strict mode, got %v", err)
+	}
+	strictNoKeys := (&NetFetchOptions{}).Default()
+	strictNoKeys.ChibitRequireSignatures = true
+	if err := fetch(p.URI+"@"+unsignedRepo, strictNoKeys); !errors.Is(err, ErrChibitVerification) {
+		t.Errorf("expected strict mode without trusted keys to fail, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+// Publishes files as chibits into a local repo directory, serve the directory with any static server
+//
+//	fwchibit -repo ./site -max-size 100000000 pack.zip
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+
+	libgoframework "github.com/sbamboo/goframework"
+)
+
+// Loads a PKCS#8 PEM private key (ed25519, rsa or ecdsa) as a chibit signer
+func loadSigner(path string) (libgoframework.SigAlgorithm, func([]byte) ([]byte, error), error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return "", nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return libgoframework.ED25519, func(data []byte) ([]byte, error) {
+			return ed25519.Sign(k, data), nil
+		}, nil
+	case *rsa.PrivateKey:
+		return libgoframework.RSA, func(data []byte) ([]byte, error) {
+			sum := sha256.Sum256(data)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		}, nil
+	case *ecdsa.PrivateKey:
+		return libgoframework.ECDSA, func(data []byte) ([]byte, error) {
+			sum := sha256.Sum256(data)
+			return ecdsa.SignASN1(rand.Reader, k, sum[:])
+		}, nil
+	}
+	return "", nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+func main() {
+	repo := flag.String("repo", ".", "Repo directory, chibits are written to {repo}/chibits")
+	maxSize := flag.Int64("max-size", 0, "Max bytes per chunk, 0 for a single chunk")
+	uuid := flag.String("uuid", "", "UUID of the chibit, empty to generate one")
+	filename := flag.String("filename", "", "Filename recorded in the entry, empty for the base name of the file")
+	version := flag.String("version", "2.0", "chibit-version of the entry (1.0, 1.1 or 2.0)")
+	algorithm := flag.String("algorithm", "sha256", "Whole-file checksum algorithm (crc32, sha1 or sha256)")
+	compression := flag.String("compression", "", "Compress V2 chunks with zstd or gzip")
+	baseURL := flag.String("base-url", "", "Public URL of the repo, makes the urls in the index and entry absolute")
+	signKey := flag.String("sign-key", "", "PKCS#8 PEM private key (ed25519, rsa or ecdsa) to sign the entries and the index with")
+	keyID := flag.String("key-id", "", "key-id recorded with the signature")
+	detached := flag.Bool("detached", false, "Sign V2 entries with a detached {entry}.sig instead of embedding the signature")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [options] <file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*uuid != "" && flag.NArg() > 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := libgoframework.ChibitPublishOptions{
+		UUID:           *uuid,
+		Filename:       *filename,
+		MaxSize:        *maxSize,
+		Version:        libgoframework.ChibitVersionId(*version),
+		Algorithm:      libgoframework.HashAlgorithm(*algorithm),
+		Compression:    *compression,
+		BaseURL:        *baseURL,
+		SignatureKeyID: *keyID,
+		Detached:       *detached,
+	}
+	if *signKey != "" {
+		algo, signer, err := loadSigner(*signKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to load signing key:", err)
+			os.Exit(1)
+		}
+		options.SignatureAlgorithm = algo
+		options.Signer = signer
+	}
+
+	fw := libgoframework.NewFramework(&libgoframework.FrameworkConfig{
+		NetFetchOptions: (&libgoframework.NetFetchOptions{}).Default(),
+	})
+
+	for _, file := range flag.Args() {
+		fileOptions := options
+		if flag.NArg() > 1 {
+			fileOptions.Filename = ""
+		}
+		published, err := libgoframework.PublishChibit(*repo, file, fileOptions, fw.Chck)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to publish %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\t%s\t%d chunks\n", file, published.URI, len(published.ChunkPaths))
+	}
+}
@@ -2,9 +2,11 @@ package goframework_common
 
 import (
 	"context"
+	"hash"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -34,30 +36,49 @@ func Ptr[T any](v T) *T { return &v }
 
 type FrameworkIndexHandler map[string]int
 
-func (indh *FrameworkIndexHandler) GetIndex(ctx string) int {
+// Guards every FrameworkIndexHandler since events (ex. parallel chibit chunks) are created from multiple goroutines
+var frameworkIndexesMutex sync.Mutex
+
+func (indh *FrameworkIndexHandler) getIndex(ctx string) int {
 	if ind, ok := (*indh)[ctx]; ok {
 		return ind
 	}
 	return -1 // Not found
 }
-func (indh *FrameworkIndexHandler) IncrIndex(ctx string) {
+func (indh *FrameworkIndexHandler) incrIndex(ctx string) {
 	if ind, ok := (*indh)[ctx]; ok {
 		(*indh)[ctx] = ind + 1
 	} else {
 		(*indh)[ctx] = 0
 	}
 }
+func (indh *FrameworkIndexHandler) GetIndex(ctx string) int {
+	frameworkIndexesMutex.Lock()
+	defer frameworkIndexesMutex.Unlock()
+	return indh.getIndex(ctx)
+}
+func (indh *FrameworkIndexHandler) IncrIndex(ctx string) {
+	frameworkIndexesMutex.Lock()
+	defer frameworkIndexesMutex.Unlock()
+	indh.incrIndex(ctx)
+}
 func (indh *FrameworkIndexHandler) ResetIndex(ctx string) {
+	frameworkIndexesMutex.Lock()
+	defer frameworkIndexesMutex.Unlock()
 	(*indh)[ctx] = 0
 }
 func (indh *FrameworkIndexHandler) ResetAll() {
+	frameworkIndexesMutex.Lock()
+	defer frameworkIndexesMutex.Unlock()
 	for k := range *indh {
 		(*indh)[k] = 0
 	}
 }
 func (indh *FrameworkIndexHandler) GetNewOfIndex(ctx string) int {
-	indh.IncrIndex(ctx)
-	return indh.GetIndex(ctx)
+	frameworkIndexesMutex.Lock()
+	defer frameworkIndexesMutex.Unlock()
+	indh.incrIndex(ctx)
+	return indh.getIndex(ctx)
 }
 
 var FrameworkIndexes = FrameworkIndexHandler {
@@ -74,13 +95,21 @@ const (
 
 type FrameworkFlagHandler map[FrameworkFlag]bool
 
+var frameworkFlagsMutex sync.RWMutex // Flags are toggled from background goroutines (ex. the update auto check)
+
 func (flagh *FrameworkFlagHandler) Enable(flag FrameworkFlag) {
+	frameworkFlagsMutex.Lock()
+	defer frameworkFlagsMutex.Unlock()
 	(*flagh)[flag] = true
 }
 func (flagh *FrameworkFlagHandler) Disable(flag FrameworkFlag) {
+	frameworkFlagsMutex.Lock()
+	defer frameworkFlagsMutex.Unlock()
 	(*flagh)[flag] = false
 }
 func (flagh *FrameworkFlagHandler) IsEnabled(flag FrameworkFlag) bool {
+	frameworkFlagsMutex.RLock()
+	defer frameworkFlagsMutex.RUnlock()
 	if enabled, ok := (*flagh)[flag]; ok {
 		return enabled
 	}
@@ -179,8 +208,11 @@ type NetworkEvent struct {
 	RespHeaders *http.Header `json:"resp_headers,omitempty"`
 
 	// Status
-	Transferred int64 `json:"transferred"`
-	Size        int64 `json:"size"`
+	Transferred        int64  `json:"transferred"`         // Bytes transferred, follows the wire bytes so it is comparable to Size
+	Size               int64  `json:"size"`
+	WireTransferred    int64  `json:"wire_transferred"`    // Bytes read off the wire (before content decoding)
+	DecodedTransferred int64  `json:"decoded_transferred"` // Bytes delivered to the reader (after content decoding)
+	ContentEncoding    string `json:"content_encoding,omitempty"` // The Content-Encoding that was decoded, empty if the body was not decoded
 
 	// Event
 	EventState       NetState `json:"event_state"`
@@ -189,6 +221,18 @@ type NetworkEvent struct {
 	EventStepMax     *int     `json:"event_step_max,omitempty"`
 	EventStepMode    EventStepMode `json:"event_step_mode"`
 	Interrupted      bool `json:"interrupted"`
+
+	// Prefix handler hops that lead to this event, in order (the last hop's EventID is this events parent)
+	HandlerChain []PrefixHandlerHop `json:"handler_chain,omitempty"`
+	OriginalRemote string `json:"original_remote,omitempty"` // The URL before a rewrite handler changed it into Remote
+	RewrittenBy    string `json:"rewritten_by,omitempty"`    // Name of the rewrite handler that changed the URL
+}
+
+type PrefixHandlerHop struct {
+	Handler string `json:"handler"`  // Name of the prefix handler that matched
+	From    string `json:"from"`     // The response URL the handler matched on
+	To      string `json:"to"`       // The URL the handler resolved
+	EventID string `json:"event_id"` // The (interrupted) event of the fetch the handler matched on
 }
 
 func (ev *NetworkEvent) CalcStep() {
@@ -264,8 +308,58 @@ type UpdatorAppConfiguration struct {
 	GithubUpMetaRepo *string
 	Target           string
 	GhMetaFetcher    GithubUpdateFetcherInterface // Auto Filled
+
+	ExecutablePath *string // The binary updates replace, nil for os.Executable()
+	StateDir       *string // Where the previous binary and the pending-update marker are kept, nil for ".{exe}.update" beside the executable
+	ConfigDir      *string // Where the installation ID is kept, nil for "{exe name}" in os.UserConfigDir() (the state dir if there is none)
+	HealthLaunches int     // Launches an applied update gets to call ConfirmUpdate before CheckPendingUpdate rolls it back, <=0 for 3
+	HealthTimeout  int     // Seconds after its first launch an applied update has to call ConfirmUpdate, <=0 for no limit
+	AllowDowngrade bool    // Let GetLatestVersion pick releases older than the running build
+
+	RequireSignedManifest bool // Refuse a deploy.json not signed by a trusted key (PublicKeyPEM, TrustedKeys), once a signed one was accepted unsigned ones are refused anyway
+
+	TrustedKeys []UpdateTrustedKey // Keys trusted alongside PublicKeyPEM, deploy.json can rotate in more
+	RevokedKeys []string           // IDs of keys never to trust, ex. ones known to be compromised when the build was made
+
+	SigAlgorithm SigAlgorithm // Algorithm of PublicKeyPEM, empty to go by the key type (ECDSA, Ed25519 or RSA with PKCS#1 v1.5 or PSS)
+
+	Progressor UpdateProgressFn // Called for every phase of an update check, download or apply, nil for none
 }
 
+// A public key updates and deploy.json may be signed with, ID matches the "key_id" of a signature.
+// Without an ID the key is known by its fingerprint, see goframework_update.UpdateKeyID.
+type UpdateTrustedKey struct {
+	ID           string
+	Algorithm    SigAlgorithm // Empty to go by the key type
+	PublicKeyPEM []byte
+}
+
+type UpdatePhase string
+
+const (
+	UpdatePhaseChecking    UpdatePhase = "checking"
+	UpdatePhaseDownloading UpdatePhase = "downloading"
+	UpdatePhaseVerifying   UpdatePhase = "verifying"
+	UpdatePhasePatching    UpdatePhase = "patching"
+	UpdatePhaseApplying    UpdatePhase = "applying"
+	UpdatePhaseDone        UpdatePhase = "done"
+	UpdatePhaseFailed      UpdatePhase = "failed"
+)
+
+// The state of an update operation, sent to UpdatorAppConfiguration.Progressor and the debugger (update:progress)
+type UpdateProgress struct {
+	ID          string      `json:"id"`        // Stays the same through all phases of one operation, also the ID of its parent NetworkEvent
+	Operation   string      `json:"operation"` // "check", "update", "download", "apply" or "list"
+	Phase       UpdatePhase `json:"phase"`
+	UIND        int         `json:"uind,omitempty"` // The release, once it is known
+	Semver      string      `json:"semver,omitempty"`
+	Transferred int64       `json:"transferred"` // Bytes downloaded so far
+	Size        int64       `json:"size"`        // Bytes to download, -1 if unknown
+	Error       string      `json:"error,omitempty"`
+}
+
+type UpdateProgressFn func(progress UpdateProgress)
+
 type UpdateReleaseData struct {
 	Tag      string        `json:"tag"`
 	Notes    string        `json:"notes"`
@@ -281,6 +375,11 @@ type UpdateUpMeta struct {
 	Semver    string                      `yaml:"semver" json:"semver"`
 	Channel   string                      `yaml:"channel" json:"channel"`
 	Sources   map[string]UpdateSourceInfo `yaml:"sources" json:"sources"`
+
+	// Version constraints, see NetUpReleaseInfo
+	MinVersion            *string `yaml:"min_version,omitempty" json:"min_version,omitempty"`
+	MaxVersion            *string `yaml:"max_version,omitempty" json:"max_version,omitempty"`
+	RequiresSteppingStone bool    `yaml:"requires_stepping_stone,omitempty" json:"requires_stepping_stone,omitempty"`
 }
 
 // SourceInfo holds details about a specific update source (e.g., a binary for a platform-arch).
@@ -289,7 +388,8 @@ type UpdateUpMeta struct {
 type UpdateSourceInfo struct {
 	URL               string  `yaml:"url,omitempty" json:"url"`
 	Checksum          string  `yaml:"checksum" json:"checksum"`
-	Signature         *string `yaml:"signature" json:"signature"` // Pointer to allow omitempty/null
+	Signature         *string `yaml:"signature" json:"signature"`               // Pointer to allow omitempty/null
+	KeyID             *string `yaml:"key_id,omitempty" json:"key_id,omitempty"` // The trusted key the signatures were made with, nil to try every trusted key
 	SignatureURL      *string `yaml:"-"`
 	IsPatch           bool    `yaml:"is_patch" json:"is_patch"`
 	PatchFor          *int    `yaml:"patch_for" json:"patch_for"`
@@ -331,7 +431,9 @@ type SigAlgorithm string
 
 const (
 	ED25519 SigAlgorithm = "ed25519"
-	RSA     SigAlgorithm = "rsa"
+	RSA     SigAlgorithm = "rsa" // PKCS#1 v1.5
+	RSA_PSS SigAlgorithm = "rsa-pss"
+	ECDSA   SigAlgorithm = "ecdsa" // ASN.1 encoded
 )
 
 // PLATFORM DESCRIPTORS
@@ -487,11 +589,54 @@ type ResponsePrefixHandler struct {
     PrefixLen int
     Validator func(prefix []byte, respUrl string) bool
     Parser    func(fullBody []byte, respUrl string) (newURL string, err error)
+	EventParser func(fullBody []byte, respUrl string, eventID string) (newURL string, err error) // Used instead of Parser when set, for parsers that fetch on their own: eventID is the matched event, the parent of their fetches
 	ContentTypeContains string
 	NeedsContent bool
 	FilterForUrls []string
 }
 
+// Rewrites a request URL before it is sent (ex. dropbox dl=0 -> dl=1), saving the round-trip a ResponsePrefixHandler would need
+type RequestRewriteHandler struct {
+	Name          string
+	FilterForUrls []string
+	Rewriter      func(reqUrl string) (newURL string, ok bool)
+}
+
+// Declarative form of a ResponsePrefixHandler, loadable from JSON/YAML and compiled by the NetHandler
+// Templates (URL and Query values) expand "{url}" to the response URL and "{<name>}" to the extracted values
+type PrefixHandlerSpec struct {
+	Name                string                     `json:"name" yaml:"name"`
+	PrefixLen           int                        `json:"prefix_len" yaml:"prefix_len"`
+	ContentTypeContains string                     `json:"content_type_contains,omitempty" yaml:"content_type_contains,omitempty"`
+	NeedsContent        bool                       `json:"needs_content" yaml:"needs_content"`
+	FilterForUrls       []string                   `json:"filter_for_urls,omitempty" yaml:"filter_for_urls,omitempty"`
+	Match               PrefixHandlerMatchSpec     `json:"match" yaml:"match"`                         // All set rules must match for the handler to apply
+	Extract             []PrefixHandlerExtractSpec `json:"extract,omitempty" yaml:"extract,omitempty"` // Evaluated in order, later rules can't reference earlier ones
+	URL                 string                     `json:"url,omitempty" yaml:"url,omitempty"`         // Template for the next URL, defaults to "{url}"
+	Query               map[string]string          `json:"query,omitempty" yaml:"query,omitempty"`     // Query parameter templates set on the next URL, parameters expanding to "" are skipped
+	RequireQuery        bool                       `json:"require_query,omitempty" yaml:"require_query,omitempty"` // Fail if none of the Query parameters expanded to a value
+}
+
+type PrefixHandlerMatchSpec struct {
+	PrefixContains []string `json:"prefix_contains,omitempty" yaml:"prefix_contains,omitempty"` // Strings that must all be in the prefix
+	PrefixRegex    string   `json:"prefix_regex,omitempty" yaml:"prefix_regex,omitempty"`
+	UrlPrefix      string   `json:"url_prefix,omitempty" yaml:"url_prefix,omitempty"`
+	UrlContains    []string `json:"url_contains,omitempty" yaml:"url_contains,omitempty"` // Strings that must all be in the response URL
+	UrlRegex       string   `json:"url_regex,omitempty" yaml:"url_regex,omitempty"`
+}
+
+// Extracts a named value from the body or response URL, either by Regex (first capture group, or the whole match) or by ExtractBetween(Start, End)
+type PrefixHandlerExtractSpec struct {
+	Name     string `json:"name" yaml:"name"`
+	From     string `json:"from,omitempty" yaml:"from,omitempty"` // "body" (default) or "url"
+	Regex    string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	Start    string `json:"start,omitempty" yaml:"start,omitempty"`
+	End      string `json:"end,omitempty" yaml:"end,omitempty"`
+	Trim     string `json:"trim,omitempty" yaml:"trim,omitempty"`         // Cutset trimmed from both ends of the value
+	Unescape bool   `json:"unescape,omitempty" yaml:"unescape,omitempty"` // HTML-unescape the value (ex. "&amp;" -> "&")
+	Optional bool   `json:"optional,omitempty" yaml:"optional,omitempty"` // Expand to "" instead of failing when not found
+}
+
 //MARK: Interfaces
 
 type DebuggerInterface interface {
@@ -509,11 +654,15 @@ type DebuggerInterface interface {
 	NetStop(string) error
 	NetStopEvent(NetworkEvent) error    // Wrapper for NetStop taking FwNetworkEvent.ID
 	NetStopWFUpdate(NetworkEvent) error // Similar to sending both .NetUpdateFull and .NetStop
-
+	// FwUpdate
+	UpdateProgress(UpdateProgress) error
 }
 
 type FetcherInterface interface {
 	RegisterPrefixHandler(h ResponsePrefixHandler)
+	RegisterRewriteHandler(h RequestRewriteHandler)
+	RegisterPrefixHandlerSpec(spec PrefixHandlerSpec) error
+	LoadPrefixHandlers(data []byte) ([]string, error)
 
 	FetchWithoutHandlers(method HttpMethod, url string, stream bool, file bool, fileout *string, progressor ProgressorFn, body io.Reader, contextID *string, initiator *ElementIdentifier, options *NetFetchOptions, parentID *string) (NetworkProgressReportInterface, error)
 	Fetch(method HttpMethod, url string, stream bool, file bool, fileout *string, progressor ProgressorFn, body io.Reader, contextID *string, initiator *ElementIdentifier, options *NetFetchOptions, parentID *string) (NetworkProgressReportInterface, error)
@@ -569,11 +718,16 @@ type ChckInterface interface {
 	SigBuff(buf []byte, algo SigAlgorithm, pubKeyPEM []byte, signature []byte) bool
 	SigStr(content string, algo SigAlgorithm, pubKeyPEM []byte, signature []byte) bool
 	GuessAlgo(sum string) HashAlgorithm
+	NewHasher(algo HashAlgorithm) (hash.Hash, error)
+	HashSum(h hash.Hash, algo HashAlgorithm) string
 }
 
+// Fetches url for a GithubUpdateFetcherInterface, the updater passes one that hangs the fetch under its operation event
+type GithubReleasesFetchFn func(url string) (NetworkProgressReportInterface, error)
+
 type GithubUpdateFetcherInterface interface {
-	FetchUpMetaReleases() ([]UpdateReleaseData, error)
-	FetchAssetReleases() ([]UpdateReleaseData, error)
+	FetchUpMetaReleases(fetch GithubReleasesFetchFn) ([]UpdateReleaseData, error) // nil fetch for a plain GET
+	FetchAssetReleases(fetch GithubReleasesFetchFn) ([]UpdateReleaseData, error)
 	//parseAssetReleaseForMeta(tagName string) (*UpdateUpMeta, error)
 	//fetchReleases() ([]GithubReleaseAssets, error)
 	//fetchFileContent(url string) (string, error)
@@ -598,6 +752,11 @@ type NetFetchOptions struct {
 	Headers               *http.Header     `json:"headers,omitempty"`         // nil to not override
 	Client                *http.Client     `json:"_go_http_client,omitempty"` // nil to not override
 	InsecureSkipVerify    bool             `json:"insecure_skip_verify"`
+	PinnedSPKI            map[string][]string `json:"pinned_spki,omitempty"`       // host -> base64(sha256(SPKI)) pins, "*.example.com" matches subdomains, a mismatch fails the fetch with net.ErrCertificatePinMismatch
+	RootCAsPEM            []byte           `json:"root_cas_pem,omitempty"`    // Custom root CA bundle (PEM), replaces the system pool unless RootCAsAppendSystem
+	RootCAsAppendSystem   bool             `json:"root_cas_append_system"`    // Append RootCAsPEM to the system pool instead of replacing it
+	ClientCertPEM         []byte           `json:"-"`                         // Client certificate for mTLS (PEM), requires ClientKeyPEM
+	ClientKeyPEM          []byte           `json:"-"`                         // Client private key for mTLS (PEM), always omitted from JSON
 	Timeout               time.Duration    `json:"duration"` // Negative numbers mean no timeout
 	Context               *context.Context `json:"_go_http_context,omitempty"`
 	RetryTimeouts         int              `json:"retry_timeouts"`          // The number of times to retry a connection when it timeouts, 0 or less to not
@@ -607,48 +766,95 @@ type NetFetchOptions struct {
 	AutoReadEOFClose      bool             `json:"auto_read_eof_close"`     // NetProgressReport automatically calls .Close when .Read reaches EOF, usefull for streams
 	EventStepMax          *int             `json:"event_step_max"`          // If not nil this will enable stepping
 	EventStepMode         EventStepMode    `json:"event_step_mode"`         // "auto" or "manual", in auto the step is calculated by transferred/size
+	DecodeContent         bool             `json:"decode_content"`          // Negotiate Accept-Encoding and decode Content-Encoding (gzip, deflate, br, zstd) explicitly, tracking wire and decoded bytes separately
 
 	ProgressorInterval int `json:"progressor_interval"` // How often do we update progressor during transfer (ms, -1 = always)
 	DebuggerInterval   int `json:"debugger_interval"`   // How often do we update debugger during transfer (ms, -1 = always) (only matters if built with debugging)
 
+	ChibitTrustedKeys     []ChibitTrustedKey `json:"-"` // Keys signed chibit metadata is verified against, signatures are not verified when empty
+	ChibitRequireSignatures bool `json:"chibit_require_signatures"` // Reject chibit entries and indexes without a signature verified against ChibitTrustedKeys
+	ChibitConcurrency     int `json:"chibit_concurrency"`   // How many chibit chunks are fetched at once (each held in memory whole until its turn, so up to this many chunks at a time), chunks are still written in order, <=1 streams one chunk at a time
+	ChibitChunkRetries    int `json:"chibit_chunk_retries"` // How many more rounds over a chibit chunk's sources are made when all of them failed, 0 or less to not
+	ChibitIndexMaxAge     int `json:"chibit_index_max_age"` // How long a cached chibit repo index is used without asking the repo (ms), 0 to always revalidate it, -1 to not cache
+	ChibitRedirectSchemes []string `json:"chibit_redirect_schemes"` // Schemes chibit entry, chunk and redirect urls (and HTTP redirects while fetching them) may use, empty for those of the index/entry or a stronger one (https stays https, only file:// entries may redirect to file://)
+	ChibitRedirectHosts   []string `json:"chibit_redirect_hosts"`   // Hosts chibit entry, chunk and redirect urls may point to ("example.com" or "*.example.com" for subdomains), empty for any
 	EnabledPrefixHandlers []string // Enabled prefix handlers
+	EnabledRewriteHandlers []string // Enabled rewrite handlers, these run in Fetch before the request is sent
+	PrefixHandlerMaxDepth int      `json:"prefix_handler_max_depth"` // How many prefix handler hops Fetch follows (ex. dropbox -> gdrive warning), <=0 is treated as 1
+}
+
+// A public key chibit metadata signatures are verified against, ID matches the "key-id" of a signature (empty matches any)
+type ChibitTrustedKey struct {
+	ID           string
+	Algorithm    SigAlgorithm // Empty to allow any algorithm
+	PublicKeyPEM []byte
 }
 
-// Default all values to a sensible empty: BuffSize=32k, SizeOvr:No, Headers:UseDefault, Client:UseBuiltin, InsecureSkipVerify:false, Timeout:No, Context:No, RetryTimeouts:No, DialTimeout:No, EventStepMax:nil, EventStepMode:manual, ProgressorInterval:-1, DebuggerInterval:-1
+// Default all values to a sensible empty: BuffSize=32k, SizeOvr:No, Headers:UseDefault, Client:UseBuiltin, InsecureSkipVerify:false, Pins/CAs/ClientCert:No, Timeout:No, Context:No, RetryTimeouts:No, DialTimeout:No, EventStepMax:nil, EventStepMode:manual, DecodeContent:false, ProgressorInterval:-1, DebuggerInterval:-1, ChibitTrustedKeys:None, ChibitRequireSignatures:false, ChibitConcurrency:1, ChibitChunkRetries:No, ChibitIndexMaxAge:-1, ChibitRedirectSchemes:EntryOrStronger, ChibitRedirectHosts:Any, EnabledPrefixHandlers:None, EnabledRewriteHandlers:None, PrefixHandlerMaxDepth:1
 func (op *NetFetchOptions) Empty() *NetFetchOptions {
 	op.BufferSize = 32 * 1024
 	op.TotalSizeOverride = -2
 	op.Headers = nil
 	op.Client = nil
 	op.InsecureSkipVerify = false
+	op.PinnedSPKI = nil
+	op.RootCAsPEM = nil
+	op.RootCAsAppendSystem = false
+	op.ClientCertPEM = nil
+	op.ClientKeyPEM = nil
 	op.Timeout = -1
 	op.Context = nil
 	op.RetryTimeouts = -1
 	op.DialTimeout = -1
 	op.EventStepMax = nil
 	op.EventStepMode = EventStepManual
+	op.DecodeContent = false
 	op.ProgressorInterval = -1
 	op.DebuggerInterval = -1
+	op.ChibitTrustedKeys = nil
+	op.ChibitRequireSignatures = false
+	op.ChibitConcurrency = 1
+	op.ChibitChunkRetries = 0
+	op.ChibitIndexMaxAge = -1
+	op.ChibitRedirectSchemes = nil
+	op.ChibitRedirectHosts = nil
 	op.EnabledPrefixHandlers = []string{}
+	op.EnabledRewriteHandlers = []string{}
+	op.PrefixHandlerMaxDepth = 1
 	return op
 }
 
-// Defaults all values to sensible defaults: BuffSize=32k, SizeOvr:No, Headers:UseDefault, Client:UseBuiltin, InsecureSkipVerify:false, Timeout:30s, Context:No, RetryTimeouts:2, DialTimeout:5s, EventStepMax:nil, EventStepMode:auto, ProgressorInterval:-1, DebuggerInterval:-1
+// Defaults all values to sensible defaults: BuffSize=32k, SizeOvr:No, Headers:UseDefault, Client:UseBuiltin, InsecureSkipVerify:false, Pins/CAs/ClientCert:No, Timeout:30s, Context:No, RetryTimeouts:2, DialTimeout:5s, EventStepMax:nil, EventStepMode:auto, DecodeContent:true, ProgressorInterval:-1, DebuggerInterval:-1, ChibitTrustedKeys:None, ChibitRequireSignatures:false, ChibitConcurrency:1, ChibitChunkRetries:2, ChibitIndexMaxAge:0, ChibitRedirectSchemes:EntryOrStronger, ChibitRedirectHosts:Any, EnabledPrefixHandlers:All builtin, EnabledRewriteHandlers:All builtin, PrefixHandlerMaxDepth:5
 func (op *NetFetchOptions) Default() *NetFetchOptions {
 	op.BufferSize = 32 * 1024
 	op.TotalSizeOverride = -2
 	op.Headers = nil
 	op.Client = nil
 	op.InsecureSkipVerify = false
+	op.PinnedSPKI = nil
+	op.RootCAsPEM = nil
+	op.RootCAsAppendSystem = false
+	op.ClientCertPEM = nil
+	op.ClientKeyPEM = nil
 	op.Timeout = 30
 	op.Context = nil
 	op.RetryTimeouts = 2
 	op.DialTimeout = 5
 	op.EventStepMax = nil
 	op.EventStepMode = EventStepAuto
+	op.DecodeContent = true
 	op.ProgressorInterval = -1
 	op.DebuggerInterval = -1
-	op.EnabledPrefixHandlers = []string{"gdrive","sprend","dropbox","mediafire"}
+	op.ChibitTrustedKeys = nil
+	op.ChibitRequireSignatures = false
+	op.ChibitConcurrency = 1 // Prefetched chunks are held in memory whole, so parallel fetches are opt-in
+	op.ChibitChunkRetries = 2
+	op.ChibitIndexMaxAge = 0
+	op.ChibitRedirectSchemes = nil
+	op.ChibitRedirectHosts = nil
+	op.EnabledPrefixHandlers = []string{"gdrive","sprend","dropbox","mediafire","onedrive","wetransfer","sourceforge","pixeldrain","githubblob","githublfs"}
+	op.EnabledRewriteHandlers = []string{"dropbox","githubblob","pixeldrain","onedrive","sprend"}
+	op.PrefixHandlerMaxDepth = 5
 	return op
 }
 
@@ -0,0 +1,156 @@
+package goframework_common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Returned (wrapped) by ParseSemVer for strings that are not SemVer 2.0
+var ErrInvalidSemVer = errors.New("invalid semantic version")
+
+// A SemVer 2.0 version, see https://semver.org
+type SemVer struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease []string // Dot separated identifiers after "-", ex. ["beta", "2"]
+	Build      []string // Dot separated identifiers after "+", ignored when comparing
+}
+
+func isSemVerNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isSemVerIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSemVer parses "MAJOR.MINOR.PATCH[-PRERELEASE][+BUILD]", a leading "v" is allowed.
+func ParseSemVer(s string) (SemVer, error) {
+	var v SemVer
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "v")
+
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build = strings.Split(rest[i+1:], ".")
+		rest = rest[:i]
+		for _, id := range v.Build {
+			if !isSemVerIdentifier(id) {
+				return SemVer{}, fmt.Errorf("%w %q: bad build metadata", ErrInvalidSemVer, s)
+			}
+		}
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		v.Prerelease = strings.Split(rest[i+1:], ".")
+		rest = rest[:i]
+		for _, id := range v.Prerelease {
+			if !isSemVerIdentifier(id) || (isSemVerNumeric(id) && len(id) > 1 && id[0] == '0') {
+				return SemVer{}, fmt.Errorf("%w %q: bad prerelease", ErrInvalidSemVer, s)
+			}
+		}
+	}
+
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return SemVer{}, fmt.Errorf("%w %q: expected MAJOR.MINOR.PATCH", ErrInvalidSemVer, s)
+	}
+	numbers := [3]*uint64{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		if !isSemVerNumeric(part) || (len(part) > 1 && part[0] == '0') {
+			return SemVer{}, fmt.Errorf("%w %q: bad version number %q", ErrInvalidSemVer, s, part)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return SemVer{}, fmt.Errorf("%w %q: %v", ErrInvalidSemVer, s, err)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Compare returns -1, 0 or 1 by SemVer 2.0 precedence, build metadata is ignored.
+func (v SemVer) Compare(o SemVer) int {
+	if c := compareUint(v.Major, o.Major); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Minor, o.Minor); c != 0 {
+		return c
+	}
+	if c := compareUint(v.Patch, o.Patch); c != 0 {
+		return c
+	}
+
+	// A prerelease has lower precedence than the release itself
+	switch {
+	case len(v.Prerelease) == 0 && len(o.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(o.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(o.Prerelease); i++ {
+		a, b := v.Prerelease[i], o.Prerelease[i]
+		aNum, bNum := isSemVerNumeric(a), isSemVerNumeric(b)
+		switch {
+		case aNum && bNum:
+			an, _ := strconv.ParseUint(a, 10, 64)
+			bn, _ := strconv.ParseUint(b, 10, 64)
+			if c := compareUint(an, bn); c != 0 {
+				return c
+			}
+		case aNum:
+			return -1 // Numeric identifiers sort before alphanumeric ones
+		case bNum:
+			return 1
+		default:
+			if c := strings.Compare(a, b); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareUint(uint64(len(v.Prerelease)), uint64(len(o.Prerelease)))
+}
+
+func (v SemVer) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	if len(v.Build) > 0 {
+		s += "+" + strings.Join(v.Build, ".")
+	}
+	return s
+}
+
+// The parsed SemVer of the running build
+func (c *UpdatorAppConfiguration) ParsedSemVer() (SemVer, error) {
+	return ParseSemVer(c.SemVer)
+}
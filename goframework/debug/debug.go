@@ -471,6 +471,14 @@ func (e *DebugEmitter) NetStopWFUpdate(netevent fwcommon.NetworkEvent) error {
 	})
 }
 
+func (e *DebugEmitter) UpdateProgress(progress fwcommon.UpdateProgress) error {
+	return e.Send(fwcommon.JSONObject{
+		"signal":     "update:progress",
+		"id":         progress.ID,
+		"properties": progress,
+	})
+}
+
 func (e *DebugEmitter) UsageStat(stats any) error {
 	return e.Send(fwcommon.JSONObject{
 		"signal": "usage:stats",
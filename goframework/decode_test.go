@@ -0,0 +1,105 @@
+package libgoframework
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestContentDecoding(t *testing.T) {
+	plain := []byte(strings.Repeat("goframework content decoding test ", 4096))
+
+	encoders := map[string]func([]byte) []byte{
+		"gzip": func(b []byte) []byte {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+			return buf.Bytes()
+		},
+		"deflate": func(b []byte) []byte {
+			var buf bytes.Buffer
+			w := zlib.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+			return buf.Bytes()
+		},
+		"br": func(b []byte) []byte {
+			var buf bytes.Buffer
+			w := brotli.NewWriter(&buf)
+			w.Write(b)
+			w.Close()
+			return buf.Bytes()
+		},
+		"zstd": func(b []byte) []byte {
+			w, _ := zstd.NewWriter(nil)
+			defer w.Close()
+			return w.EncodeAll(b, nil)
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := strings.TrimPrefix(r.URL.Path, "/")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), enc) {
+			http.Error(w, "encoding not negotiated", http.StatusBadRequest)
+			return
+		}
+		body := encoders[enc](plain)
+		w.Header().Set("Content-Encoding", enc)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	netOptions := (&NetFetchOptions{}).Default()
+	fw := SetupFramework(netOptions)
+
+	for enc, encoder := range encoders {
+		wireSize := int64(len(encoder(plain)))
+
+		// Non stream
+		report, err := fw.Net.Fetch(MethodGet, server.URL+"/"+enc, false, false, nil, nil, nil, Ptr("decode."+enc), nil, netOptions, nil)
+		if err != nil {
+			t.Fatalf("%s: fetch failed: %v", enc, err)
+		}
+		if !bytes.Equal(report.GetNonStreamBytes(), plain) {
+			t.Errorf("%s: decoded content mismatch", enc)
+		}
+		event := report.GetNetworkEvent()
+		if event.ContentEncoding != enc {
+			t.Errorf("%s: expected ContentEncoding %q, got %q", enc, enc, event.ContentEncoding)
+		}
+		if event.Size != wireSize || event.Transferred != event.Size || event.WireTransferred != wireSize {
+			t.Errorf("%s: wire accounting off, size=%d transferred=%d wire=%d expected=%d", enc, event.Size, event.Transferred, event.WireTransferred, wireSize)
+		}
+		if event.DecodedTransferred != int64(len(plain)) {
+			t.Errorf("%s: expected %d decoded bytes, got %d", enc, len(plain), event.DecodedTransferred)
+		}
+
+		// Stream
+		report, err = fw.Net.Fetch(MethodGet, server.URL+"/"+enc, true, false, nil, nil, nil, Ptr("decode.stream."+enc), nil, netOptions, nil)
+		if err != nil {
+			t.Fatalf("%s: stream fetch failed: %v", enc, err)
+		}
+		content, err := io.ReadAll(report)
+		report.Close()
+		if err != nil {
+			t.Fatalf("%s: stream read failed: %v", enc, err)
+		}
+		if !bytes.Equal(content, plain) {
+			t.Errorf("%s: streamed content mismatch", enc)
+		}
+		if report.GetNetworkEvent().Transferred != wireSize {
+			t.Errorf("%s: streamed transferred %d, expected %d", enc, report.GetNetworkEvent().Transferred, wireSize)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package libgoframework
 
 import (
+	fwarchive "github.com/sbamboo/goframework/archive"
 	fwchck "github.com/sbamboo/goframework/chck"
 	fwcommon "github.com/sbamboo/goframework/common"
 	fwdebug "github.com/sbamboo/goframework/debug"
@@ -17,6 +18,7 @@ type Framework struct {
 	Debugger *fwdebug.DebugEmitter
 	Chck     *fwchck.Chck
 	Update   *fwupdate.NetUpdater
+	Archive  *fwarchive.Archiver
 }
 
 func NewFramework(config *fwcommon.FrameworkConfig) *Framework {
@@ -24,9 +26,10 @@ func NewFramework(config *fwcommon.FrameworkConfig) *Framework {
 	log := fwlog.NewLogger(config, deb)
 	net := fwnet.NewNetHandler(config, deb, log, nil) // For now nil as the progressor(...)
 	chck := fwchck.NewChck(log)
+	archive := fwarchive.NewArchiver(log, deb)
 	var update *fwupdate.NetUpdater
 	if config.UpdatorAppConfiguration != nil {
-		update = fwupdate.NewNetUpdater(config, net, log)
+		update = fwupdate.NewNetUpdater(config, net, log, deb)
 	}
 	return &Framework{
 		Config:   config,
@@ -35,9 +38,20 @@ func NewFramework(config *fwcommon.FrameworkConfig) *Framework {
 		Debugger: deb,
 		Chck:     chck,
 		Update:   update,
+		Archive:  archive,
 	}
 }
 
+// Close shuts the framework down: stops the update scheduler, which applies an update staged for exit, and deactivates the debugger.
+func (fw *Framework) Close() error {
+	var err error
+	if fw.Update != nil {
+		err = fw.Update.StopAutoCheck()
+	}
+	fw.Debugger.Deactivate()
+	return err
+}
+
 // MARK: Exports
 var FrameworkFlags = fwcommon.FrameworkFlags
 type FrameworkFlag = fwcommon.FrameworkFlag
@@ -85,6 +99,7 @@ var NetStateEstablished = fwcommon.NetStateEstablished
 var NetStateResponded = fwcommon.NetStateResponded
 var NetStateTransfer = fwcommon.NetStateTransfer
 var NetStateFinished = fwcommon.NetStateFinished
+var NetStateFailed = fwcommon.NetStateFailed
 
 type HashAlgorithm = fwcommon.HashAlgorithm
 
@@ -97,6 +112,8 @@ type SigAlgorithm = fwcommon.SigAlgorithm
 
 var ED25519 = fwcommon.ED25519
 var RSA = fwcommon.RSA
+var RSA_PSS = fwcommon.RSA_PSS
+var ECDSA = fwcommon.ECDSA
 
 type LogLevel = fwcommon.LogLevel
 
@@ -111,5 +128,101 @@ func GetUsageStats() (*fwcommon.UsageStat, error) {
 }
 
 type ResponsePrefixHandler = fwcommon.ResponsePrefixHandler
-
-var ExtractBetween = fwcommon.ExtractBetween
\ No newline at end of file
+type PrefixHandlerSpec = fwcommon.PrefixHandlerSpec
+type PrefixHandlerMatchSpec = fwcommon.PrefixHandlerMatchSpec
+type PrefixHandlerExtractSpec = fwcommon.PrefixHandlerExtractSpec
+
+var CompilePrefixHandlerSpec = fwnet.CompilePrefixHandlerSpec
+
+type PrefixHandlerHop = fwcommon.PrefixHandlerHop
+type RequestRewriteHandler = fwcommon.RequestRewriteHandler
+
+var ErrPrefixHandlerLoop = fwnet.ErrPrefixHandlerLoop
+
+var ExtractBetween = fwcommon.ExtractBetween
+
+var ErrCertificatePinMismatch = fwnet.ErrCertificatePinMismatch
+var ErrRedirectRejected = fwnet.ErrRedirectRejected
+
+type ContentDecoderFn = fwnet.ContentDecoderFn
+
+type ArchiveFormat = fwarchive.ArchiveFormat
+type ExtractOptions = fwarchive.ExtractOptions
+
+var ArchiveFormatAuto = fwarchive.FormatAuto
+var ArchiveFormatZip = fwarchive.FormatZip
+var ArchiveFormatTar = fwarchive.FormatTar
+var ArchiveFormatTarGz = fwarchive.FormatTarGz
+var ArchiveFormatTarZst = fwarchive.FormatTarZst
+type ChibitTrustedKey = fwcommon.ChibitTrustedKey
+
+var ErrChibitVerification = fwnet.ErrChibitVerification
+var ChibitCanonicalEntry = fwnet.ChibitCanonicalEntry
+
+type ChibitVersionId = fwnet.ChibitVersionId
+type ChibitPublishOptions = fwnet.ChibitPublishOptions
+type ChibitPublished = fwnet.ChibitPublished
+
+var PublishChibit = fwnet.PublishChibit
+
+type ChibitURI = fwnet.ChibitURI
+
+var ErrInvalidChibitURI = fwnet.ErrInvalidChibitURI
+var ErrChibitRedirectRejected = fwnet.ErrChibitRedirectRejected
+var ParseChibitURI = fwnet.ParseChibitURI
+
+type NetUpReleaseInfo = fwupdate.NetUpReleaseInfo
+type UpdateSourceInfo = fwcommon.UpdateSourceInfo
+type UpdateReleaseData = fwcommon.UpdateReleaseData
+type UpdateUpMeta = fwcommon.UpdateUpMeta
+type GithubReleasesFetchFn = fwcommon.GithubReleasesFetchFn
+type PendingUpdate = fwupdate.PendingUpdate
+type UpdateRollback = fwupdate.UpdateRollback
+type AutoCheckOptions = fwupdate.AutoCheckOptions
+type AutoUpdatePolicy = fwupdate.AutoUpdatePolicy
+type QuietHours = fwupdate.QuietHours
+
+var AutoUpdateNotify = fwupdate.AutoUpdateNotify
+var AutoUpdateApplyOnExit = fwupdate.AutoUpdateApplyOnExit
+var AutoUpdateApplyImmediately = fwupdate.AutoUpdateApplyImmediately
+var ErrAutoCheckRunning = fwupdate.ErrAutoCheckRunning
+type StagedUpdate = fwupdate.StagedUpdate
+
+var ErrUpdateVerification = fwupdate.ErrUpdateVerification
+var ErrStagedUpdateStale = fwupdate.ErrStagedUpdateStale
+type UpdatePhase = fwcommon.UpdatePhase
+type UpdateProgress = fwcommon.UpdateProgress
+type UpdateProgressFn = fwcommon.UpdateProgressFn
+
+var UpdatePhaseChecking = fwcommon.UpdatePhaseChecking
+var UpdatePhaseDownloading = fwcommon.UpdatePhaseDownloading
+var UpdatePhaseVerifying = fwcommon.UpdatePhaseVerifying
+var UpdatePhasePatching = fwcommon.UpdatePhasePatching
+var UpdatePhaseApplying = fwcommon.UpdatePhaseApplying
+var UpdatePhaseDone = fwcommon.UpdatePhaseDone
+var UpdatePhaseFailed = fwcommon.UpdatePhaseFailed
+type DebuggerInterface = fwcommon.DebuggerInterface
+type SemVer = fwcommon.SemVer
+type NetUpDeployFile = fwupdate.NetUpDeployFile
+
+var ParseSemVer = fwcommon.ParseSemVer
+var ErrInvalidSemVer = fwcommon.ErrInvalidSemVer
+var ErrUpdateDowngrade = fwupdate.ErrUpdateDowngrade
+var ErrUpdateConstraints = fwupdate.ErrUpdateConstraints
+
+var ErrUnknownChannel = fwupdate.ErrUnknownChannel
+type RolloutCohort = fwupdate.RolloutCohort
+
+var ErrUpdateRollout = fwupdate.ErrUpdateRollout
+
+var ErrManifestSignature = fwupdate.ErrManifestSignature
+var ErrManifestExpired = fwupdate.ErrManifestExpired
+var ErrManifestRollback = fwupdate.ErrManifestRollback
+type UpdateTrustedKey = fwcommon.UpdateTrustedKey
+type KeyRotation = fwupdate.KeyRotation
+type KeyRevocation = fwupdate.KeyRevocation
+
+var ErrUntrustedKey = fwupdate.ErrUntrustedKey
+var UpdateKeyID = fwupdate.UpdateKeyID
+var KeyRotationMessage = fwupdate.KeyRotationMessage
+var KeyRevocationMessage = fwupdate.KeyRevocationMessage
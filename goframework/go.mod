@@ -5,7 +5,9 @@ go 1.24.4
 require github.com/shirou/gopsutil/v4 v4.25.11
 
 require (
+	github.com/andybalholm/brotli v1.2.0
 	github.com/inconshreveable/go-update v0.0.0-20160112193335-8152e7eb6ccf
+	github.com/klauspost/compress v1.18.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
@@ -0,0 +1,134 @@
+package libgoframework
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrefixHandlerChaining(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next := r.URL.Query().Get("next")
+		switch r.URL.Path {
+		case "/file":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("payload"))
+			return
+		case "/loop1":
+			next = "/loop2"
+		case "/loop2":
+			next = "/loop1"
+		}
+		// Every other page is an interstitial pointing at the next one
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><a id="next" href="` + next + `">continue</a></html>`))
+	}))
+	defer server.Close()
+
+	netOptions := (&NetFetchOptions{}).Default()
+	fw := SetupFramework(netOptions)
+
+	// Follows the "next" link of the interstitial pages
+	err := fw.Net.RegisterPrefixHandlerSpec(PrefixHandlerSpec{
+		Name:                "interstitial",
+		PrefixLen:           64,
+		ContentTypeContains: "text/html",
+		NeedsContent:        true,
+		FilterForUrls:       []string{server.URL},
+		Match:               PrefixHandlerMatchSpec{PrefixContains: []string{`id="next"`}},
+		Extract:             []PrefixHandlerExtractSpec{{Name: "next", Start: `href="`, End: `"`}},
+		URL:                 server.URL + "{next}",
+	})
+	if err != nil {
+		t.Fatalf("failed to register spec: %v", err)
+	}
+	netOptions.EnabledPrefixHandlers = append(netOptions.EnabledPrefixHandlers, "interstitial")
+
+	// --- Two hops to the file ---
+	start := server.URL + "/first?next=" + "/second%3Fnext%3D/file"
+	report, err := fw.Net.Fetch(MethodGet, start, false, false, nil, nil, nil, Ptr("chain"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("chained fetch failed: %v", err)
+	}
+	if string(report.GetNonStreamBytes()) != "payload" {
+		t.Errorf("expected the chain to end at the file, got %q", report.GetNonStreamBytes())
+	}
+	event := report.GetNetworkEvent()
+	if len(event.HandlerChain) != 2 {
+		t.Fatalf("expected 2 hops, got %+v", event.HandlerChain)
+	}
+	if event.HandlerChain[0].From != start || event.HandlerChain[1].To != server.URL+"/file" {
+		t.Errorf("unexpected chain: %+v", event.HandlerChain)
+	}
+	if event.Parent == nil || *event.Parent != event.HandlerChain[1].EventID {
+		t.Errorf("expected the final event to be a child of the last hop, got parent %v", event.Parent)
+	}
+
+	// --- Max depth stops resolving ---
+	depthOptions := *netOptions
+	depthOptions.PrefixHandlerMaxDepth = 1
+	report, err = fw.Net.Fetch(MethodGet, start, false, false, nil, nil, nil, Ptr("chain.depth"), nil, &depthOptions, nil)
+	if err != nil {
+		t.Fatalf("depth limited fetch failed: %v", err)
+	}
+	if !strings.Contains(string(report.GetNonStreamBytes()), `href="/file"`) {
+		t.Errorf("expected to stop at the second interstitial, got %q", report.GetNonStreamBytes())
+	}
+	if len(report.GetNetworkEvent().HandlerChain) != 1 {
+		t.Errorf("expected 1 hop, got %+v", report.GetNetworkEvent().HandlerChain)
+	}
+
+	// --- Loops are detected ---
+	_, err = fw.Net.Fetch(MethodGet, server.URL+"/loop1", false, false, nil, nil, nil, Ptr("chain.loop"), nil, netOptions, nil)
+	if !errors.Is(err, ErrPrefixHandlerLoop) {
+		t.Errorf("expected ErrPrefixHandlerLoop, got: %v", err)
+	}
+}
+
+func TestRewriteHandlers(t *testing.T) {
+	requested := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write([]byte("direct"))
+	}))
+	defer server.Close()
+
+	netOptions := (&NetFetchOptions{}).Default()
+	fw := SetupFramework(netOptions)
+
+	fw.Net.RegisterRewriteHandler(RequestRewriteHandler{
+		Name:          "share",
+		FilterForUrls: []string{server.URL},
+		Rewriter: func(reqUrl string) (string, bool) {
+			if !strings.Contains(reqUrl, "/share/") {
+				return "", false
+			}
+			return strings.Replace(reqUrl, "/share/", "/direct/", 1), true
+		},
+	})
+	netOptions.EnabledRewriteHandlers = append(netOptions.EnabledRewriteHandlers, "share")
+
+	report, err := fw.Net.Fetch(MethodGet, server.URL+"/share/file", false, false, nil, nil, nil, Ptr("rewrite"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	event := report.GetNetworkEvent()
+	if event.Remote != server.URL+"/direct/file" || event.OriginalRemote != server.URL+"/share/file" || event.RewrittenBy != "share" {
+		t.Errorf("rewrite not recorded, remote=%s original=%s by=%s", event.Remote, event.OriginalRemote, event.RewrittenBy)
+	}
+	if len(requested) != 1 || requested[0] != "/direct/file" {
+		t.Errorf("expected a single request to the direct link, got %v", requested)
+	}
+
+	// FetchWithoutHandlers never rewrites
+	requested = nil
+	report, err = fw.Net.FetchWithoutHandlers(MethodGet, server.URL+"/share/file", false, false, nil, nil, nil, Ptr("rewrite.none"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if report.GetNetworkEvent().OriginalRemote != "" || len(requested) != 1 || requested[0] != "/share/file" {
+		t.Errorf("expected FetchWithoutHandlers to request the URL as is, got %v", requested)
+	}
+}
@@ -0,0 +1,262 @@
+package goframework_net
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) when an entry, chunk or redirect url of a chibit (or an HTTP redirect of their fetches) is not allowed by NetFetchOptions.ChibitRedirectSchemes/ChibitRedirectHosts
+var ErrChibitRedirectRejected = errors.New("chibit redirect target rejected")
+
+// The parent event of a chibit fetch, the index, entry, chunk, redirect and fallback fetches hang under it.
+// It stays open until the content is delivered (for streams until the stream ends or is closed) and finishes with the outcome.
+type chibitEvent struct {
+	nh    *NetHandler
+	event fwcommon.NetworkEvent
+	mu    sync.Mutex
+	done  bool
+}
+
+func (nh *NetHandler) openChibitEvent(method fwcommon.HttpMethod, remoteUrl string, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string) *chibitEvent {
+	ce := &chibitEvent{
+		nh: nh,
+		event: fwcommon.NetworkEvent{
+			ID:              fmt.Sprintf("Fw.Net.Chibit:%d", fwcommon.FrameworkIndexes.GetNewOfIndex("netevent")),
+			Parent:          parentID,
+			Context:         contextID,
+			Initiator:       prependElementIdentifier(initiator, "Fw.Net.Chibit"),
+			Method:          method,
+			NetFetchOptions: options,
+			MetaDirection:   fwcommon.NetOutgoing,
+			Remote:          remoteUrl,
+			Size:            -1,
+			EventState:      fwcommon.NetStateWaiting,
+		},
+	}
+	ce.nh.deb.NetCreate(ce.event)
+	return ce
+}
+
+func (ce *chibitEvent) id() *string {
+	return fwcommon.Ptr(ce.event.ID)
+}
+
+// Finishes the event with the result of the fetch that delivered the content, only the first call counts
+func (ce *chibitEvent) finish(result *fwcommon.NetworkEvent, err error, interrupted bool) {
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	if ce.done {
+		return
+	}
+	ce.done = true
+
+	if result != nil {
+		ce.event.Status = result.Status
+		ce.event.Size = result.Size
+		ce.event.Transferred = result.Transferred
+	}
+	ce.event.Interrupted = interrupted
+	ce.event.EventSuccess = err == nil
+	ce.event.EventState = fwcommon.NetStateFinished
+	if err != nil {
+		ce.event.EventState = fwcommon.NetStateFailed
+	}
+	ce.nh.deb.NetStopWFUpdate(ce.event)
+}
+
+// Finishes the event once the report is delivered, right away unless it is a stream which finishes when it ends or is closed
+func (ce *chibitEvent) finishWith(report fwcommon.NetworkProgressReportInterface, err error, stream bool) (fwcommon.NetworkProgressReportInterface, error) {
+	if err != nil || report == nil {
+		if err == nil {
+			err = fmt.Errorf("no report")
+		}
+		ce.finish(nil, err, false)
+		return report, err
+	}
+
+	progress, ok := report.(*NetProgressReport)
+	if !stream || !ok || progress.Response == nil || progress.Response.Body == nil {
+		ce.finish(report.GetNetworkEvent(), nil, false)
+		return report, nil
+	}
+	progress.Response.Body = &chibitEventBody{ReadCloser: progress.Response.Body, event: ce, result: progress.Event}
+	return report, nil
+}
+
+// Finishes a chibitEvent when the body of a streamed result ends, fails or is closed before it ended
+type chibitEventBody struct {
+	io.ReadCloser
+	event  *chibitEvent
+	result *fwcommon.NetworkEvent
+}
+
+func (b *chibitEventBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.event.finish(b.result, nil, false)
+	} else if err != nil {
+		b.event.finish(b.result, err, false)
+	}
+	return n, err
+}
+
+func (b *chibitEventBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.event.finish(b.result, err, true)
+	return err
+}
+
+// Schemes a chibit url may use when NetFetchOptions.ChibitRedirectSchemes is empty: never weaker than its parent's (index or entry) and never local from a remote parent
+func defaultChibitRedirectSchemes(parentScheme string) []string {
+	switch parentScheme {
+	case "https":
+		return []string{"https"}
+	case "file":
+		return []string{"file", "https", "http"}
+	}
+	return []string{"https", "http"}
+}
+
+// Hosts are matched exactly or by a "*.example.com" pattern, which matches subdomains only
+func chibitHostAllowed(host string, patterns []string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks a url the chibit document at parentUrl points to (an entry of an index, a chunk or redirect target of an entry) against the scheme and host policy of the options
+func checkChibitUrl(parentUrl string, target string, options *fwcommon.NetFetchOptions) error {
+	u, err := url.Parse(target)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("%w: %q is not an absolute url", ErrChibitRedirectRejected, target)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	allowed := options.ChibitRedirectSchemes
+	if len(allowed) == 0 {
+		parentScheme := ""
+		if pu, err := url.Parse(parentUrl); err == nil {
+			parentScheme = strings.ToLower(pu.Scheme)
+		}
+		allowed = defaultChibitRedirectSchemes(parentScheme)
+	}
+	if !slices.ContainsFunc(allowed, func(s string) bool { return strings.EqualFold(s, scheme) }) {
+		return fmt.Errorf("%w: scheme of %q is not allowed (allowed: %v)", ErrChibitRedirectRejected, target, allowed)
+	}
+
+	if len(options.ChibitRedirectHosts) > 0 && !chibitHostAllowed(u.Hostname(), options.ChibitRedirectHosts) {
+		return fmt.Errorf("%w: host of %q is not allowed", ErrChibitRedirectRejected, target)
+	}
+	return nil
+}
+
+// The request context key of the url policy of a chibit fetch
+type chibitPolicyKey struct{}
+
+type chibitPolicy struct {
+	parentUrl string
+	options   *fwcommon.NetFetchOptions
+}
+
+// A copy of options whose fetches only follow HTTP redirects that checkChibitUrl allows for a url of the chibit document at parentUrl
+func withChibitPolicy(options *fwcommon.NetFetchOptions, parentUrl string) *fwcommon.NetFetchOptions {
+	ctx := context.Background()
+	if options.Context != nil {
+		ctx = *options.Context
+	}
+	ctx = context.WithValue(ctx, chibitPolicyKey{}, chibitPolicy{parentUrl: parentUrl, options: options})
+	scoped := *options
+	scoped.Context = &ctx
+	return &scoped
+}
+
+// Whether fetches with options carry a chibit url policy
+func hasChibitPolicy(options *fwcommon.NetFetchOptions) bool {
+	return options.Context != nil && (*options.Context).Value(chibitPolicyKey{}) != nil
+}
+
+// Checks an HTTP redirect against the url policy of the chibit fetch it belongs to, other fetches pass
+func checkChibitHttpRedirect(req *http.Request) error {
+	policy, ok := req.Context().Value(chibitPolicyKey{}).(chibitPolicy)
+	if !ok {
+		return nil
+	}
+	return checkChibitUrl(policy.parentUrl, req.URL.String(), policy.options)
+}
+
+// Wraps the CheckRedirect of a custom client so chibit fetches through it keep their url policy
+func chibitCheckRedirect(next func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := checkChibitHttpRedirect(req); err != nil {
+			return err
+		}
+		if next == nil {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		}
+		return next(req, via)
+	}
+}
+
+// Drops the chunk urls the policy does not allow, a chunk left without urls fails the chibit
+func allowedChibitChunks(entryUrl string, chunks []ChibitChunk, options *fwcommon.NetFetchOptions) ([]ChibitChunk, error) {
+	allowed := make([]ChibitChunk, len(chunks))
+	for i, chunk := range chunks {
+		var errs []error
+		urls := []string{}
+		for _, chunkUrl := range chunk.urls {
+			if err := checkChibitUrl(entryUrl, chunkUrl, options); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			urls = append(urls, chunkUrl)
+		}
+		if len(urls) == 0 {
+			return nil, fmt.Errorf("chibit chunk %d has no allowed urls: %w", i, errors.Join(errs...))
+		}
+		chunk.urls = urls
+		allowed[i] = chunk
+	}
+	return allowed, nil
+}
+
+// Fetches the first redirect target of the entry that the policy allows and that responds
+func (nh *NetHandler) fetchChibitRedirect(entry *ChibitEntry, method fwcommon.HttpMethod, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string) (fwcommon.NetworkProgressReportInterface, error) {
+	var errs []error
+	targetOptions := withChibitPolicy(options, entry.url)
+	for _, target := range entry.metadata.chunks {
+		if err := checkChibitUrl(entry.url, target, options); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		report, err := nh.Fetch(method, target, stream, file, fileout, progressor, body, contextID, prependElementIdentifier(initiator, "Fw.Net.Chibit.Redirect"), targetOptions, parentID)
+		if err == nil {
+			return report, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", target, err))
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("chibit redirect has no targets")
+	}
+	return nil, errors.Join(errs...)
+}
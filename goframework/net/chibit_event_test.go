@@ -0,0 +1,264 @@
+package goframework_net
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+	fwdebug "github.com/sbamboo/goframework/debug"
+	fwlog "github.com/sbamboo/goframework/log"
+)
+
+// Records the events a NetHandler creates and stops
+type recordingDebugger struct {
+	fwcommon.DebuggerInterface
+	mu      sync.Mutex
+	created []fwcommon.NetworkEvent
+	stopped map[string]fwcommon.NetworkEvent
+}
+
+func (d *recordingDebugger) IsActive() bool { return true }
+
+func (d *recordingDebugger) NetCreate(ev fwcommon.NetworkEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.created = append(d.created, ev)
+	return nil
+}
+
+func (d *recordingDebugger) NetStopWFUpdate(ev fwcommon.NetworkEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped[ev.ID] = ev
+	return nil
+}
+
+func (d *recordingDebugger) chibitEvents() []fwcommon.NetworkEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var events []fwcommon.NetworkEvent
+	for _, ev := range d.created {
+		if strings.HasPrefix(ev.ID, "Fw.Net.Chibit:") {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func (d *recordingDebugger) stoppedEvent(id string) (fwcommon.NetworkEvent, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ev, ok := d.stopped[id]
+	return ev, ok
+}
+
+func newRecordingNetHandler() (*NetHandler, *recordingDebugger) {
+	config := &fwcommon.FrameworkConfig{NetFetchOptions: (&fwcommon.NetFetchOptions{}).Default()}
+	deb := &recordingDebugger{DebuggerInterface: fwdebug.NewDebugEmitter(config), stopped: map[string]fwcommon.NetworkEvent{}}
+	return NewNetHandler(config, deb, fwlog.NewLogger(config, deb), nil), deb
+}
+
+func TestChibitRedirectEventAndPolicy(t *testing.T) {
+	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog)
+	defer fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chibits/chibits.json":
+			w.Write([]byte(`{"` + testChibitUUID + `": "entries/v2.json", "1e5e1a4e-3c1d-4f7a-9e2b-6d8c0f1a2b3c": "entries/v1.json"}`))
+		case "/chibits/entries/v2.json":
+			w.Write([]byte(`{"chibit-version": "2.0", "filename": "f", "size": 0, "type": "redirect", "urls": ["file:///etc/passwd", "https://blocked.example/f", "/content"]}`))
+		case "/chibits/entries/v1.json":
+			w.Write([]byte(`{"chibit-version": "1.0", "filename": "f", "size": 0, "type": "redirect", "max-size": 0, "checksum": {"algorithm": "sha256", "hash": ""}, "chunks": ["` + server.URL + `/content"]}`))
+		case "/content":
+			w.Write([]byte("redirected"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	nh, deb := newRecordingNetHandler()
+	options := (&fwcommon.NetFetchOptions{}).Default()
+	options.ChibitRedirectHosts = []string{"127.0.0.1"}
+
+	fetch := func(uuid string, stream bool) (fwcommon.NetworkProgressReportInterface, error) {
+		return nh.FetchWithChibits(fwcommon.MethodGet, "chibit:"+uuid+"@"+server.URL, stream, false, nil, nil, nil, nil, nil, options, nil, nil, nil)
+	}
+	lastChibitEvent := func() fwcommon.NetworkEvent {
+		events := deb.chibitEvents()
+		if len(events) == 0 {
+			t.Fatalf("no chibit event was created")
+		}
+		return events[len(events)-1]
+	}
+
+	// The file:// and the disallowed host are skipped, both entry versions go through the same redirect path
+	for _, uuid := range []string{testChibitUUID, "1e5e1a4e-3c1d-4f7a-9e2b-6d8c0f1a2b3c"} {
+		report, err := fetch(uuid, false)
+		if err != nil {
+			t.Fatalf("%s: fetch failed: %v", uuid, err)
+		}
+		if string(report.GetNonStreamBytes()) != "redirected" {
+			t.Errorf("%s: unexpected content %q", uuid, report.GetNonStreamBytes())
+		}
+
+		chibit := lastChibitEvent()
+		if chibit.EventState != fwcommon.NetStateWaiting {
+			t.Errorf("%s: expected the chibit event to start waiting, got %s", uuid, chibit.EventState)
+		}
+		stopped, ok := deb.stoppedEvent(chibit.ID)
+		if !ok || stopped.EventState != fwcommon.NetStateFinished || !stopped.EventSuccess || stopped.Status != http.StatusOK {
+			t.Errorf("%s: expected the chibit event to finish successfully with the redirect's status, got %+v", uuid, stopped)
+		}
+	}
+
+	// Every fetch of the resolution hangs under the chibit event
+	chibit := lastChibitEvent()
+	deb.mu.Lock()
+	parents := map[string]*string{}
+	for _, ev := range deb.created {
+		parents[ev.ID] = ev.Parent
+	}
+	children := 0
+	for _, ev := range deb.created {
+		for p := ev.Parent; p != nil; p = parents[*p] {
+			if *p == chibit.ID {
+				children++
+				break
+			}
+		}
+	}
+	deb.mu.Unlock()
+	if children < 3 {
+		t.Errorf("expected the index, entry and redirect fetches under the chibit event, got %d", children)
+	}
+
+	// A stream keeps the event open until it is read
+	report, err := fetch(testChibitUUID, true)
+	if err != nil {
+		t.Fatalf("stream fetch failed: %v", err)
+	}
+	chibit = lastChibitEvent()
+	if _, ok := deb.stoppedEvent(chibit.ID); ok {
+		t.Errorf("expected the chibit event to stay open until the stream is read")
+	}
+	io.ReadAll(report)
+	report.Close()
+	if stopped, ok := deb.stoppedEvent(chibit.ID); !ok || stopped.EventState != fwcommon.NetStateFinished || stopped.Interrupted {
+		t.Errorf("expected the chibit event to finish with the stream, got %+v", stopped)
+	}
+
+	// Nothing is allowed, the event fails
+	options.ChibitRedirectSchemes = []string{"ftp"}
+	if _, err := fetch(testChibitUUID, false); !errors.Is(err, ErrChibitRedirectRejected) {
+		t.Errorf("expected ErrChibitRedirectRejected, got %v", err)
+	}
+	if stopped, _ := deb.stoppedEvent(lastChibitEvent().ID); stopped.EventState != fwcommon.NetStateFailed || stopped.EventSuccess {
+		t.Errorf("expected the chibit event to fail, got %+v", stopped)
+	}
+}
+
+func TestCheckChibitUrl(t *testing.T) {
+	options := (&fwcommon.NetFetchOptions{}).Default()
+	cases := []struct {
+		entry, target string
+		hosts         []string
+		ok            bool
+	}{
+		{"https://repo.example/e.json", "https://cdn.example/f", nil, true},
+		{"https://repo.example/e.json", "http://cdn.example/f", nil, false},
+		{"http://repo.example/e.json", "https://cdn.example/f", nil, true},
+		{"http://repo.example/e.json", "file:///etc/passwd", nil, false},
+		{"file:///repo/e.json", "file:///repo/f", nil, true},
+		{"https://repo.example/e.json", "relative/f", nil, false},
+		{"https://repo.example/e.json", "https://a.cdn.example/f", []string{"*.cdn.example"}, true},
+		{"https://repo.example/e.json", "https://cdn.example/f", []string{"*.cdn.example"}, false},
+		{"https://repo.example/e.json", "https://CDN.example:8443/f", []string{"cdn.example"}, true},
+	}
+	for _, c := range cases {
+		options.ChibitRedirectHosts = c.hosts
+		err := checkChibitUrl(c.entry, c.target, options)
+		if (err == nil) != c.ok {
+			t.Errorf("%s -> %s (hosts %v): expected ok=%v, got %v", c.entry, c.target, c.hosts, c.ok, err)
+		}
+	}
+}
+
+func TestChibitUrlPolicy(t *testing.T) {
+	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog)
+	defer fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog)
+
+	entry := func(uuid string, chunks ...string) []byte {
+		return []byte(`{"chibit-version": "1.0", "uuid": "` + uuid + `", "filename": "f", "size": 10, "type": "split", "max-size": 5, "checksum": {"algorithm": "sha256", "hash": ""}, "chunks": ["` + strings.Join(chunks, `", "`) + `"]}`)
+	}
+	const (
+		okUUID    = "0a0a0a0a-0000-4000-8000-000000000001"
+		entryUUID = "0a0a0a0a-0000-4000-8000-000000000002"
+		chunkUUID = "0a0a0a0a-0000-4000-8000-000000000003"
+		movedUUID = "0a0a0a0a-0000-4000-8000-000000000004"
+	)
+
+	var otherHost string // The same server under a host the policy does not allow
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chibits/chibits.json":
+			w.Write([]byte(`{"` + okUUID + `": "entries/ok.json", "` + entryUUID + `": "` + otherHost + `/chibits/entries/ok.json", "` + chunkUUID + `": "entries/chunk.json", "` + movedUUID + `": "entries/moved.json"}`))
+		case "/chibits/entries/ok.json":
+			w.Write(entry(okUUID, "/a", "/b"))
+		case "/chibits/entries/chunk.json":
+			w.Write(entry(chunkUUID, otherHost+"/a", "/b"))
+		case "/chibits/entries/moved.json":
+			w.Write(entry(movedUUID, "/moved", "/b"))
+		case "/moved":
+			http.Redirect(w, r, otherHost+"/a", http.StatusFound)
+		case "/a":
+			w.Write([]byte("01234"))
+		case "/b":
+			w.Write([]byte("56789"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	otherHost = strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	nh, _ := newRecordingNetHandler()
+	options := (&fwcommon.NetFetchOptions{}).Default()
+	options.ChibitChunkRetries = 0
+	options.ChibitRedirectHosts = []string{"127.0.0.1"}
+	fetch := func(uuid string) (fwcommon.NetworkProgressReportInterface, error) {
+		return nh.FetchWithChibits(fwcommon.MethodGet, "chibit:"+uuid+"@"+server.URL, false, false, nil, nil, nil, nil, nil, options, nil, nil, nil)
+	}
+
+	report, err := fetch(okUUID)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if string(report.GetNonStreamBytes()) != "0123456789" {
+		t.Errorf("unexpected content %q", report.GetNonStreamBytes())
+	}
+
+	// Entry urls, chunk urls and HTTP redirects of chunk fetches (with the built-in and a custom client) are all held to the policy
+	for _, c := range []struct {
+		name   string
+		uuid   string
+		client *http.Client
+	}{
+		{"entry url", entryUUID, nil},
+		{"chunk url", chunkUUID, nil},
+		{"chunk redirect", movedUUID, nil},
+		{"chunk redirect with a custom client", movedUUID, &http.Client{}},
+	} {
+		options.Client = c.client
+		if _, err := fetch(c.uuid); !errors.Is(err, ErrChibitRedirectRejected) {
+			t.Errorf("%s: expected ErrChibitRedirectRejected, got %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package goframework_net
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// A parsed {repo}/chibits/chibits.json, cached per index URL with the validators needed to revalidate it
+type chibitIndex struct {
+	url          string
+	entries      map[string]json.RawMessage
+	etag         string
+	lastModified string
+	fetched      time.Time // Last fetch or revalidation
+	eventID      *string   // Event of the fetch that returned it, nil if it was served from the cache without a request
+
+	content          []byte           // The index as fetched, what a detached signature covers
+	signature        *ChibitSignature // Detached signature, nil if the index is unsigned or it was not fetched
+	signatureFetched bool             // Signatures are only fetched when they are verified, so an index cached without one may still have one
+}
+
+// A copy for one caller, cached indexes are shared
+func (ci *chibitIndex) withEvent(eventID *string) *chibitIndex {
+	c := *ci
+	c.eventID = eventID
+	return &c
+}
+
+// Turns a repo (url, file:// url or local path) into the URL of its index
+func chibitIndexUrl(chibitRepo string) (string, error) {
+	if isLocalPath(chibitRepo) {
+		fileUrl, err := localPathToFileUrl(chibitRepo)
+		if err != nil {
+			return "", fmt.Errorf("invalid local chibit repo %s: %w", chibitRepo, err)
+		}
+		chibitRepo = fileUrl
+	}
+	return strings.TrimSuffix(chibitRepo, "/") + "/chibits/chibits.json", nil
+}
+
+// Fetches the index of a repo along with its detached signature when signatures are verified
+func (nh *NetHandler) fetchChibitIndex(chibitRepo string, label string, progressor fwcommon.ProgressorFn, contextID *string, options *fwcommon.NetFetchOptions, parentID *string) (*chibitIndex, error) {
+	index, err := nh.loadChibitIndex(chibitRepo, label, progressor, contextID, options, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if chibitSignaturesWanted(options) && !index.signatureFetched {
+		sigParentID := parentID
+		if index.eventID != nil {
+			sigParentID = index.eventID
+		}
+		index.signature, err = nh.fetchChibitDetachedSignature(index.url, "Index::"+label, progressor, contextID, options, sigParentID)
+		if err != nil {
+			return nil, err
+		}
+		index.signatureFetched = true
+		if options.ChibitIndexMaxAge >= 0 {
+			nh.storeChibitIndex(index.withEvent(nil))
+		}
+	}
+	return index, nil
+}
+
+// A cached index is used as-is for NetFetchOptions.ChibitIndexMaxAge and revalidated (If-None-Match / If-Modified-Since) after that
+func (nh *NetHandler) loadChibitIndex(chibitRepo string, label string, progressor fwcommon.ProgressorFn, contextID *string, options *fwcommon.NetFetchOptions, parentID *string) (*chibitIndex, error) {
+	indexUrl, err := chibitIndexUrl(chibitRepo)
+	if err != nil {
+		return nil, err
+	}
+
+	maxAge := options.ChibitIndexMaxAge
+	var cached *chibitIndex
+	if maxAge >= 0 {
+		nh.chibitIndexMutex.Lock()
+		if c := nh.chibitIndexCache[indexUrl]; c != nil {
+			cached = c.withEvent(nil)
+		}
+		nh.chibitIndexMutex.Unlock()
+
+		if cached != nil && maxAge > 0 && time.Since(cached.fetched) < time.Duration(maxAge)*time.Millisecond {
+			return cached, nil
+		}
+	}
+
+	fetchOptions := options
+	if cached != nil && (cached.etag != "" || cached.lastModified != "") {
+		headers := http.Header{}
+		if options.Headers != nil {
+			headers = options.Headers.Clone()
+		}
+		if cached.etag != "" {
+			headers.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			headers.Set("If-Modified-Since", cached.lastModified)
+		}
+		conditional := *options
+		conditional.Headers = &headers
+		fetchOptions = &conditional
+	}
+
+	indexReport, err := nh.Fetch(
+		fwcommon.MethodGet,
+		indexUrl,
+		false,
+		false,
+		nil,
+		progressor,
+		nil,
+		contextID,
+		fwcommon.Ptr(fwcommon.ElementIdentifier("Fw.Net.Chibit.Index::"+label)),
+		fetchOptions,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	eventID := &indexReport.GetNetworkEvent().ID
+
+	// Still valid, keep using the cached index
+	if cached != nil && indexReport.GetNetworkEvent().Status == http.StatusNotModified {
+		cached.fetched = time.Now()
+		nh.storeChibitIndex(cached)
+		nh.log.Debug("Chibit index " + indexUrl + " not modified, using cached index")
+		return cached.withEvent(eventID), nil
+	}
+
+	indexContent := indexReport.GetNonStreamBytes()
+	if indexContent == nil {
+		return nil, fmt.Errorf("Index fetch returned no content")
+	}
+
+	index := &chibitIndex{url: indexUrl, fetched: time.Now(), content: indexContent}
+	if err := json.Unmarshal(indexContent, &index.entries); err != nil {
+		return nil, err
+	}
+	if resp := indexReport.GetResponse(); resp != nil {
+		index.etag = resp.Header.Get("ETag")
+		// Last-Modified has a one second resolution, an index modified in the second it was fetched could change again unnoticed
+		if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && time.Since(modified) > time.Second {
+			index.lastModified = resp.Header.Get("Last-Modified")
+		}
+	}
+
+	if maxAge >= 0 {
+		nh.storeChibitIndex(index)
+	}
+	return index.withEvent(eventID), nil
+}
+
+func (nh *NetHandler) storeChibitIndex(index *chibitIndex) {
+	nh.chibitIndexMutex.Lock()
+	defer nh.chibitIndexMutex.Unlock()
+	if nh.chibitIndexCache == nil {
+		nh.chibitIndexCache = map[string]*chibitIndex{}
+	}
+	nh.chibitIndexCache[index.url] = index
+}
+
+// Drops every cached chibit repo index
+func (nh *NetHandler) ClearChibitIndexCache() {
+	nh.chibitIndexMutex.Lock()
+	defer nh.chibitIndexMutex.Unlock()
+	nh.chibitIndexCache = nil
+}
@@ -0,0 +1,365 @@
+package goframework_net
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+type ChibitPublishOptions struct {
+	UUID        string                 // Empty to generate a random (v4) UUID, anything else must be a UUID (ErrInvalidChibitURI)
+	Filename    string                 // Filename recorded in the entry, empty for the base name of the published file
+	MaxSize     int64                  // Max bytes per chunk, <=0 for a single chunk
+	Version     ChibitVersionId        // Entry format, empty for V2_0
+	Algorithm   fwcommon.HashAlgorithm // Whole-file checksum, empty for sha256 (V2 chunks are always addressed by sha256)
+	Compression string                 // V2 only, chunk files are compressed with "zstd" or "gzip", empty for none
+	BaseURL     string                 // Public URL of the repo, if set the urls in the index and entry are absolute, else relative to the file they are in
+
+	// If Signer is set the entry and the index are signed. V2 entries embed their signature (see ChibitCanonicalEntry) unless Detached is set,
+	// V1 entries and the index always get a detached {file}.sig covering their exact bytes
+	SignatureAlgorithm fwcommon.SigAlgorithm
+	SignatureKeyID     string
+	Signer             func(data []byte) ([]byte, error)
+	Detached           bool
+}
+
+type ChibitPublished struct {
+	UUID       string
+	URI        string // "chibit:{uuid}", or "chibit:{uuid}@{BaseURL}" if a BaseURL was given
+	EntryPath  string
+	ChunkPaths []string
+	Size       int64
+	Checksum   string
+}
+
+// A V1 entry as PublishChibit writes it and parseChibitV1Entry reads it
+type chibitV1EntryJSON struct {
+	UUID     string `json:"uuid"`
+	Filename string `json:"filename"`
+	Checksum struct {
+		Algorithm string `json:"algorithm"`
+		Hash      any    `json:"hash"` // crc32 is written as a number
+	} `json:"checksum"`
+	Size    int64    `json:"size"`
+	Type    string   `json:"type"`
+	Chunks  []string `json:"chunks"`
+	MaxSize int64    `json:"max-size"`
+	Version string   `json:"chibit-version"`
+}
+
+func newChibitUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func newChibitChunkCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "zstd":
+		return zstd.NewWriter(w)
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported chunk compression '%s' (supported: zstd, gzip)", compression)
+}
+
+// Splits a file into chunks under {repoDir}/chibits/chunks, writes its entry to {repoDir}/chibits/entries and adds it to {repoDir}/chibits/chibits.json.
+// The directory can be served as-is by any static server, the resulting URI is fetchable with FetchWithChibits.
+func PublishChibit(repoDir string, file string, options ChibitPublishOptions, chckPtr fwcommon.ChckInterface) (*ChibitPublished, error) {
+	if options.Version == "" {
+		options.Version = V2_0
+	}
+	major := chibitMajor(options.Version)
+	if major != 1 && major != 2 {
+		return nil, fmt.Errorf("unsupported chibit-version %s", options.Version)
+	}
+	if major == 1 && options.Compression != "" {
+		return nil, fmt.Errorf("compression requires chibit-version 2")
+	}
+	if options.Algorithm == "" {
+		options.Algorithm = fwcommon.SHA256
+	}
+	if options.UUID == "" {
+		uuid, err := newChibitUUID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate uuid: %w", err)
+		}
+		options.UUID = uuid
+	}
+	// The uuid names the entry (and V1 chunk directory) on disk and has to parse back out of the URI
+	if !chibitUUIDPattern.MatchString(options.UUID) {
+		return nil, fmt.Errorf("%w: %q is not a uuid", ErrInvalidChibitURI, options.UUID)
+	}
+	if options.Filename == "" {
+		options.Filename = filepath.Base(file)
+	}
+	baseURL := strings.TrimSuffix(options.BaseURL, "/")
+
+	fileHash, err := chckPtr.NewHasher(options.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported checksum algorithm '%s': %w", options.Algorithm, err)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := stat.Size()
+
+	maxSize := options.MaxSize
+	if maxSize <= 0 || maxSize > size {
+		maxSize = max(size, 1)
+	}
+	count := int((size + maxSize - 1) / maxSize)
+	if count == 0 {
+		count = 1 // An empty file is a single empty chunk
+	}
+
+	chibitsDir := filepath.Join(repoDir, "chibits")
+	indexPath := filepath.Join(chibitsDir, "chibits.json")
+
+	// Updating a signed index without re-signing it would leave a signature that no longer verifies
+	if options.Signer == nil {
+		if _, err := os.Stat(indexPath + chibitSignatureSuffix); err == nil {
+			return nil, fmt.Errorf("the chibit index is signed (%s), a Signer is needed to update it", indexPath+chibitSignatureSuffix)
+		}
+	}
+	entriesDir := filepath.Join(chibitsDir, "entries")
+	chunksDir := filepath.Join(chibitsDir, "chunks")
+	if major == 1 {
+		// V1 chunks are addressed by position so each chibit gets its own directory
+		chunksDir = filepath.Join(chunksDir, options.UUID)
+	}
+	for _, dir := range []string{entriesDir, chunksDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	uri := ChibitURI{UUID: options.UUID}
+	if baseURL != "" {
+		uri.Repos = []string{baseURL}
+	}
+	published := &ChibitPublished{
+		UUID: options.UUID,
+		URI:  uri.String(),
+		Size: size,
+	}
+
+	// Each chunk is streamed to a temporary file, V2 chunks are named by their hash (and compression) once it is known
+	var chunkUrls []string
+	var chunkDescs []chibitV2ChunkJSON
+	for i := 0; i < count; i++ {
+		tmp, err := os.CreateTemp(chunksDir, ".chunk-*")
+		if err != nil {
+			return nil, err
+		}
+
+		chunkHash, _ := chckPtr.NewHasher(fwcommon.SHA256)
+		var dst io.Writer = tmp
+		var compressor io.WriteCloser
+		if options.Compression != "" {
+			compressor, err = newChibitChunkCompressor(tmp, options.Compression)
+			if err != nil {
+				tmp.Close()
+				os.Remove(tmp.Name())
+				return nil, err
+			}
+			dst = compressor
+		}
+
+		n, err := io.CopyN(io.MultiWriter(dst, chunkHash, fileHash), f, min(maxSize, size-int64(i)*maxSize))
+		if err == nil && compressor != nil {
+			err = compressor.Close()
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+			return nil, fmt.Errorf("failed to write chunk %d: %w", i, err)
+		}
+
+		name := fmt.Sprintf("%d.chunk", i+1)
+		if major == 2 {
+			hash := chckPtr.HashSum(chunkHash, fwcommon.SHA256)
+			name = chibitChunkName(hash, options.Compression)
+			chunkDescs = append(chunkDescs, chibitV2ChunkJSON{
+				Hash:        chibitHash(hash),
+				Algorithm:   string(fwcommon.SHA256),
+				Size:        int(n),
+				Compression: options.Compression,
+			})
+		} else if baseURL != "" {
+			chunkUrls = append(chunkUrls, baseURL+"/chibits/chunks/"+options.UUID+"/"+name)
+		} else {
+			chunkUrls = append(chunkUrls, "../chunks/"+options.UUID+"/"+name)
+		}
+
+		chunkPath := filepath.Join(chunksDir, name)
+		if err := os.Rename(tmp.Name(), chunkPath); err != nil {
+			os.Remove(tmp.Name())
+			return nil, err
+		}
+		published.ChunkPaths = append(published.ChunkPaths, chunkPath)
+	}
+	published.Checksum = chckPtr.HashSum(fileHash, options.Algorithm)
+
+	chibitType := string(Split)
+	if count == 1 {
+		chibitType = string(Single)
+	}
+
+	var entry []byte
+	if major == 1 {
+		v1 := chibitV1EntryJSON{
+			UUID:     options.UUID,
+			Filename: options.Filename,
+			Size:     size,
+			Type:     chibitType,
+			Chunks:   chunkUrls,
+			MaxSize:  maxSize,
+			Version:  string(options.Version),
+		}
+		v1.Checksum.Algorithm = string(options.Algorithm)
+		v1.Checksum.Hash = published.Checksum
+		if options.Algorithm == fwcommon.CRC32 {
+			v1.Checksum.Hash, _ = strconv.ParseUint(published.Checksum, 10, 32)
+		}
+		entry, err = json.MarshalIndent(v1, "", "    ")
+	} else {
+		chunkBase := "../chunks/"
+		if baseURL != "" {
+			chunkBase = baseURL + "/chibits/chunks/"
+		}
+		v2 := chibitV2EntryJSON{
+			UUID:       options.UUID,
+			Version:    string(options.Version),
+			Filename:   options.Filename,
+			Size:       int(size),
+			Type:       chibitType,
+			MaxSize:    int(maxSize),
+			Checksum:   &chibitChecksumJSON{Algorithm: string(options.Algorithm), Hash: chibitHash(published.Checksum)},
+			ChunkBases: []string{chunkBase},
+			Chunks:     chunkDescs,
+		}
+		if options.Signer != nil && !options.Detached {
+			unsigned, err := json.Marshal(v2)
+			if err != nil {
+				return nil, err
+			}
+			canonical, err := ChibitCanonicalEntry(unsigned)
+			if err != nil {
+				return nil, err
+			}
+			signature, err := options.Signer(canonical)
+			if err != nil {
+				return nil, fmt.Errorf("failed to sign entry: %w", err)
+			}
+			v2.Signature = newChibitSignatureJSON(signature, options)
+		}
+		entry, err = json.MarshalIndent(v2, "", "    ")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entryName := fmt.Sprintf("%s.v%d.json", options.UUID, major)
+	published.EntryPath = filepath.Join(entriesDir, entryName)
+	if err := os.WriteFile(published.EntryPath, entry, 0644); err != nil {
+		return nil, err
+	}
+	if options.Signer != nil && (options.Detached || major == 1) {
+		if err := writeChibitDetachedSignature(published.EntryPath, entry, options); err != nil {
+			return nil, err
+		}
+	}
+
+	entryUrl := "entries/" + entryName
+	if baseURL != "" {
+		entryUrl = baseURL + "/chibits/" + entryUrl
+	}
+	index, err := updateChibitIndex(indexPath, options.UUID, options.Version, entryUrl)
+	if err != nil {
+		return nil, err
+	}
+	if options.Signer != nil {
+		if err := writeChibitDetachedSignature(indexPath, index, options); err != nil {
+			return nil, err
+		}
+	}
+
+	return published, nil
+}
+
+func newChibitSignatureJSON(signature []byte, options ChibitPublishOptions) *chibitSignatureJSON {
+	return &chibitSignatureJSON{
+		Algorithm: string(options.SignatureAlgorithm),
+		KeyID:     options.SignatureKeyID,
+		Value:     base64.StdEncoding.EncodeToString(signature),
+	}
+}
+
+// Signs the exact bytes written to path into {path}.sig
+func writeChibitDetachedSignature(path string, content []byte, options ChibitPublishOptions) error {
+	signature, err := options.Signer(content)
+	if err != nil {
+		return fmt.Errorf("failed to sign %s: %w", filepath.Base(path), err)
+	}
+	out, err := json.MarshalIndent(newChibitSignatureJSON(signature, options), "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+chibitSignatureSuffix, out, 0644)
+}
+
+// Points uuid at entryUrl in the index, an existing per-version value only has the published version replaced. Returns the written index.
+func updateChibitIndex(indexPath string, uuid string, version ChibitVersionId, entryUrl string) ([]byte, error) {
+	index := map[string]json.RawMessage{}
+	content, err := os.ReadFile(indexPath)
+	if err == nil {
+		if err := json.Unmarshal(content, &index); err != nil {
+			return nil, fmt.Errorf("invalid chibit index %s: %w", indexPath, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var value any = entryUrl
+	var offered map[string]string
+	if json.Unmarshal(index[uuid], &offered) == nil && offered != nil {
+		offered[string(version)] = entryUrl
+		value = offered
+	}
+	index[uuid], err = json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return out, os.WriteFile(indexPath, out, 0644)
+}
@@ -0,0 +1,142 @@
+package goframework_net
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Detached signatures live next to what they sign, {entry-url}.sig and {repo}/chibits/chibits.json.sig.
+// They hold the same object as an embedded V2 "signature" but cover the exact bytes of the file.
+const chibitSignatureSuffix = ".sig"
+
+// Signatures are only fetched when they will be checked
+func chibitSignaturesWanted(options *fwcommon.NetFetchOptions) bool {
+	return len(options.ChibitTrustedKeys) > 0 || options.ChibitRequireSignatures
+}
+
+func parseChibitSignature(sig chibitSignatureJSON) (*ChibitSignature, error) {
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chibit signature encoding: %w", err)
+	}
+	return &ChibitSignature{
+		algorithm: fwcommon.SigAlgorithm(strings.ToLower(sig.Algorithm)),
+		keyID:     sig.KeyID,
+		value:     value,
+	}, nil
+}
+
+// Fetches the detached signature of signedUrl, nil without an error if there is none (404)
+func (nh *NetHandler) fetchChibitDetachedSignature(signedUrl string, label string, progressor fwcommon.ProgressorFn, contextID *string, options *fwcommon.NetFetchOptions, parentID *string) (*ChibitSignature, error) {
+	sigReport, err := nh.Fetch(
+		fwcommon.MethodGet,
+		signedUrl+chibitSignatureSuffix,
+		false,
+		false,
+		nil,
+		progressor,
+		nil,
+		contextID,
+		fwcommon.Ptr(fwcommon.ElementIdentifier("Fw.Net.Chibit.Signature::"+label)),
+		options,
+		parentID,
+	)
+	if err != nil {
+		if sigReport != nil && sigReport.GetNetworkEvent().Status == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to fetch signature of %s: %w", signedUrl, err)
+	}
+
+	content := sigReport.GetNonStreamBytes()
+	var sig chibitSignatureJSON
+	if err := json.Unmarshal(content, &sig); err != nil {
+		return nil, fmt.Errorf("invalid chibit signature %s: %w", signedUrl+chibitSignatureSuffix, err)
+	}
+	return parseChibitSignature(sig)
+}
+
+// Checks signed against the trusted keys matching the signature's key-id and algorithm
+func verifyChibitSignature(what string, signed []byte, sig *ChibitSignature, options *fwcommon.NetFetchOptions, chckPtr fwcommon.ChckInterface) error {
+	for _, key := range options.ChibitTrustedKeys {
+		if sig.keyID != "" && key.ID != sig.keyID {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != sig.algorithm {
+			continue
+		}
+		if chckPtr.SigBuff(signed, sig.algorithm, key.PublicKeyPEM, sig.value) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s signature did not verify against any trusted key", ErrChibitVerification, what)
+}
+
+// An entry naming another UUID than the one it was requested as is refused, a host could otherwise serve a validly signed entry under any UUID
+func (entry *ChibitEntry) checkUUID() error {
+	if entry.metadata.uuid != "" && !strings.EqualFold(entry.metadata.uuid, entry.uuid) {
+		return fmt.Errorf("%w: entry of %s names the uuid %s", ErrChibitVerification, entry.uuid, entry.metadata.uuid)
+	}
+	return nil
+}
+
+// Verifies the signatures of an entry and the index it was found in against NetFetchOptions.ChibitTrustedKeys.
+// Signatures that are present must verify and a signed entry has to name the UUID it was requested as, so it can not be served under another one.
+// With NetFetchOptions.ChibitRequireSignatures the entry and its index must also carry one (embedded or detached).
+// Without trusted keys and strict mode nothing is verified. FetchWithChibits calls this before fetching anything an entry points to.
+func (nh *NetHandler) VerifyChibitEntry(entry *ChibitEntry, options *fwcommon.NetFetchOptions, chckPtr fwcommon.ChckInterface) error {
+	if options == nil {
+		options = nh.config.NetFetchOptions
+	}
+	if !chibitSignaturesWanted(options) {
+		if entry.metadata.signature != nil {
+			nh.log.Debug("Chibit entry is signed but no trusted keys are configured, skipping verification")
+		}
+		return nil
+	}
+	if len(options.ChibitTrustedKeys) == 0 {
+		return fmt.Errorf("%w: signatures are required but no trusted keys are configured", ErrChibitVerification)
+	}
+	if chckPtr == nil {
+		return fmt.Errorf("chibit signatures are to be verified but no checker was provided")
+	}
+
+	if entry.index != nil && entry.index.signature != nil {
+		if err := verifyChibitSignature("chibit index", entry.index.content, entry.index.signature, options, chckPtr); err != nil {
+			return err
+		}
+	} else if options.ChibitRequireSignatures {
+		return fmt.Errorf("%w: chibit index is not signed", ErrChibitVerification)
+	}
+
+	signed := false
+	if entry.metadata.signature != nil {
+		if err := verifyChibitSignature("chibit entry", entry.metadata.signedBytes, entry.metadata.signature, options, chckPtr); err != nil {
+			return err
+		}
+		signed = true
+	}
+	if entry.signature != nil {
+		if err := verifyChibitSignature("detached chibit entry", entry.content, entry.signature, options, chckPtr); err != nil {
+			return err
+		}
+		signed = true
+	}
+	if !signed && options.ChibitRequireSignatures {
+		return fmt.Errorf("%w: chibit entry is not signed", ErrChibitVerification)
+	}
+	if signed {
+		if entry.metadata.uuid == "" {
+			return fmt.Errorf("%w: signed chibit entry does not name its uuid", ErrChibitVerification)
+		}
+		if err := entry.checkUUID(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
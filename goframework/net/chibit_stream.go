@@ -0,0 +1,590 @@
+package goframework_net
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Reads the chunks of a chibit in order as one stream, hashes are computed incrementally and a mismatch at EOF is returned instead of io.EOF.
+// With NetFetchOptions.ChibitConcurrency <= 1 each chunk is streamed and only fetched when the previous one is consumed,
+// a source that breaks mid-chunk is resumed from the next source, skipping what was already read. Since that content is handed
+// out as it arrives a chunk that fails its checksum can not be retried, so this is always an ErrChibitVerification.
+// With a higher concurrency up to that many chunks are fetched ahead into memory and verified before they are handed out,
+// so a source with bad content is just skipped. Either way all sources of a chunk are retried NetFetchOptions.ChibitChunkRetries times.
+type chibitReader struct {
+	nh      *NetHandler
+	chckPtr fwcommon.ChckInterface
+
+	chunks     []ChibitChunk
+	expectSize int64 // -1 if unknown
+	checksum   ChibitChecksumEntry
+
+	// Fetch parameters for the chunks
+	uuid       string
+	method     fwcommon.HttpMethod
+	progressor fwcommon.ProgressorFn // Serialized when chunks are fetched in parallel
+	contextID  *string
+	initiator  *fwcommon.ElementIdentifier
+	options    *fwcommon.NetFetchOptions
+	parentID   *string
+
+	concurrency int
+	retries     int
+	onChunkDone func() // Called once a chunk is verified and fully read
+
+	index     int // Current chunk
+	chunkRead int64
+	total     int64
+	fileHash  hash.Hash
+
+	// Streamed (concurrency <= 1)
+	source    int                                     // Current source of the current chunk
+	report    fwcommon.NetworkProgressReportInterface // Fetch of the current source, nil between chunks
+	body      io.Reader                               // Decompressed body of report
+	decoder   io.Closer                               // Set if body is a decompressor
+	chunkHash hash.Hash
+
+	// Prefetched (concurrency > 1)
+	prefetched []*chibitPrefetch // Per chunk, set when launched
+	launched   int               // Next chunk to launch
+	ctx        context.Context   // Cancels chunks in flight once the reader fails or is closed
+	cancel     context.CancelFunc
+	workers    sync.WaitGroup
+	pending    []byte // Unread part of the current chunk
+	delivering bool   // pending belongs to the current chunk
+
+	err error // Sticky, returned by every Read after the first failure
+}
+
+type chibitPrefetch struct {
+	data []byte
+	err  error
+	done chan struct{}
+}
+
+func (nh *NetHandler) newChibitReader(chunks []ChibitChunk, expectSize int64, checksum ChibitChecksumEntry, uuid string, method fwcommon.HttpMethod, progressor fwcommon.ProgressorFn, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string, chckPtr fwcommon.ChckInterface) (*chibitReader, error) {
+	// Chunk fetches share one copy of the options, normalized up front since Fetch writes defaults back into them
+	chunkOptions := *options
+	if chunkOptions.BufferSize < 0 {
+		chunkOptions.BufferSize = 32 * 1024
+	}
+
+	r := &chibitReader{
+		nh:          nh,
+		chckPtr:     chckPtr,
+		chunks:      chunks,
+		expectSize:  expectSize,
+		checksum:    checksum,
+		uuid:        uuid,
+		method:      method,
+		progressor:  progressor,
+		contextID:   contextID,
+		initiator:   initiator,
+		options:     &chunkOptions,
+		parentID:    parentID,
+		concurrency: options.ChibitConcurrency,
+		retries:     max(options.ChibitChunkRetries, 0),
+		prefetched:  make([]*chibitPrefetch, len(chunks)),
+	}
+	if checksum.hash != "" {
+		h, err := chckPtr.NewHasher(checksum.algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported chibit checksum algorithm '%s': %w", checksum.algorithm, err)
+		}
+		r.fileHash = h
+	}
+
+	if r.concurrency > 1 {
+		parent := context.Background()
+		if options.Context != nil {
+			parent = *options.Context
+		}
+		r.ctx, r.cancel = context.WithCancel(parent)
+		chunkOptions.Context = &r.ctx
+
+		if r.progressor == nil {
+			r.progressor = nh.progressor
+		}
+		if r.progressor != nil {
+			var mu sync.Mutex
+			org := r.progressor
+			r.progressor = func(progressPtr fwcommon.NetworkProgressReportInterface, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				org(progressPtr, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// The size the assembled content will have, -1 if it is not known up front
+func (r *chibitReader) size() int64 {
+	if r.expectSize >= 0 {
+		return r.expectSize
+	}
+	var size int64
+	for _, c := range r.chunks {
+		if c.size <= 0 {
+			return -1
+		}
+		size += int64(c.size)
+	}
+	return size
+}
+
+func (r *chibitReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if r.concurrency > 1 {
+		return r.readPrefetched(p)
+	}
+
+	for {
+		if r.body == nil {
+			if r.index >= len(r.chunks) {
+				r.err = r.finish()
+				return 0, r.err
+			}
+			if err := r.openChunk(0); err != nil {
+				r.err = err
+				return 0, err
+			}
+		}
+
+		n, err := r.body.Read(p)
+		if limit := r.chunkLimit(r.index); limit >= 0 && r.chunkRead+int64(n) > limit {
+			r.closeChunk()
+			r.err = fmt.Errorf("%w: chunk %d from %s: larger than %d bytes", ErrChibitVerification, r.index, r.chunks[r.index].urls[r.source], limit)
+			return 0, r.err
+		}
+		if n > 0 {
+			r.chunkRead += int64(n)
+			r.total += int64(n)
+			if r.chunkHash != nil {
+				r.chunkHash.Write(p[:n])
+			}
+			if r.fileHash != nil {
+				r.fileHash.Write(p[:n])
+			}
+		}
+
+		switch {
+		case err == io.EOF:
+			if verr := r.endChunk(); verr != nil {
+				r.err = verr
+				return n, verr
+			}
+		case err != nil:
+			// The source broke mid-chunk, continue the chunk from the next source
+			if rerr := r.openChunk(r.source + 1); rerr != nil {
+				r.err = fmt.Errorf("chunk %d: %w (after: %v)", r.index, rerr, err)
+				return n, r.err
+			}
+		}
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// The most content a chunk may have, its declared size or for undeclared ones the whole expected size, -1 if neither is known
+func (r *chibitReader) chunkLimit(index int) int64 {
+	if size := r.chunks[index].size; size > 0 {
+		return int64(size)
+	}
+	return r.expectSize
+}
+
+// Fetches a chunk source (streamed), wrapping the body in the chunk's decompressor.
+// The (decompressed) body ends one byte past the chunk's limit so an endless or bombed source is cut off and fails its size check.
+func (r *chibitReader) openSource(index int, source int) (fwcommon.NetworkProgressReportInterface, io.Reader, io.Closer, error) {
+	chunk := r.chunks[index]
+	chunkUrl := chunk.urls[source]
+	report, err := r.nh.Fetch(
+		r.method,
+		chunkUrl,
+		true,
+		false,
+		nil,
+		r.progressor,
+		nil,
+		r.contextID,
+		prependElementIdentifier(prependElementIdentifier(r.initiator, r.uuid+"."+fmt.Sprint(index)+"."+fmt.Sprint(source)), "Fw.Net.Chibit.Chunk"),
+		r.options,
+		r.parentID,
+	)
+	if err != nil {
+		if report != nil {
+			report.Close()
+		}
+		return nil, nil, nil, err
+	}
+
+	var body io.Reader = report
+	var decoder io.Closer
+	if chunk.compression != "" && chunk.compression != "none" && chunk.compression != "identity" {
+		decode := r.nh.getContentDecoder(chunk.compression)
+		if decode == nil {
+			report.Close()
+			return nil, nil, nil, fmt.Errorf("unsupported compression '%s'", chunk.compression)
+		}
+		dec, err := decode(body)
+		if err != nil {
+			report.Close()
+			return nil, nil, nil, err
+		}
+		body, decoder = dec, dec
+	}
+	if limit := r.chunkLimit(index); limit >= 0 {
+		body = io.LimitReader(body, limit+1)
+	}
+	return report, body, decoder, nil
+}
+
+// Opens the current chunk from the first working source at or after `from`, skipping the bytes already read of it
+func (r *chibitReader) openChunk(from int) error {
+	r.closeChunk()
+
+	chunk := r.chunks[r.index]
+	if r.chunkHash == nil && chunk.hash != "" {
+		h, err := r.chckPtr.NewHasher(chunk.algorithm)
+		if err != nil {
+			return fmt.Errorf("unsupported hash algorithm '%s' for chunk %d: %w", chunk.algorithm, r.index, err)
+		}
+		r.chunkHash = h
+	}
+
+	var lastErr error = fmt.Errorf("no sources")
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		for source := from; source < len(chunk.urls); source++ {
+			report, body, decoder, err := r.openSource(r.index, source)
+			if err != nil {
+				lastErr = fmt.Errorf("chunk %d from %s: %w", r.index, chunk.urls[source], err)
+				continue
+			}
+
+			// Resuming, the already read part was hashed from the previous source
+			if r.chunkRead > 0 {
+				if _, err := io.CopyN(io.Discard, body, r.chunkRead); err != nil {
+					if decoder != nil {
+						decoder.Close()
+					}
+					report.Close()
+					lastErr = fmt.Errorf("chunk %d from %s: failed to resume: %w", r.index, chunk.urls[source], err)
+					continue
+				}
+			}
+
+			r.source, r.report, r.body, r.decoder = source, report, body, decoder
+			return nil
+		}
+		from = 0
+	}
+	return fmt.Errorf("all sources failed for chunk %d: %w", r.index, lastErr)
+}
+
+// Checks a read chunk against its descriptor, sum is only used if the chunk has a hash
+func (r *chibitReader) verifyChunk(index int, source int, read int64, sum string) error {
+	chunk := r.chunks[index]
+	if chunk.size > 0 && read != int64(chunk.size) {
+		return fmt.Errorf("%w: chunk %d from %s: size mismatch, got %d expected %d", ErrChibitVerification, index, chunk.urls[source], read, chunk.size)
+	}
+	if chunk.hash != "" && !strings.EqualFold(sum, chunk.hash) {
+		return fmt.Errorf("%w: chunk %d from %s: checksum mismatch", ErrChibitVerification, index, chunk.urls[source])
+	}
+	return nil
+}
+
+// Verifies the finished streamed chunk and moves on to the next
+func (r *chibitReader) endChunk() error {
+	r.closeChunk()
+
+	sum := ""
+	if r.chunkHash != nil {
+		sum = r.chckPtr.HashSum(r.chunkHash, r.chunks[r.index].algorithm)
+	}
+	if err := r.verifyChunk(r.index, r.source, r.chunkRead, sum); err != nil {
+		return err
+	}
+
+	r.nextChunk()
+	return nil
+}
+
+func (r *chibitReader) nextChunk() {
+	r.index++
+	r.chunkRead = 0
+	r.chunkHash = nil
+	if r.onChunkDone != nil {
+		r.onChunkDone()
+	}
+}
+
+// Fetches and verifies a whole chunk, trying every source ChibitChunkRetries+1 times
+func (r *chibitReader) fetchChunk(index int) ([]byte, error) {
+	chunk := r.chunks[index]
+	var lastErr error = fmt.Errorf("no sources")
+	for attempt := 0; attempt <= r.retries; attempt++ {
+		for source := range chunk.urls {
+			if r.ctx.Err() != nil {
+				return nil, r.ctx.Err()
+			}
+			report, body, decoder, err := r.openSource(index, source)
+			if err != nil {
+				lastErr = fmt.Errorf("chunk %d from %s: %w", index, chunk.urls[source], err)
+				continue
+			}
+			// Read through the limit, an oversized source stops one byte past it and fails verifyChunk
+			data, err := io.ReadAll(body)
+			if decoder != nil {
+				decoder.Close()
+			}
+			report.Close()
+			if err != nil {
+				lastErr = fmt.Errorf("chunk %d from %s: %w", index, chunk.urls[source], err)
+				continue
+			}
+
+			sum := ""
+			if chunk.hash != "" {
+				sum = r.chckPtr.HashBuff(data, chunk.algorithm)
+			}
+			if err := r.verifyChunk(index, source, int64(len(data)), sum); err != nil {
+				lastErr = err
+				continue
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("all sources failed for chunk %d: %w", index, lastErr)
+}
+
+// Keeps up to `concurrency` chunks from the current one in flight
+func (r *chibitReader) launch() {
+	for r.launched < len(r.chunks) && r.launched < r.index+r.concurrency {
+		pf := &chibitPrefetch{done: make(chan struct{})}
+		r.prefetched[r.launched] = pf
+		r.workers.Add(1)
+		go func(index int) {
+			defer r.workers.Done()
+			defer close(pf.done)
+			pf.data, pf.err = r.fetchChunk(index)
+		}(r.launched)
+		r.launched++
+	}
+}
+
+// Hands out prefetched chunks in order
+func (r *chibitReader) readPrefetched(p []byte) (int, error) {
+	for {
+		if !r.delivering {
+			if r.index >= len(r.chunks) {
+				r.stopPrefetch()
+				r.err = r.finish()
+				return 0, r.err
+			}
+			r.launch()
+			pf := r.prefetched[r.index]
+			<-pf.done
+			r.prefetched[r.index] = nil
+			if pf.err != nil {
+				r.stopPrefetch()
+				r.err = pf.err
+				return 0, r.err
+			}
+			r.pending, r.delivering = pf.data, true
+		}
+
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		r.chunkRead += int64(n)
+		r.total += int64(n)
+		if r.fileHash != nil {
+			r.fileHash.Write(p[:n])
+		}
+
+		if len(r.pending) == 0 {
+			r.pending, r.delivering = nil, false
+			r.nextChunk()
+		}
+		if n > 0 || len(p) == 0 {
+			return n, nil
+		}
+	}
+}
+
+// Verifies the assembled content once every chunk is read
+func (r *chibitReader) finish() error {
+	if r.expectSize >= 0 && r.total != r.expectSize {
+		return fmt.Errorf("%w: size mismatch, got %d expected %d", ErrChibitVerification, r.total, r.expectSize)
+	}
+	if r.fileHash != nil && !strings.EqualFold(r.chckPtr.HashSum(r.fileHash, r.checksum.algorithm), r.checksum.hash) {
+		return fmt.Errorf("%w: checksum mismatch", ErrChibitVerification)
+	}
+	return io.EOF
+}
+
+func (r *chibitReader) closeChunk() {
+	if r.decoder != nil {
+		r.decoder.Close()
+	}
+	if r.report != nil {
+		r.report.Close()
+	}
+	r.report, r.body, r.decoder = nil, nil, nil
+}
+
+// Cancels the chunks still being prefetched and waits for them to return
+func (r *chibitReader) stopPrefetch() {
+	if r.cancel != nil {
+		r.cancel()
+		r.workers.Wait()
+	}
+}
+
+func (r *chibitReader) Close() error {
+	r.closeChunk()
+	r.stopPrefetch()
+	r.pending = nil
+	if r.err == nil {
+		r.err = fmt.Errorf("chibit reader closed")
+	}
+	return nil
+}
+
+// Assembles the chunks into the requested stream/file mode through a chibitReader, the event steps once per chunk
+func (nh *NetHandler) assembleChibit(reader *chibitReader, method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string) (fwcommon.NetworkProgressReportInterface, error) {
+	event := &fwcommon.NetworkEvent{
+		ID:        fmt.Sprintf("Fw.Net.Chibit.Result:%d", fwcommon.FrameworkIndexes.GetNewOfIndex("netevent")),
+		Parent:    parentID,
+		Context:   contextID,
+		Initiator: prependElementIdentifier(initiator, "Fw.Net.Chibit.Result"),
+		Method:    method,
+		// Priority
+		NetFetchOptions:  options,
+		MetaBufferSize:   options.BufferSize,
+		MetaIsStream:     stream,
+		MetaAsFile:       file,
+		MetaDirection:    fwcommon.NetOutgoing,
+		MetaGotFirstResp: time.Now(),
+		MetaRetryAttempt: 1,
+		Status:           http.StatusOK,
+		Remote:           remoteUrl,
+		Transferred:      0,
+		Size:             reader.size(),
+		EventState:       fwcommon.NetStateTransfer,
+		EventSuccess:     true,
+		EventStepCurrent: fwcommon.Ptr(0),
+		EventStepMax:     fwcommon.Ptr(len(reader.chunks)),
+		EventStepMode:    fwcommon.EventStepManual,
+		Interrupted:      false,
+	}
+	nh.deb.NetCreate(*event)
+
+	report := &NetProgressReport{
+		Event: event,
+		Response: &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       reader,
+		},
+		progressor:    reader.progressor,
+		orgProgressor: reader.progressor,
+		errorWrapper:  nh.logThroughError,
+		debPtr:        nh.deb,
+	}
+	reader.onChunkDone = func() {
+		report.IncrSteppingCurrent()
+		if report.progressor != nil {
+			report.progressor(report, nil)
+		} else {
+			nh.debUpdateFull(report)
+		}
+	}
+
+	bufferSize := options.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 32 * 1000
+	}
+
+	return nh._outerFetchWithChibitsInterfaceMatcher(bufferSize, report, nil, stream, file, fileout)
+}
+
+// The most a non-stream chibit fetch allocates up front for the declared size, the rest grows as content arrives
+const maxChibitPrealloc = 16 * 1024 * 1024
+
+// Internal helper function made to provide the correct interface for assembled chibits
+func (nh *NetHandler) _outerFetchWithChibitsInterfaceMatcher(bufferSize int, irep fwcommon.NetworkProgressReportInterface, err error, stream bool, file bool, fileout *string) (fwcommon.NetworkProgressReportInterface, error) {
+	// Takes in a report that is stream=True, file=False, fileout=nil (reading from a chibitReader) and turns into requested
+	// If file=True and fileout!=nil we stream irep to the file, regardless of stream, so the content is never fully held in memory
+	// If stream=True and file=False we just return irep,err
+	// If stream!=True and file=False we consume irep fully, set content and return
+	if irep == nil {
+		return nil, err
+	}
+
+	progress, ok := irep.(*NetProgressReport)
+	if !ok {
+		return nil, fmt.Errorf("expected *NetProgressReport for streaming-to-file")
+	}
+
+	if file && fileout != nil {
+		f, openErr := os.Create(*fileout)
+		if openErr != nil {
+			irep.Close()
+			progress.Event.EventState = fwcommon.NetStateFailed
+			if progress.progressor != nil {
+				progress.progressor(progress, openErr)
+			} else {
+				nh.debUpdateFull(progress)
+			}
+
+			return nil, nh.logThroughError(openErr)
+		}
+
+		writeErr := writeStream(f, progress, bufferSize)
+		f.Close()
+		irep.Close()
+		if writeErr != nil {
+			// Dont leave partial or unverified content behind
+			os.Remove(*fileout)
+			return nil, nh.logThroughError(writeErr)
+		}
+
+		return irep, nil
+	}
+
+	if stream {
+		return irep, err
+	}
+
+	// STREAM = false, FILE = false: read into a buffer sized up front, the size comes from the remote entry so only a bounded part is allocated ahead
+	var buffer bytes.Buffer
+	if progress.Event.Size > 0 {
+		buffer.Grow(int(min(progress.Event.Size, maxChibitPrealloc)))
+	}
+	if _, readErr := buffer.ReadFrom(irep); readErr != nil {
+		irep.Close()
+		return nil, fmt.Errorf("failed to read chibit content: %w", readErr) // Error already handled by .Read()
+	}
+
+	// One copy, the string form is only made if GetNonStreamContent asks for it
+	progress.ContentBytes = buffer.Bytes()
+
+	// Fully consumed
+	irep.Close()
+
+	return irep, nil
+}
@@ -0,0 +1,80 @@
+package goframework_net
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Returned (wrapped) by ParseChibitURI for anything that is not a valid chibit URI
+var ErrInvalidChibitURI = errors.New("invalid chibit URI")
+
+var chibitUUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// A parsed chibit:{uuid}[@{repo}...][;{fallback}...] URI.
+// Repos are tried in order (the default repo if there are none), then the fallback URLs in order.
+type ChibitURI struct {
+	UUID      string
+	Repos     []string
+	Fallbacks []string
+}
+
+// "@" and ";" separate the parts of a chibit URI so inside repos and fallbacks they are percent-encoded
+var (
+	chibitURIEscaper   = strings.NewReplacer("@", "%40", ";", "%3B")
+	chibitURIUnescaper = strings.NewReplacer("%40", "@", "%3B", ";", "%3b", ";")
+)
+
+func IsChibitURI(uri string) bool {
+	uri = strings.TrimSpace(uri)
+	return len(uri) >= len("chibit:") && strings.EqualFold(uri[:len("chibit:")], "chibit:")
+}
+
+// Parses chibit:{uuid}, chibit:{uuid}@{repo}, chibit:{uuid};{fallback-url} and any combination with several repos and fallbacks, ex. chibit:{uuid}@{repo}@{mirror};{fallback-url}.
+// A literal "@" or ";" in a repo or fallback is written as %40 or %3B, empty repos and fallbacks are ignored.
+func ParseChibitURI(uri string) (*ChibitURI, error) {
+	if !IsChibitURI(uri) {
+		return nil, fmt.Errorf("%w: %q does not start with chibit:", ErrInvalidChibitURI, uri)
+	}
+	rest := strings.TrimSpace(uri)[len("chibit:"):]
+
+	parts := strings.Split(rest, ";")
+	locations := strings.Split(parts[0], "@")
+
+	parsed := &ChibitURI{UUID: strings.TrimSpace(locations[0])}
+	if parsed.UUID == "" {
+		return nil, fmt.Errorf("%w: %q has no uuid", ErrInvalidChibitURI, uri)
+	}
+	if !chibitUUIDPattern.MatchString(parsed.UUID) {
+		return nil, fmt.Errorf("%w: %q is not a uuid", ErrInvalidChibitURI, parsed.UUID)
+	}
+
+	for _, repo := range locations[1:] {
+		if repo = strings.TrimSpace(chibitURIUnescaper.Replace(repo)); repo != "" {
+			parsed.Repos = append(parsed.Repos, repo)
+		}
+	}
+	for _, fallback := range parts[1:] {
+		if fallback = strings.TrimSpace(chibitURIUnescaper.Replace(fallback)); fallback != "" {
+			parsed.Fallbacks = append(parsed.Fallbacks, fallback)
+		}
+	}
+	return parsed, nil
+}
+
+// The URI form of the chibit, ParseChibitURI(u.String()) gives back an equal ChibitURI
+func (u ChibitURI) String() string {
+	var sb strings.Builder
+	sb.WriteString("chibit:")
+	sb.WriteString(u.UUID)
+	for _, repo := range u.Repos {
+		sb.WriteString("@")
+		sb.WriteString(chibitURIEscaper.Replace(repo))
+	}
+	for _, fallback := range u.Fallbacks {
+		sb.WriteString(";")
+		sb.WriteString(chibitURIEscaper.Replace(fallback))
+	}
+	return sb.String()
+}
@@ -0,0 +1,90 @@
+package goframework_net
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testChibitUUID = "0b5e1a4e-3c1d-4f7a-9e2b-6d8c0f1a2b3c"
+
+func TestParseChibitURI(t *testing.T) {
+	cases := []struct {
+		uri  string
+		want *ChibitURI
+	}{
+		{"chibit:" + testChibitUUID, &ChibitURI{UUID: testChibitUUID}},
+		{" CHIBIT:" + testChibitUUID + " ", &ChibitURI{UUID: testChibitUUID}},
+		{"chibit:" + testChibitUUID + "@https://repo.example", &ChibitURI{UUID: testChibitUUID, Repos: []string{"https://repo.example"}}},
+		{"chibit:" + testChibitUUID + ";https://example.com/file.zip", &ChibitURI{UUID: testChibitUUID, Fallbacks: []string{"https://example.com/file.zip"}}},
+		{
+			"chibit:" + testChibitUUID + "@https://a.example@./local;https://b.example/f;https://c.example/f",
+			&ChibitURI{UUID: testChibitUUID, Repos: []string{"https://a.example", "./local"}, Fallbacks: []string{"https://b.example/f", "https://c.example/f"}},
+		},
+		{"chibit:" + testChibitUUID + "@;", &ChibitURI{UUID: testChibitUUID}},
+		{"chibit:" + testChibitUUID + "@https://user%40host;https://x/a%3bb", &ChibitURI{UUID: testChibitUUID, Repos: []string{"https://user@host"}, Fallbacks: []string{"https://x/a;b"}}},
+	}
+	for _, c := range cases {
+		got, err := ParseChibitURI(c.uri)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.uri, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %+v, want %+v", c.uri, got, c.want)
+		}
+	}
+
+	for _, uri := range []string{
+		"",
+		"https://example.com",
+		"chibit:",
+		"chibit:@https://repo.example",
+		"chibit:;https://example.com/file.zip",
+		"chibit:not-a-uuid@https://repo.example",
+		"chibit:" + testChibitUUID + "0",
+	} {
+		if _, err := ParseChibitURI(uri); !errors.Is(err, ErrInvalidChibitURI) {
+			t.Errorf("%q: expected ErrInvalidChibitURI, got %v", uri, err)
+		}
+	}
+
+	uri := ChibitURI{UUID: testChibitUUID, Repos: []string{"https://user@host/repo"}, Fallbacks: []string{"https://x/a;b"}}
+	if got := uri.String(); got != "chibit:"+testChibitUUID+"@https://user%40host/repo;https://x/a%3Bb" {
+		t.Errorf("unexpected String(): %s", got)
+	}
+}
+
+func FuzzParseChibitURI(f *testing.F) {
+	for _, seed := range []string{
+		"chibit:" + testChibitUUID,
+		"chibit:" + testChibitUUID + "@https://repo.example",
+		"chibit:" + testChibitUUID + "@https://a.example@b;https://c.example;d",
+		"chibit:" + testChibitUUID + "@%40%3B%3b;;@",
+		"chibit:@;",
+		"chibit:",
+		"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, uri string) {
+		parsed, err := ParseChibitURI(uri)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidChibitURI) {
+				t.Fatalf("%q: error does not wrap ErrInvalidChibitURI: %v", uri, err)
+			}
+			return
+		}
+		if !chibitUUIDPattern.MatchString(parsed.UUID) {
+			t.Fatalf("%q: accepted invalid uuid %q", uri, parsed.UUID)
+		}
+
+		again, err := ParseChibitURI(parsed.String())
+		if err != nil {
+			t.Fatalf("%q: String() %q does not parse: %v", uri, parsed.String(), err)
+		}
+		if !reflect.DeepEqual(parsed, again) {
+			t.Fatalf("%q: round trip through %q gave %+v, want %+v", uri, parsed.String(), again, parsed)
+		}
+	})
+}
@@ -2,11 +2,9 @@ package goframework_net
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
-	"os"
-	"strings"
 
 	fwcommon "github.com/sbamboo/goframework/common"
 )
@@ -21,296 +19,114 @@ func prependElementIdentifier(initiator *fwcommon.ElementIdentifier, prefix stri
 	return &new
 }
 
-// Internal helper function made to provide the correct interface from fallbacks when using `Fetch()`
-func (nh *NetHandler) _outerFetchWithChibitsInterfaceMatcher(bufferSize int, irep fwcommon.NetworkProgressReportInterface, err error, stream bool, file bool, fileout *string) (fwcommon.NetworkProgressReportInterface, error) {
-	// Takes in a report that is stream=False, file=False, fileout=nil and turns into requested
-	if irep == nil {
-		return nil, err
-	}
-
-	// If stream!=True and file=True and fileout!=nil
-	// If stream!=True and file=False
-	// If stream=True and file=True and fileout!=nil
-	// If stream=True and file=False
+func (nh *NetHandler) FetchWithChibits(method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, defaultChibitRepo *string, chckPtr fwcommon.ChckInterface, parentID *string) (fwcommon.NetworkProgressReportInterface, error) {
+	// Check if the remoteURL is using the chibit protocol if not call Fetch, see ParseChibitURI for the format
 
-	progress, ok := irep.(*NetProgressReport)
-	if !ok {
-		return nil, fmt.Errorf("expected *NetProgressReport for streaming-to-file")
-	}
+	// Non chibit, call Fetch
+	if !IsChibitURI(remoteUrl) {
+		return nh.Fetch(method, remoteUrl, stream, file, fileout, progressor, body, contextID, initiator, options, parentID)
+	} else {
+		// If options is nil set options to point to nh.config.NetFetchOptions
+		if options == nil {
+			options = nh.config.NetFetchOptions
+		}
 
-	if !stream && !file {
-		progress.Event.Transferred = progress.Event.Size
-		return irep, err
-	}
+		uri, err := ParseChibitURI(remoteUrl)
+		if err != nil {
+			return nil, nh.logThroughError(err)
+		}
+		repos := uri.Repos
+		if len(repos) == 0 && defaultChibitRepo != nil && *defaultChibitRepo != "" {
+			repos = []string{*defaultChibitRepo}
+		}
 
-	if stream && !file {
-		progress.Event.MetaIsStream = true
-		return irep, err
+		// Everything fetched for the chibit hangs under one event that finishes with the outcome
+		ce := nh.openChibitEvent(method, remoteUrl, contextID, initiator, options, parentID)
+		report, err := nh.resolveChibit(uri, repos, ce, method, stream, file, fileout, progressor, body, contextID, initiator, options, chckPtr)
+		return ce.finishWith(report, err, stream && !file)
 	}
+}
 
-	if file && fileout != nil {
-		f, openErr := os.Create(*fileout)
-		if openErr != nil {
-
-			progress.Event.EventState = fwcommon.NetStateFailed
-			if progress.progressor != nil {
-				progress.progressor(progress, openErr)
-			} else {
-				nh.debUpdateFull(progress)
-			}
-
-			return nil, nh.logThroughError(openErr)
+// Resolves the chibit through the repos (then the fallbacks) and fetches its content, everything under the chibit event
+func (nh *NetHandler) resolveChibit(uri *ChibitURI, repos []string, ce *chibitEvent, method fwcommon.HttpMethod, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, chckPtr fwcommon.ChckInterface) (fwcommon.NetworkProgressReportInterface, error) {
+	// The first repo that resolves the uuid is used
+	var entry *ChibitEntry
+	err := fmt.Errorf("no chibit repo given")
+	var repoErrs []error
+	for _, repo := range repos {
+		entry, err = nh.FetchChibitUUID(uri.UUID, progressor, contextID, initiator, options, repo, ce.id())
+		if err == nil && entry != nil {
+			break
 		}
-		defer f.Close()
-
-		if stream {
-			// STREAM = true, FILE = true: write to file while streaming
-			writeErr := writeStream(f, progress, bufferSize)
-			if writeErr != nil {
-				irep.Close()
-				return nil, nh.logThroughError(writeErr)
-			}
-
-			// Fully consumed, close the original body
-			irep.Close()
-
-			return irep, nil
-
-		} else {
-			// STREAM = false, FILE = true: io.Readall then write to f
-			bodyBytes, readErr := io.ReadAll(irep)
-			if readErr != nil {
-				return irep, fmt.Errorf("failed to read response body: %w", readErr) // Error already handled by .Read() in .ReadAll()
-			}
-
-			_, writeErr := f.Write(bodyBytes)
-			if writeErr != nil {
-				progress.Event.EventState = fwcommon.NetStateFailed
-				if progress.progressor != nil {
-					progress.progressor(progress, fmt.Errorf("failed to write to file %s: %w", *fileout, writeErr))
-				} else {
-					nh.debUpdateFull(progress)
-				}
-				return irep, nh.logThroughError(fmt.Errorf("failed to write to file %s: %w", *fileout, writeErr))
+		repoErrs = append(repoErrs, fmt.Errorf("%s: %w", repo, err))
+	}
+	if err != nil && len(repoErrs) > 1 {
+		err = errors.Join(repoErrs...)
+	}
+	if err != nil || entry == nil {
+		// Failed to fetch entry, use the fallbacks in order
+		for i, fallback := range uri.Fallbacks {
+			report, fallbackErr := nh.Fetch(method, fallback, stream, file, fileout, progressor, body, contextID, prependElementIdentifier(initiator, "Fw.Net.Chibit.Fallback"), options, ce.id())
+			if fallbackErr == nil || i == len(uri.Fallbacks)-1 {
+				return report, fallbackErr
 			}
-
-			// Fully consumed, close the original body
-			irep.Close()
-
-			return irep, nil
 		}
+		return nil, nh.logThroughError(fmt.Errorf("Failed to fetch chibit repo, and no fallback provided: %w", err))
 	}
-	
-	return irep,err
-}
-
-func (nh *NetHandler) FetchWithChibits(method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, defaultChibitRepo *string, chckPtr fwcommon.ChckInterface, parentID *string) (fwcommon.NetworkProgressReportInterface, error) {
-	// Check if the remoteURL is using the chibit protocol if not call Fetch
-
-	// chibit:{chibit-uuid}
-	// chibit:{chibit-uuid}@{repo-url}
-	// chibit:{chibit-uuid};{fallback-url}
-	// chibit:{chibit-uuid}@{repo-url};{fallback-url}
 
-	// Non chibit, call Fetch
-	if !strings.HasPrefix(remoteUrl, "chibit:") {
-		return nh.Fetch(method, remoteUrl, stream, file, fileout, progressor, body, contextID, initiator, options, parentID)
-	} else {
-		var fallback *string
-		chibitRepo := defaultChibitRepo
-		uuid := strings.TrimPrefix(strings.TrimSpace(remoteUrl), "chibit:")
-		if strings.Contains(uuid, "@") {
-			parts := strings.Split(uuid, "@")
-			uuid = parts[0]
-			if len(parts) > 1 {
-				if parts[1] != "" {
-					chibitRepo = &parts[1]
-				}
-			}
-			if strings.Contains(parts[1], ";") {
-				parts2 := strings.Split(parts[1], ";")
-				chibitRepo = &parts2[0]
-				if len(parts) > 1 {
-					fallback = &parts2[1]
-				}
-			}
-		}
+	// Signed entries (and indexes) are verified before anything they point to is fetched
+	if err := nh.VerifyChibitEntry(entry, options, chckPtr); err != nil {
+		return nil, nh.logThroughError(err)
+	}
 
-		debEventId := fmt.Sprintf("Fw.Net.Chibit:%d", fwcommon.FrameworkIndexes.GetNewOfIndex("netevent"))
-		debEvent := fwcommon.NetworkEvent{
-			ID: debEventId,
-			Parent: parentID,
-			Remote: remoteUrl,
-			Interrupted: true,
-			EventSuccess: true,
-			EventState: fwcommon.NetStateFinished,
-			EventStepCurrent: fwcommon.Ptr(1),
-			EventStepMax: fwcommon.Ptr(1),
-			Status: 200,
+	switch entry.metadata.chibitType {
+	case Redirect:
+		// Targets are checked against the redirect policy and tried in order
+		report, err := nh.fetchChibitRedirect(entry, method, stream, file, fileout, progressor, body, contextID, initiator, options, ce.id())
+		if err != nil {
+			return nil, nh.logThroughError(err)
 		}
-		nh.deb.NetCreate(debEvent)
-		nh.deb.NetStop(debEvent.ID)
-
-		entry, err := nh.FetchChibitUUID(uuid, progressor, contextID, initiator, options, *chibitRepo, fwcommon.Ptr(debEventId))
-		if err != nil || entry == nil {
-			if fallback != nil {
-				// Failed to fetch entry, use fallback
-				return nh.Fetch(method, *fallback, stream, file, fileout, progressor, body, contextID, prependElementIdentifier(initiator, "Fw.Net.Chibit.Fallback"), options, fwcommon.Ptr(debEventId))
-			} else {
-				return nil, nh.logThroughError(fmt.Errorf("Failed to fetch chibit repo, and no fallback provided."))
+		return report, nil
+
+	case Single, Split:
+		// V1 chunks are single URLs verified only through the whole-file size and checksum
+		chunks := entry.metadata.chunkDescs
+		expectSize := int64(entry.metadata.size)
+		if chibitMajor(entry.metadata.chibitVersion) == 1 {
+			chunks = make([]ChibitChunk, len(entry.metadata.chunks))
+			for i, chunkUrl := range entry.metadata.chunks {
+				chunks[i] = ChibitChunk{urls: []string{chunkUrl}}
 			}
+		} else if expectSize <= 0 {
+			expectSize = -1
 		}
-
-		localParentID := entry.evID
-		if localParentID == nil || *localParentID == "" {
-			localParentID = parentID
+		// Chunk urls (and HTTP redirects of their fetches) are held to the same policy as redirect targets
+		chunks, err := allowedChibitChunks(entry.url, chunks, options)
+		if err != nil {
+			return nil, nh.logThroughError(err)
 		}
 
-		// If entry resolved to a redirection url we fetch that
-		if entry.redirUrl != "" {
-			return nh.Fetch(method, entry.redirUrl, stream, file, fileout, progressor, body, contextID, prependElementIdentifier(initiator, "Fw.Net.Chibit.Redirect"), options, fwcommon.Ptr(debEventId))
-		} else {
-
-			// Else we use metadata + chunks to resolve actuall
-
-			// For V1 we fetch each chunk in order accumulate them in a buffer then compares size and checksum using chck.ChckStr(content string, sum string, algo fwcommon.HashAlgorithm)
-			switch entry.metadata.chibitType {
-			case Redirect:
-				return nh.Fetch(
-					method,
-					entry.metadata.chunks[0],
-					stream,
-					file,
-					fileout,
-					progressor,
-					body,
-					contextID,
-					prependElementIdentifier(initiator, "Fw.Net.Chibit.Redirect"),
-					options,
-					localParentID,
-				)
-		
-			case Single, Split:
-				var buffer []byte
-				totalSize := 0
-			
-				// Fetch chunks in order
-				for i, chunkUrl := range entry.metadata.chunks {
-					chunkReport, err := nh.Fetch(
-						method,
-						chunkUrl,
-						false,
-						false,
-						nil,
-						progressor,
-						nil,
-						contextID,
-						prependElementIdentifier(prependElementIdentifier(initiator, uuid + "." + fmt.Sprint(i)), "Fw.Net.Chibit.Chunk"),
-						options,
-						localParentID,
-					)
-					if err != nil {
-						return nil, err
-					}
-			
-					chunkContent := chunkReport.GetNonStreamBytes()
-					if chunkContent == nil {
-						return nil, nh.logThroughError(fmt.Errorf("Chunk returned no content"))
-					}
-			
-					buffer = append(buffer, chunkContent...)
-					totalSize += len(chunkContent)
-				}
-			
-				// Size check
-				if totalSize != entry.metadata.size {
-					return nil, nh.logThroughError(fmt.Errorf("Chibit size mismatch"))
-				}
-			
-				// Checksum check using binary-safe ChckBuff
-				if !chckPtr.ChckBuff(
-					buffer,
-					entry.metadata.checksum.hash,
-					entry.metadata.checksum.algorithm,
-				) {
-					return nil, nh.logThroughError(fmt.Errorf("Chibit checksum mismatch"))
-				}
-			
-				// Build response using buffer directly
-				event := &fwcommon.NetworkEvent{
-					// ID
-					Parent: localParentID,
-					Context: contextID,
-					Initiator: prependElementIdentifier(initiator, "Fw.Net.Chibit.Result"),
-					Method: method,
-					// Priority
-					NetFetchOptions: options,
-					MetaBufferSize: options.BufferSize,
-					MetaIsStream: stream,
-					MetaAsFile: file,
-					MetaDirection: fwcommon.NetOutgoing,
-					// MetaSpeed
-					// MetaTimeToCon
-					// MetaTimeToFirstByte
-					// MetaGotFirstResp
-					MetaRetryAttempt: 1,
-					// Status
-					// ClientIP
-					Remote: remoteUrl,
-					// RemoteIP
-					// Protocol
-					// Scheme
-					// ContentType
-					// Headers
-					// RespHeaders
-					Transferred: 0,
-					Size: int64(len(buffer)),
-					EventState:  fwcommon.NetStateFinished,
-					EventSuccess: true,
-					// EventStepCurrent
-					// EventStepMax
-					EventStepMode: options.EventStepMode,
-					Interrupted: false,
-				}
-			
-				// Wrap buffer as an io.ReadCloser for http.Response.Body
-				bodyReader := io.NopCloser(strings.NewReader(string(buffer)))
-			
-				// Optional: store as string if needed for compatibility
-				finalContent := string(buffer)
-			
-				report := &NetProgressReport{
-					Event:    event,
-					Response: &http.Response{
-						StatusCode: http.StatusOK,
-						Body:       bodyReader,
-					},
-					Content:       &finalContent,
-					progressor:    progressor,
-					orgProgressor: progressor,
-					errorWrapper:  nh.logThroughError,
-					debPtr:        nh.deb,
-				}
-
-				bufferSize := options.BufferSize
-				if bufferSize <= 0 {
-					bufferSize = 32 * 1000
-				}
-
-				return nh._outerFetchWithChibitsInterfaceMatcher(bufferSize, report, nil, stream, file, fileout)
-			}
-
-			// For V2 ...
-
-			return nil, nil
+		reader, err := nh.newChibitReader(chunks, expectSize, entry.metadata.checksum, uri.UUID, method, progressor, contextID, initiator, withChibitPolicy(options, entry.url), ce.id(), chckPtr)
+		if err != nil {
+			return nil, nh.logThroughError(err)
 		}
+		return nh.assembleChibit(reader, method, uri.String(), stream, file, fileout, contextID, initiator, options, ce.id())
 	}
+
+	return nil, nh.logThroughError(fmt.Errorf("Unknown chibit type %s", entry.metadata.chibitType))
 }
 
+// Returned (wrapped) when chibit content or metadata does not match its checksum, size or signature
+var ErrChibitVerification = errors.New("chibit verification failed")
+
 type ChibitEntry struct {
-	redirUrl string
+	uuid string // The UUID the entry was requested as
+	url string // Where the entry was fetched from, redirect targets are checked against it
 	metadata ChibitMetadata
 	evID *string
+	content []byte // The entry as fetched, what a detached signature covers
+	signature *ChibitSignature // Detached signature, only fetched when signatures are verified
+	index *chibitIndex // The index the entry was found in
 }
 
 type ChibitChecksumEntry struct {
@@ -333,6 +149,7 @@ const (
 )
 
 type ChibitMetadata struct {
+	uuid string // The UUID the entry names itself, empty in entries written before it was recorded
 	filename string
 	checksum ChibitChecksumEntry
 	size int
@@ -340,11 +157,13 @@ type ChibitMetadata struct {
 	chunks []string // Urls to chunks (ORDERED) | single url | redirect url
 	maxSize int
 	chibitVersion ChibitVersionId
+	// V2
+	chunkDescs []ChibitChunk
+	signature *ChibitSignature
+	signedBytes []byte // Canonical entry bytes the signature covers
 }
 
 func (nh *NetHandler) FetchChibitUUID(uuid string, progressor fwcommon.ProgressorFn, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, chibitRepo string, parentID *string) (*ChibitEntry, error) {
-	entry := &ChibitEntry{}
-	
 	// For V1 we fetch {repo}/chibits/chibits.json which is {"uuid": "entry-json-url"} then fetch that into V1ChibitEntry
 	// Example entry JSON
 	//     {
@@ -363,39 +182,68 @@ func (nh *NetHandler) FetchChibitUUID(uuid string, progressor fwcommon.Progresso
 	// 	       "chibit-version": "1.0"
 	//     }
 	// Note chunks IS ORDERED
-	indexUrl := chibitRepo + "/chibits/chibits.json"
-	indexReport, err := nh.Fetch(
-		fwcommon.MethodGet,
-		indexUrl,
-		false,
-		false,
-		nil,
-		progressor,
-		nil,
-		contextID,
-		fwcommon.Ptr(fwcommon.ElementIdentifier("Fw.Net.Chibit.Index::" + uuid)),
-		options,
-		parentID,
-	)
+	if options == nil {
+		options = nh.config.NetFetchOptions
+	}
+
+	index, err := nh.fetchChibitIndex(chibitRepo, uuid, progressor, contextID, options, parentID)
 	if err != nil {
 		return nil, err
 	}
+	return nh.fetchChibitEntry(uuid, index, progressor, contextID, options, parentID)
+}
 
-	indexContent := indexReport.GetNonStreamContent()
-	if indexContent == nil {
-		return nil, fmt.Errorf("Index fetch returned no content")
+// Resolves many UUIDs against a single fetch of the repo index, UUIDs that failed are left out of the map and their errors joined
+func (nh *NetHandler) FetchChibitUUIDs(uuids []string, progressor fwcommon.ProgressorFn, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, chibitRepo string, parentID *string) (map[string]*ChibitEntry, error) {
+	if options == nil {
+		options = nh.config.NetFetchOptions
 	}
 
-	var index map[string]string
-	if err := json.Unmarshal([]byte(*indexContent), &index); err != nil {
+	index, err := nh.fetchChibitIndex(chibitRepo, "Batch", progressor, contextID, options, parentID)
+	if err != nil {
 		return nil, err
 	}
 
-	entryUrl, ok := index[uuid]
+	entries := make(map[string]*ChibitEntry, len(uuids))
+	var errs []error
+	for _, uuid := range uuids {
+		entry, err := nh.fetchChibitEntry(uuid, index, progressor, contextID, options, parentID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", uuid, err))
+			continue
+		}
+		entries[uuid] = entry
+	}
+	return entries, errors.Join(errs...)
+}
+
+// Fetches and parses the entry of a UUID listed in the index
+func (nh *NetHandler) fetchChibitEntry(uuid string, index *chibitIndex, progressor fwcommon.ProgressorFn, contextID *string, options *fwcommon.NetFetchOptions, parentID *string) (*ChibitEntry, error) {
+	entry := &ChibitEntry{}
+
+	indexValue, ok := index.entries[uuid]
 	if !ok {
 		return nil, fmt.Errorf("Chibit UUID not found")
 	}
 
+	// Either a plain entry url or one per chibit-version to negotiate from
+	entryUrl, err := selectChibitEntryUrl(indexValue)
+	if err != nil {
+		return nil, err
+	}
+	// Relative entry urls are relative to the index so a repo can be served from anywhere
+	entryUrl = resolveChibitUrl(index.url, entryUrl)
+	if err := checkChibitUrl(index.url, entryUrl, options); err != nil {
+		return nil, err
+	}
+	entryOptions := withChibitPolicy(options, index.url)
+
+	// Entries hang under the index fetch, or the caller if the index came from the cache
+	entryParentID := parentID
+	if index.eventID != nil {
+		entryParentID = index.eventID
+	}
+
 	entryReport, err := nh.Fetch(
 		fwcommon.MethodGet,
 		entryUrl,
@@ -406,79 +254,108 @@ func (nh *NetHandler) FetchChibitUUID(uuid string, progressor fwcommon.Progresso
 		nil,
 		contextID,
 		fwcommon.Ptr(fwcommon.ElementIdentifier("Fw.Net.Chibit.Entry::" + uuid)),
-		options,
-		&indexReport.GetNetworkEvent().ID,
+		entryOptions,
+		entryParentID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	entry.evID = &entryReport.GetNetworkEvent().ID
+	entry.uuid = uuid
+	entry.url = entryUrl
+	entry.index = index
 
 	entryContent := entryReport.GetNonStreamContent()
 	if entryContent == nil {
 		return nil, fmt.Errorf("Entry fetch returned no content")
 	}
+	entry.content = []byte(*entryContent)
+
+	if chibitSignaturesWanted(options) {
+		entry.signature, err = nh.fetchChibitDetachedSignature(entryUrl, uuid, progressor, contextID, entryOptions, entry.evID)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	var raw map[string]any
 	if err := json.Unmarshal([]byte(*entryContent), &raw); err != nil {
 		return nil, err
 	}
 
-	version := ChibitVersionId(raw["chibit-version"].(string))
-
-	switch version {
-	case V1_0, V1_1:
-		v1 := &ChibitMetadata{}
-
-		v1.filename = raw["filename"].(string)
-		v1.size = int(raw["size"].(float64))
-		v1.chibitType = V1ChibitType(raw["type"].(string))
-		v1.maxSize = int(raw["max-size"].(float64))
-		v1.chibitVersion = version
-
-		v1.checksum = ChibitChecksumEntry{}
-		checksumRaw := raw["checksum"].(map[string]any)
-		v1.checksum.algorithm = fwcommon.HashAlgorithm(checksumRaw["algorithm"].(string))
-
-		// Safely extract the hash and convert it to its integer string representation
-		switch v1.checksum.algorithm {
-			case fwcommon.CRC32:
-				// JSON unmarshals large integers as float64 by default when using interface{}
-				if hashFloat, ok := checksumRaw["hash"].(float64); ok {
-					v1.checksum.hash = fmt.Sprint(uint32(hashFloat)) // Convert float to uint32, then to string
-				} else if hashStr, ok := checksumRaw["hash"].(string); ok {
-					// In case the hash was already a string in the JSON
-					v1.checksum.hash = hashStr
-				} else {
-					// Handle other unexpected types or errors
-					return nil, fmt.Errorf("unexpected type for CRC32 hash: %T", checksumRaw["hash"])
-				}
-			case fwcommon.SHA1, fwcommon.SHA256:
-				// These are typically strings already
-				if hashStr, ok := checksumRaw["hash"].(string); ok {
-					v1.checksum.hash = hashStr
-				} else {
-					return nil, fmt.Errorf("unexpected type for SHA hash: %T", checksumRaw["hash"])
-				}
-			default:
-				// Fallback for other hash types if any, or error
-				return nil, fmt.Errorf("unsupported hash algorithm for parsing: %s", v1.checksum.algorithm)
-		}
+	versionStr, ok := raw["chibit-version"].(string)
+	if !ok {
+		return nil, fmt.Errorf("Chibit entry has no chibit-version")
+	}
+	version := ChibitVersionId(versionStr)
 
-		for _, c := range raw["chunks"].([]any) {
-			v1.chunks = append(v1.chunks, c.(string))
+	switch chibitMajor(version) {
+	case 1:
+		v1, err := parseChibitV1Entry([]byte(*entryContent), entryUrl, version)
+		if err != nil {
+			return nil, err
 		}
 
 		entry.metadata = *v1
 
-		if v1.chibitType == Redirect && len(v1.chunks) > 0 {
-			entry.redirUrl = v1.chunks[0]
+		return entry, entry.checkUUID()
+
+	case 2:
+		v2, err := parseChibitV2Entry([]byte(*entryContent), entryUrl, version)
+		if err != nil {
+			return nil, err
 		}
 
-		return entry, nil
+		entry.metadata = *v2
+
+		return entry, entry.checkUUID()
+	}
+
+	return nil, fmt.Errorf("Unsupported chibit-version %s", version)
+}
+
+func parseChibitV1Entry(content []byte, entryUrl string, version ChibitVersionId) (*ChibitMetadata, error) {
+	var v1 chibitV1EntryJSON
+	if err := json.Unmarshal(content, &v1); err != nil {
+		return nil, fmt.Errorf("invalid V1 chibit entry: %w", err)
 	}
 
-	// For V2 ...
+	meta := &ChibitMetadata{
+		uuid:          v1.UUID,
+		filename:      v1.Filename,
+		size:          int(v1.Size),
+		chibitType:    V1ChibitType(v1.Type),
+		maxSize:       int(v1.MaxSize),
+		chibitVersion: version,
+		checksum:      ChibitChecksumEntry{algorithm: fwcommon.HashAlgorithm(v1.Checksum.Algorithm)},
+	}
 
-	return entry, nil
-}
\ No newline at end of file
+	// crc32 hashes are written as a number (decoded as float64), sha hashes as strings
+	switch meta.checksum.algorithm {
+	case fwcommon.CRC32:
+		switch hash := v1.Checksum.Hash.(type) {
+		case float64:
+			meta.checksum.hash = fmt.Sprint(uint32(hash))
+		case string:
+			meta.checksum.hash = hash
+		default:
+			return nil, fmt.Errorf("unexpected type for CRC32 hash: %T", v1.Checksum.Hash)
+		}
+	case fwcommon.SHA1, fwcommon.SHA256:
+		hash, ok := v1.Checksum.Hash.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type for SHA hash: %T", v1.Checksum.Hash)
+		}
+		meta.checksum.hash = hash
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm for parsing: %s", meta.checksum.algorithm)
+	}
+
+	for _, c := range v1.Chunks {
+		meta.chunks = append(meta.chunks, resolveChibitUrl(entryUrl, c))
+	}
+	if meta.chibitType == Redirect && len(meta.chunks) == 0 {
+		return nil, fmt.Errorf("V1 redirect chibit has no urls")
+	}
+	return meta, nil
+}
@@ -0,0 +1,32 @@
+package goframework_net
+
+import "testing"
+
+func TestParseChibitV1Entry(t *testing.T) {
+	entry, err := parseChibitV1Entry([]byte(`{"uuid": "u", "filename": "f", "size": 3, "type": "split", "max-size": 2, "checksum": {"algorithm": "crc32", "hash": 4157704578}, "chunks": ["1.chunk", "https://cdn.example/2.chunk"], "chibit-version": "1.0"}`), "https://repo.example/chibits/entries/u.json", V1_0)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if entry.checksum.hash != "4157704578" || entry.size != 3 || len(entry.chunks) != 2 || entry.chunks[0] != "https://repo.example/chibits/entries/1.chunk" {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+
+	// Malformed entries are errors, never panics
+	for _, content := range []string{
+		`{"filename": 1, "checksum": {"algorithm": "sha256", "hash": ""}}`,
+		`{"size": "big", "checksum": {"algorithm": "sha256", "hash": ""}}`,
+		`{"type": ["split"], "checksum": {"algorithm": "sha256", "hash": ""}}`,
+		`{"max-size": {}, "checksum": {"algorithm": "sha256", "hash": ""}}`,
+		`{"checksum": "sha256"}`,
+		`{}`,
+		`{"checksum": {"algorithm": "sha256", "hash": 5}}`,
+		`{"checksum": {"algorithm": "crc32", "hash": []}}`,
+		`{"checksum": {"algorithm": "sha256", "hash": ""}, "chunks": [1]}`,
+		`{"checksum": {"algorithm": "sha256", "hash": ""}, "chunks": "1.chunk"}`,
+		`{"type": "redirect", "checksum": {"algorithm": "sha256", "hash": ""}}`,
+	} {
+		if _, err := parseChibitV1Entry([]byte(content), "https://repo.example/e.json", V1_0); err == nil {
+			t.Errorf("%s: expected an error", content)
+		}
+	}
+}
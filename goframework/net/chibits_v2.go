@@ -0,0 +1,245 @@
+package goframework_net
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Versions this handler can read, the highest one offered by an index is used
+var supportedChibitVersions = []ChibitVersionId{V2_0, V1_1, V1_0}
+
+// Returns the major version of a "chibit-version" field, minor versions are forward compatible within a major
+func chibitMajor(version ChibitVersionId) int {
+	major, _, _ := strings.Cut(string(version), ".")
+	n, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// An index value is either the entry URL or an object mapping "chibit-version" to entry URLs, for the latter we pick the highest version we support
+func selectChibitEntryUrl(raw json.RawMessage) (string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single, nil
+	}
+
+	var offered map[string]string
+	if err := json.Unmarshal(raw, &offered); err != nil {
+		return "", fmt.Errorf("invalid chibit index value: %w", err)
+	}
+
+	versions := make([]string, 0, len(offered))
+	for v := range offered {
+		versions = append(versions, v)
+	}
+	// Highest version first
+	sort.Slice(versions, func(i, j int) bool {
+		mi, mj := chibitMajor(ChibitVersionId(versions[i])), chibitMajor(ChibitVersionId(versions[j]))
+		if mi != mj {
+			return mi > mj
+		}
+		return versions[i] > versions[j]
+	})
+	for _, v := range versions {
+		for _, supported := range supportedChibitVersions {
+			if chibitMajor(ChibitVersionId(v)) == chibitMajor(supported) {
+				return offered[v], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no supported chibit version offered (offered %v)", versions)
+}
+
+// A V2 chunk, the hash is of the (decompressed) chunk content and doubles as its content address
+type ChibitChunk struct {
+	hash        string
+	algorithm   fwcommon.HashAlgorithm
+	size        int
+	compression string
+	urls        []string // Explicit mirrors first, then the content-addressed URL on each chunk base
+}
+
+type ChibitSignature struct {
+	algorithm fwcommon.SigAlgorithm
+	keyID     string
+	value     []byte
+}
+
+// Hashes are hex strings, except crc32 which V1 wrote as a number, both are accepted
+type chibitHash string
+
+func (h *chibitHash) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*h = chibitHash(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("hash must be a string or number: %w", err)
+	}
+	*h = chibitHash(n.String())
+	return nil
+}
+
+type chibitV2ChunkJSON struct {
+	Hash        chibitHash `json:"hash"`
+	Algorithm   string     `json:"algorithm,omitempty"`
+	Size        int        `json:"size"`
+	Compression string     `json:"compression,omitempty"`
+	Urls        []string   `json:"urls,omitempty"`
+}
+
+type chibitChecksumJSON struct {
+	Algorithm string     `json:"algorithm"`
+	Hash      chibitHash `json:"hash"`
+}
+
+type chibitSignatureJSON struct {
+	Algorithm string `json:"algorithm"`
+	KeyID     string `json:"key-id,omitempty"`
+	Value     string `json:"value"`
+}
+
+type chibitV2EntryJSON struct {
+	UUID       string               `json:"uuid,omitempty"` // The UUID the entry is published under, covered by its signature
+	Version    string               `json:"chibit-version"`
+	Filename   string               `json:"filename"`
+	Size       int                  `json:"size"`
+	Type       string               `json:"type,omitempty"`
+	MaxSize    int                  `json:"max-size,omitempty"`
+	Checksum   *chibitChecksumJSON  `json:"checksum,omitempty"`
+	ChunkBases []string             `json:"chunk-bases,omitempty"`
+	Chunks     []chibitV2ChunkJSON  `json:"chunks,omitempty"`
+	Urls       []string             `json:"urls,omitempty"` // Redirect targets, in order of preference
+	Signature  *chibitSignatureJSON `json:"signature,omitempty"`
+}
+
+// The bytes an embedded signature covers: the entry without its "signature" field, re-encoded by encoding/json (sorted keys, no whitespace)
+func ChibitCanonicalEntry(entryJSON []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(entryJSON))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	delete(raw, "signature")
+	return json.Marshal(raw)
+}
+
+// Resolves a (possibly relative) URL found in an index or entry against the URL of that index or entry
+func resolveChibitUrl(parentUrl string, ref string) string {
+	refUrl, err := url.Parse(ref)
+	if err != nil || refUrl.IsAbs() {
+		return ref
+	}
+	parent, err := url.Parse(parentUrl)
+	if err != nil {
+		return ref
+	}
+	return parent.ResolveReference(refUrl).String()
+}
+
+// Resolves a (possibly relative) chunk base against the entry URL and appends the content address
+func chibitContentUrl(entryUrl string, base string, hash string, compression string) string {
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	return resolveChibitUrl(entryUrl, base+chibitChunkName(hash, compression))
+}
+
+// The content address of a chunk, {hash} or {hash}.{compression} since the same content is stored differently per compression
+func chibitChunkName(hash string, compression string) string {
+	if compression == "" || compression == "none" || compression == "identity" {
+		return hash
+	}
+	return hash + "." + compression
+}
+
+func parseChibitV2Entry(content []byte, entryUrl string, version ChibitVersionId) (*ChibitMetadata, error) {
+	var v2 chibitV2EntryJSON
+	if err := json.Unmarshal(content, &v2); err != nil {
+		return nil, fmt.Errorf("invalid V2 chibit entry: %w", err)
+	}
+
+	meta := &ChibitMetadata{
+		uuid:          v2.UUID,
+		filename:      v2.Filename,
+		size:          v2.Size,
+		maxSize:       v2.MaxSize,
+		chibitVersion: version,
+		chibitType:    Split,
+	}
+
+	if v2.Checksum != nil {
+		meta.checksum = ChibitChecksumEntry{
+			algorithm: fwcommon.HashAlgorithm(strings.ToLower(v2.Checksum.Algorithm)),
+			hash:      string(v2.Checksum.Hash),
+		}
+	}
+
+	if V1ChibitType(v2.Type) == Redirect {
+		if len(v2.Urls) == 0 {
+			return nil, fmt.Errorf("V2 redirect chibit has no urls")
+		}
+		meta.chibitType = Redirect
+		for _, u := range v2.Urls {
+			meta.chunks = append(meta.chunks, resolveChibitUrl(entryUrl, u))
+		}
+	} else {
+		if len(v2.Chunks) == 0 {
+			return nil, fmt.Errorf("V2 chibit has no chunks")
+		}
+		if len(v2.Chunks) == 1 {
+			meta.chibitType = Single
+		}
+		for i, c := range v2.Chunks {
+			chunk := ChibitChunk{
+				hash:        strings.ToLower(string(c.Hash)),
+				algorithm:   fwcommon.HashAlgorithm(strings.ToLower(c.Algorithm)),
+				size:        c.Size,
+				compression: strings.ToLower(c.Compression),
+			}
+			for _, u := range c.Urls {
+				chunk.urls = append(chunk.urls, resolveChibitUrl(entryUrl, u))
+			}
+			if chunk.algorithm == "" {
+				chunk.algorithm = fwcommon.SHA256
+			}
+			if chunk.hash == "" {
+				return nil, fmt.Errorf("V2 chibit chunk %d has no hash", i)
+			}
+			for _, base := range v2.ChunkBases {
+				chunk.urls = append(chunk.urls, chibitContentUrl(entryUrl, base, chunk.hash, chunk.compression))
+			}
+			if len(chunk.urls) == 0 {
+				return nil, fmt.Errorf("V2 chibit chunk %d has no urls and the entry no chunk-bases", i)
+			}
+			meta.chunkDescs = append(meta.chunkDescs, chunk)
+		}
+	}
+
+	if v2.Signature != nil {
+		signature, err := parseChibitSignature(*v2.Signature)
+		if err != nil {
+			return nil, err
+		}
+		signed, err := ChibitCanonicalEntry(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to canonicalize V2 chibit entry: %w", err)
+		}
+		meta.signature = signature
+		meta.signedBytes = signed
+	}
+
+	return meta, nil
+}
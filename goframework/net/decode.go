@@ -0,0 +1,182 @@
+package goframework_net
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Creates a decoding reader for a Content-Encoding, the returned reader is closed together with the response body
+type ContentDecoderFn func(r io.Reader) (io.ReadCloser, error)
+
+type contentDecoder struct {
+	Name   string
+	Decode ContentDecoderFn
+}
+
+func decodeGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// "deflate" is supposed to be zlib-wrapped but some servers send raw deflate, so we sniff the zlib header
+func decodeDeflate(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func decodeBrotli(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+func decodeZstd(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return dec.IOReadCloser(), nil
+}
+
+func builtinContentDecoders() []contentDecoder {
+	return []contentDecoder{
+		{Name: "gzip", Decode: decodeGzip},
+		{Name: "deflate", Decode: decodeDeflate},
+		{Name: "br", Decode: decodeBrotli},
+		{Name: "zstd", Decode: decodeZstd},
+	}
+}
+
+// Registers (or replaces) a decoder for a Content-Encoding, registered encodings are advertised in Accept-Encoding when NetFetchOptions.DecodeContent is enabled
+func (nh *NetHandler) RegisterContentDecoder(encoding string, fn ContentDecoderFn) {
+	encoding = strings.ToLower(strings.TrimSpace(encoding))
+	for i, d := range nh.contentDecoders {
+		if d.Name == encoding {
+			nh.contentDecoders[i].Decode = fn
+			return
+		}
+	}
+	nh.contentDecoders = append(nh.contentDecoders, contentDecoder{Name: encoding, Decode: fn})
+}
+
+func (nh *NetHandler) getContentDecoder(encoding string) ContentDecoderFn {
+	for _, d := range nh.contentDecoders {
+		if d.Name == encoding {
+			return d.Decode
+		}
+	}
+	return nil
+}
+
+// Value for the Accept-Encoding header, in registration order
+func (nh *NetHandler) acceptEncoding() string {
+	names := make([]string, 0, len(nh.contentDecoders))
+	for _, d := range nh.contentDecoders {
+		names = append(names, d.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// Counts the bytes read off the wire (before any decoding) into the event
+type wireCountingReader struct {
+	body  io.ReadCloser
+	event *fwcommon.NetworkEvent
+}
+
+func (wr *wireCountingReader) Read(p []byte) (int, error) {
+	n, err := wr.body.Read(p)
+	wr.event.WireTransferred += int64(n)
+	return n, err
+}
+
+func (wr *wireCountingReader) Close() error {
+	return wr.body.Close()
+}
+
+// Lazily creates the decoder on first read, so HEAD/empty bodies and not-yet-read streams never block or fail on a missing header
+type lazyDecodingReader struct {
+	wire    io.ReadCloser
+	src     io.Reader
+	decode  []ContentDecoderFn // In the order they should be applied
+	decoded []io.ReadCloser
+	err     error
+	started bool
+}
+
+func (lr *lazyDecodingReader) Read(p []byte) (int, error) {
+	if !lr.started {
+		lr.started = true
+		src := lr.src
+		for _, fn := range lr.decode {
+			dec, err := fn(src)
+			if err != nil {
+				lr.err = fmt.Errorf("failed to create content decoder: %w", err)
+				break
+			}
+			lr.decoded = append(lr.decoded, dec)
+			src = dec
+		}
+		lr.src = src
+	}
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	return lr.src.Read(p)
+}
+
+func (lr *lazyDecodingReader) Close() error {
+	for i := len(lr.decoded) - 1; i >= 0; i-- {
+		lr.decoded[i].Close()
+	}
+	return lr.wire.Close()
+}
+
+// Wraps the response body so wire bytes are counted and (if decode) the Content-Encoding is decoded, returns the decoded encodings or "" if the body was left as is
+func (nh *NetHandler) wrapContentDecoding(resp *http.Response, event *fwcommon.NetworkEvent, decode bool) string {
+	counter := &wireCountingReader{body: resp.Body, event: event}
+	resp.Body = counter
+
+	if !decode {
+		return ""
+	}
+
+	header := strings.TrimSpace(resp.Header.Get("Content-Encoding"))
+	if header == "" || strings.EqualFold(header, "identity") {
+		return ""
+	}
+
+	// Encodings are listed in the order they were applied, so we decode in reverse
+	encodings := strings.Split(header, ",")
+	decoders := []ContentDecoderFn{}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		enc := strings.ToLower(strings.TrimSpace(encodings[i]))
+		if enc == "" || enc == "identity" {
+			continue
+		}
+		fn := nh.getContentDecoder(enc)
+		if fn == nil {
+			nh.log.Debug(fmt.Sprintf("No content decoder registered for '%s', leaving body encoded", enc))
+			return ""
+		}
+		decoders = append(decoders, fn)
+	}
+	if len(decoders) == 0 {
+		return ""
+	}
+
+	resp.Body = &lazyDecodingReader{wire: counter, src: counter, decode: decoders}
+	resp.Uncompressed = true
+	return strings.ToLower(header)
+}
@@ -0,0 +1,127 @@
+package goframework_net
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Serves file:// URLs from the local filesystem so local repos go through the same Fetch machinery (events, progress, handlers).
+// Missing files are a 404 and If-Modified-Since is answered with a 304 like a static server would.
+type fileTransport struct{}
+
+func (fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{
+		Proto:      "file",
+		ProtoMajor: 1,
+		Header:     http.Header{},
+		Request:    req,
+		Body:       http.NoBody,
+	}
+	status := func(code int) *http.Response {
+		resp.StatusCode = code
+		resp.Status = fmt.Sprintf("%d %s", code, http.StatusText(code))
+		return resp
+	}
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return status(http.StatusMethodNotAllowed), nil
+	}
+
+	f, err := os.Open(fileUrlToPath(req.URL))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return status(http.StatusNotFound), nil
+		}
+		if os.IsPermission(err) {
+			return status(http.StatusForbidden), nil
+		}
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil || stat.IsDir() {
+		f.Close()
+		return status(http.StatusNotFound), nil
+	}
+
+	modTime := stat.ModTime().UTC().Truncate(time.Second)
+	resp.Header.Set("Last-Modified", modTime.Format(http.TimeFormat))
+	if since, err := http.ParseTime(req.Header.Get("If-Modified-Since")); err == nil && !modTime.After(since) {
+		f.Close()
+		return status(http.StatusNotModified), nil
+	}
+
+	resp.ContentLength = stat.Size()
+	resp.Header.Set("Content-Length", fmt.Sprint(stat.Size()))
+	if req.Method == http.MethodHead {
+		f.Close()
+		return status(http.StatusOK), nil
+	}
+	resp.Body = f
+	return status(http.StatusOK), nil
+}
+
+// The local path of a file:// URL, "file:///C:/dir" is "C:\dir" on windows
+func fileUrlToPath(u *url.URL) string {
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		if u.Host != "" && u.Host != "localhost" {
+			path = "//" + u.Host + path // UNC
+		} else if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+	}
+	return filepath.FromSlash(path)
+}
+
+// Turns a local path (relative paths are made absolute) into a file:// URL
+func localPathToFileUrl(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	slashed := filepath.ToSlash(abs)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String(), nil
+}
+
+// Whether remoteUrl is a file:// URL
+func isFileUrl(remoteUrl string) bool {
+	u, err := url.Parse(remoteUrl)
+	return err == nil && strings.EqualFold(u.Scheme, "file")
+}
+
+// Returned (wrapped) when a redirect is not followed, ex. one from a remote URL to a local file:// one
+var ErrRedirectRejected = errors.New("redirect rejected")
+
+// The CheckRedirect of the built-in client: the default limit of 10 redirects, no redirect may switch to file:// and chibit fetches keep their url policy
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if strings.EqualFold(req.URL.Scheme, "file") {
+		return fmt.Errorf("%w: %s redirected to %s", ErrRedirectRejected, via[len(via)-1].URL.Redacted(), req.URL.Redacted())
+	}
+	return checkChibitHttpRedirect(req)
+}
+
+// Anything without a scheme (ex. "./repo", "C:\repo") is a local path
+func isLocalPath(repo string) bool {
+	if strings.Contains(repo, "://") {
+		return false
+	}
+	// A drive letter is not a scheme
+	if len(repo) >= 2 && repo[1] == ':' {
+		return true
+	}
+	u, err := url.Parse(repo)
+	return err != nil || u.Scheme == ""
+}
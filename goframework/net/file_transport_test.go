@@ -0,0 +1,49 @@
+package goframework_net
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+func TestFileUrlsOnlyFromLocalFetches(t *testing.T) {
+	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog)
+	defer fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog)
+
+	secret := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(secret, []byte("local secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileUrl, err := localPathToFileUrl(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, fileUrl, http.StatusFound)
+	}))
+	defer server.Close()
+
+	nh, _ := newRecordingNetHandler()
+	options := (&fwcommon.NetFetchOptions{}).Default()
+
+	// A remote URL can not redirect to a local file
+	report, err := nh.Fetch(fwcommon.MethodGet, server.URL, false, false, nil, nil, nil, nil, nil, options, nil)
+	if !errors.Is(err, ErrRedirectRejected) {
+		t.Errorf("expected the redirect to file:// to be rejected, got %v", err)
+	}
+	if report != nil && string(report.GetNonStreamBytes()) == "local secret" {
+		t.Errorf("the local file was served to a remote fetch")
+	}
+
+	// A fetch starting at file:// is served
+	report, err = nh.Fetch(fwcommon.MethodGet, fileUrl, false, false, nil, nil, nil, nil, nil, options, nil)
+	if err != nil || string(report.GetNonStreamBytes()) != "local secret" {
+		t.Errorf("expected the local file, got %v", err)
+	}
+}
@@ -3,7 +3,6 @@ package goframework_net
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -16,6 +15,7 @@ import (
 	"path/filepath"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	fwcommon "github.com/sbamboo/goframework/common"
@@ -28,7 +28,7 @@ type OnDestroyFn func(*fwcommon.NetworkEvent) error
 type NetProgressReport struct {
 	Event    *fwcommon.NetworkEvent
 	Response *http.Response
-	Content  *string // Nil if stream
+	Content  *string // Nil if stream, only built on first GetNonStreamContent when just ContentBytes was kept (assembled chibits)
 	ContentBytes []byte  // binary content (nil if stream)
 
 	progressor    fwcommon.ProgressorFn
@@ -39,6 +39,8 @@ type NetProgressReport struct {
 	lastSentProgressor *time.Time
 	lastSentDebug      *time.Time
 
+	wireCounted bool // Response.Body counts wire bytes into Event.WireTransferred itself
+
 	closed bool
 }
 
@@ -49,6 +51,9 @@ func (npr *NetProgressReport) GetResponse() *http.Response {
 	return npr.Response
 }
 func (npr *NetProgressReport) GetNonStreamContent() *string {
+	if npr.Content == nil && npr.ContentBytes != nil {
+		npr.Content = fwcommon.Ptr(string(npr.ContentBytes))
+	}
 	return npr.Content
 }
 func (npr *NetProgressReport) GetNonStreamBytes() []byte {
@@ -130,7 +135,7 @@ func (pr *NetProgressReport) LenRead(p []byte, start int, maxLen int) (n int, er
 
     n, err = pr.Response.Body.Read(readBuf)
     if n > 0 {
-        pr.Event.Transferred += int64(n)
+        pr.addTransferred(n)
 
         duration := time.Since(pr.Event.MetaGotFirstResp).Seconds()
         if duration > 0 {
@@ -175,6 +180,17 @@ func (pr *NetProgressReport) LenRead(p []byte, start int, maxLen int) (n int, er
     return n, err
 }
 
+// Tracks n decoded bytes as read, Transferred follows the wire bytes so it stays comparable to Size (Content-Length) for encoded responses
+func (pr *NetProgressReport) addTransferred(n int) {
+	pr.Event.DecodedTransferred += int64(n)
+	if pr.wireCounted {
+		pr.Event.Transferred = pr.Event.WireTransferred
+	} else {
+		pr.Event.Transferred += int64(n)
+		pr.Event.WireTransferred = pr.Event.Transferred
+	}
+}
+
 // Read implements the io.Reader interface for NetProgressReport.
 func (pr *NetProgressReport) Read(p []byte) (int, error) {
 	return pr.LenRead(p, 0, -1)
@@ -227,17 +243,28 @@ type NetHandler struct {
 	log        fwcommon.LoggerInterface   // Pointer
 	progressor fwcommon.ProgressorFn
 
-	prefixHandlers []fwcommon.ResponsePrefixHandler
+	prefixHandlers  []fwcommon.ResponsePrefixHandler
+	rewriteHandlers []fwcommon.RequestRewriteHandler
+	contentDecoders []contentDecoder
+	weTransferAPI   string // Base of the transfers api used by the wetransfer prefix handler
+
+	chibitIndexCache map[string]*chibitIndex // Index URL -> index
+	chibitIndexMutex sync.Mutex
 }
 
 // Implements: fwcommon.FetcherInterface
 func NewNetHandler(config *fwcommon.FrameworkConfig, debPtr fwcommon.DebuggerInterface, logPtr fwcommon.LoggerInterface, progressor fwcommon.ProgressorFn) *NetHandler {
-	return &NetHandler{
+	nh := &NetHandler{
 		config:     config,
 		deb:        debPtr,
 		log:        logPtr,
 		progressor: progressor,
 
+		contentDecoders: builtinContentDecoders(),
+		weTransferAPI:   "https://wetransfer.com/api/v4/transfers",
+
+		rewriteHandlers: builtinRewriteHandlers(),
+
 		prefixHandlers: []fwcommon.ResponsePrefixHandler{
 			{
 				Name: "gdrive",
@@ -275,8 +302,66 @@ func NewNetHandler(config *fwcommon.FrameworkConfig, debPtr fwcommon.DebuggerInt
 				NeedsContent: true,
 				FilterForUrls: []string{"www.mediafire.com"},
 			},
+			{
+				Name: "onedrive",
+				PrefixLen: 0,
+				Validator: isOneDriveLink,
+				Parser: parseOneDriveLink,
+				ContentTypeContains: "text/html",
+				NeedsContent: false,
+				FilterForUrls: []string{"onedrive.live.com", "sharepoint.com"},
+			},
+			{
+				Name: "sourceforge",
+				PrefixLen: 0,
+				Validator: isSourceForgeDownloadPage,
+				Parser: parseSourceForgeDownloadPage,
+				ContentTypeContains: "text/html",
+				NeedsContent: true,
+				FilterForUrls: []string{"sourceforge.net"},
+			},
+			{
+				Name: "pixeldrain",
+				PrefixLen: 0,
+				Validator: isPixeldrainLink,
+				Parser: parsePixeldrainLink,
+				ContentTypeContains: "text/html",
+				NeedsContent: false,
+				FilterForUrls: []string{"pixeldrain.com", "pixeldrain.net"},
+			},
+			{
+				Name: "githubblob",
+				PrefixLen: 0,
+				Validator: isGithubBlobLink,
+				Parser: parseGithubBlobLink,
+				ContentTypeContains: "text/html",
+				NeedsContent: false,
+				FilterForUrls: []string{"github.com"},
+			},
+			{
+				Name: "githublfs",
+				PrefixLen: len(gitLFSPointerPrefix),
+				Validator: isGithubLFSPointer,
+				Parser: parseGithubLFSPointer,
+				ContentTypeContains: "text/plain",
+				NeedsContent: false,
+				FilterForUrls: []string{"raw.githubusercontent.com"},
+			},
 		},
 	}
+
+	// Needs the handler to make its own api request
+	nh.prefixHandlers = append(nh.prefixHandlers, fwcommon.ResponsePrefixHandler{
+		Name: "wetransfer",
+		PrefixLen: 0,
+		Validator: isWeTransferLink,
+		EventParser: nh.parseWeTransferLink,
+		ContentTypeContains: "text/html",
+		NeedsContent: false,
+		FilterForUrls: []string{"wetransfer.com"},
+	})
+
+	return nh
 }
 
 func (nh *NetHandler) logThroughError(err error) error {
@@ -308,12 +393,28 @@ func (nh *NetHandler) RegisterPrefixHandler(h fwcommon.ResponsePrefixHandler) {
     nh.prefixHandlers = append(nh.prefixHandlers, h)
 }
 
+func (nh *NetHandler) RegisterRewriteHandler(h fwcommon.RequestRewriteHandler) {
+	nh.rewriteHandlers = append(nh.rewriteHandlers, h)
+}
+
 func (nh *NetHandler) debUpdateFull(progressPtr fwcommon.NetworkProgressReportInterface) {
 	callNetUpdateFull(nh.deb, progressPtr)
 }
 
 // The core network request function
 func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string) (fwcommon.NetworkProgressReportInterface, error) {
+	return nh.fetchWithoutHandlers(method, remoteUrl, stream, file, fileout, progressor, body, contextID, initiator, options, parentID, fetchTrace{})
+}
+
+// How a fetch was reached through the handlers, recorded on the event
+type fetchTrace struct {
+	chain          []fwcommon.PrefixHandlerHop
+	originalRemote string // Set if a rewrite handler changed the URL
+	rewrittenBy    string
+}
+
+// FetchWithoutHandlers with the trace of handlers that lead to this fetch
+func (nh *NetHandler) fetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string, trace fetchTrace) (fwcommon.NetworkProgressReportInterface, error) {
 	// If options is nil set options to point to nh.config.NetFetchOptions
 	if options == nil {
 		options = nh.config.NetFetchOptions
@@ -407,6 +508,10 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 				EventStepCurrent: nil,
 				EventStepMax:     options.EventStepMax,
 				EventStepMode:    options.EventStepMode,
+
+				HandlerChain:   trace.chain,
+				OriginalRemote: trace.originalRemote,
+				RewrittenBy:    trace.rewrittenBy,
 			},
 			Response:      nil,
 			Content:       nil,
@@ -424,7 +529,7 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 			var err error
 			u, err = url.Parse(remoteUrl)
 			progress.Event.EventState = fwcommon.NetStateFailed
-			if err != nil || u.Host == "" || u == nil {
+			if err != nil || u == nil || (u.Host == "" && u.Scheme != "file") {
 				return &progress, fmt.Errorf("invalid URL: %s", remoteUrl)
 			}
 			progress.Event.Scheme = u.Scheme
@@ -452,10 +557,26 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 		var client *http.Client
 		if options.Client == nil {
 			tr := &http.Transport{}
+			// Local files are only served to fetches that start at one (local chibit repos), remote URLs never reach them
+			if isFileUrl(remoteUrl) {
+				tr.RegisterProtocol("file", fileTransport{})
+			}
 
-			if options.InsecureSkipVerify {
-				tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			pinHost := ""
+			if pu, perr := url.Parse(remoteUrl); perr == nil {
+				pinHost = pu.Hostname()
+			}
+			tlsConf, err := buildTLSConfig(options, pinHost)
+			if err != nil {
+				progress.Event.EventState = fwcommon.NetStateFailed
+				if progressor != nil {
+					progressor(&progress, fmt.Errorf("failed to setup TLS: %w", err))
+				} else {
+					nh.debUpdateFull(&progress)
+				}
+				return &progress, nh.logThroughError(fmt.Errorf("failed to setup TLS: %w", err))
 			}
+			tr.TLSClientConfig = tlsConf
 
 			// Define dialcontext
 			tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
@@ -485,8 +606,15 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 			} else {
 				client = &http.Client{Transport: tr}
 			}
+			client.CheckRedirect = checkRedirect
 		} else {
 			client = options.Client
+			// Chibit fetches keep their url policy on redirects through a custom client too
+			if hasChibitPolicy(options) {
+				scoped := *options.Client
+				scoped.CheckRedirect = chibitCheckRedirect(options.Client.CheckRedirect)
+				client = &scoped
+			}
 		}
 
 		// Setup context
@@ -544,7 +672,12 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
 
 		if options.Headers != nil {
-			req.Header = *options.Headers
+			req.Header = options.Headers.Clone()
+		}
+
+		// Negotiate the encoding ourselves so the wire and decoded bytes can be tracked separately (Go only decodes transparently if it added the header itself)
+		if options.DecodeContent && req.Header.Get("Accept-Encoding") == "" {
+			req.Header.Set("Accept-Encoding", nh.acceptEncoding())
 		}
 
 		resp, err := client.Do(req)
@@ -560,6 +693,17 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 				}
 			}
 
+			// Pin mismatches get their own error so callers can tell them apart from other TLS failures
+			if errors.Is(err, ErrCertificatePinMismatch) {
+				progress.Event.EventState = fwcommon.NetStateFailed
+				if progressor != nil {
+					progressor(&progress, err)
+				} else {
+					nh.debUpdateFull(&progress)
+				}
+				return &progress, nh.logThroughError(fmt.Errorf("certificate pinning failed for %s: %w", remoteUrl, err))
+			}
+
 			// Other errors or no retries left
 			progress.Event.EventState = fwcommon.NetStateFailed
 			if progressor != nil {
@@ -616,7 +760,9 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 			defer resp.Body.Close()
 		}
 
-		if resp.StatusCode != http.StatusOK {
+		// A 304 to a conditional request is a successful answer, the caller already has the content
+		notModified := resp.StatusCode == http.StatusNotModified && (req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "")
+		if resp.StatusCode != http.StatusOK && !notModified {
 			io.Copy(io.Discard, resp.Body)
 			resp.Body.Close()
 			progress.Event.EventState = fwcommon.NetStateFinished // Should this be .NetStateFailed instead? Where do we draw the line of failed or finished-non-ok
@@ -628,6 +774,10 @@ func (nh *NetHandler) FetchWithoutHandlers(method fwcommon.HttpMethod, remoteUrl
 			return &progress, nh.logThroughError(fmt.Errorf("received non-OK HTTP status: %s", resp.Status))
 		}
 
+		// Count wire bytes and decode the body, Size stays the Content-Length of the encoded stream
+		progress.Event.ContentEncoding = nh.wrapContentDecoding(resp, progress.Event, options.DecodeContent)
+		progress.wireCounted = true
+
 		progress.Event.Size = resp.ContentLength
 		if options.TotalSizeOverride != -2 {
 			progress.Event.Size = options.TotalSizeOverride
@@ -835,8 +985,16 @@ func (nh *NetHandler) _outerFetchInterfaceMatcher(bufferSize int, irep fwcommon.
 
 // Wraps `FetchWithoutHandlers` with prefix-handlers
 func (nh *NetHandler) Fetch(method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string) (fwcommon.NetworkProgressReportInterface, error) {
+	return nh.fetchWithHandlers(method, remoteUrl, stream, file, fileout, progressor, body, contextID, initiator, options, parentID, nil)
+}
+
+// A single prefix-handler hop, recurses while handlers match until NetFetchOptions.PrefixHandlerMaxDepth hops have been made
+func (nh *NetHandler) fetchWithHandlers(method fwcommon.HttpMethod, remoteUrl string, stream bool, file bool, fileout *string, progressor fwcommon.ProgressorFn, body io.Reader, contextID *string, initiator *fwcommon.ElementIdentifier, options *fwcommon.NetFetchOptions, parentID *string, chain []fwcommon.PrefixHandlerHop) (fwcommon.NetworkProgressReportInterface, error) {
+	// Rewrite handlers can turn the URL into a direct link before anything is sent
+	remoteUrl, trace := nh.applyRewriteHandlers(remoteUrl, options, chain)
+
 	// Make an overriding request with stream=True, file=False
-	irep, err := nh.FetchWithoutHandlers(method, remoteUrl, true, false, nil, progressor, body, contextID, initiator, options, parentID)
+	irep, err := nh.fetchWithoutHandlers(method, remoteUrl, true, false, nil, progressor, body, contextID, initiator, options, parentID, trace)
 	
 	// If there was any errors during the transfer we can just return
 	if err != nil {
@@ -953,7 +1111,7 @@ func (nh *NetHandler) Fetch(method fwcommon.HttpMethod, remoteUrl string, stream
 			// Then call the validator .Parse, if the .Parse failed/errored or returned empty URL we return full-original-content / full-replay-stream
 			//   else we set the current progress.Event.Interupted to true, re-call progressor since we changed event state,
 			//   then finally we re-call Fetch() with new url and otherwise all the same parameters
-			matched := matchedHandler != nil && matchedHandler.Parser != nil
+			matched := matchedHandler != nil && (matchedHandler.Parser != nil || matchedHandler.EventParser != nil)
 			var newURL string
 			if matched {
 				// Since irep is stream we can read the rest of it
@@ -984,7 +1142,11 @@ func (nh *NetHandler) Fetch(method fwcommon.HttpMethod, remoteUrl string, stream
 				}
 
 				// Call parser
-				newURL, err = matchedHandler.Parser(fullBuf, resp.Request.URL.String())
+				if matchedHandler.EventParser != nil {
+					newURL, err = matchedHandler.EventParser(fullBuf, resp.Request.URL.String(), event.ID)
+				} else {
+					newURL, err = matchedHandler.Parser(fullBuf, resp.Request.URL.String())
+				}
 				if err != nil {
 					newURL = ""
 					nh.logThroughError(err)
@@ -1008,8 +1170,34 @@ func (nh *NetHandler) Fetch(method fwcommon.HttpMethod, remoteUrl string, stream
 					// Now the irep is fully consumed or not needed anymore
 					irep.Close()
 
-					// Parser returned a URL => fetch
-					return nh.FetchWithoutHandlers(method, newURL, stream, file, fileout, progressor, body, contextID, initiator, options, &irep.GetNetworkEvent().ID)
+					respUrl := resp.Request.URL.String()
+
+					// A URL we already passed through means the handlers are going in circles
+					visited := []string{remoteUrl, respUrl, trace.originalRemote}
+					for _, hop := range chain {
+						visited = append(visited, hop.From, hop.To)
+					}
+					if slices.Contains(visited, newURL) {
+						return irep, nh.logThroughError(fmt.Errorf("%w: %s resolved %s to an already visited URL", ErrPrefixHandlerLoop, matchedHandler.Name, newURL))
+					}
+
+					nextChain := append(slices.Clone(chain), fwcommon.PrefixHandlerHop{
+						Handler: matchedHandler.Name,
+						From:    respUrl,
+						To:      newURL,
+						EventID: event.ID,
+					})
+
+					// Parser returned a URL => fetch, through the handlers again unless we are at the max depth
+					maxDepth := event.NetFetchOptions.PrefixHandlerMaxDepth
+					if maxDepth <= 0 {
+						maxDepth = 1
+					}
+					if len(nextChain) >= maxDepth {
+						newURL, nextTrace := nh.applyRewriteHandlers(newURL, options, nextChain)
+						return nh.fetchWithoutHandlers(method, newURL, stream, file, fileout, progressor, body, contextID, initiator, options, &event.ID, nextTrace)
+					}
+					return nh.fetchWithHandlers(method, newURL, stream, file, fileout, progressor, body, contextID, initiator, options, &event.ID, nextChain)
 				}
 			}
 			if !matched || newURL == "" {
@@ -1051,7 +1239,7 @@ func writeStream(dst io.Writer, progress *NetProgressReport, bufferSize int) err
 			}
 			written += int64(n)
 
-			progress.Event.Transferred = written
+			progress.addTransferred(n)
 
 			progress.Event.CalcStep()
 
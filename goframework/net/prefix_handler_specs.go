@@ -0,0 +1,250 @@
+package goframework_net
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+var specTemplateVar = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+type compiledExtract struct {
+	spec  fwcommon.PrefixHandlerExtractSpec
+	regex *regexp.Regexp
+}
+
+// Compiles a PrefixHandlerSpec into a ResponsePrefixHandler, regexes and templates are validated up front
+func CompilePrefixHandlerSpec(spec fwcommon.PrefixHandlerSpec) (fwcommon.ResponsePrefixHandler, error) {
+	if spec.Name == "" {
+		return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec: name is required")
+	}
+	if spec.PrefixLen < 0 {
+		return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: prefix_len must be >= 0", spec.Name)
+	}
+
+	var prefixRe, urlRe *regexp.Regexp
+	var err error
+	if spec.Match.PrefixRegex != "" {
+		if prefixRe, err = regexp.Compile(spec.Match.PrefixRegex); err != nil {
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: invalid prefix_regex: %w", spec.Name, err)
+		}
+	}
+	if spec.Match.UrlRegex != "" {
+		if urlRe, err = regexp.Compile(spec.Match.UrlRegex); err != nil {
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: invalid url_regex: %w", spec.Name, err)
+		}
+	}
+
+	known := map[string]bool{"url": true}
+	extracts := make([]compiledExtract, 0, len(spec.Extract))
+	for _, ex := range spec.Extract {
+		if ex.Name == "" || ex.Name == "url" {
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: extract rules need a name other than 'url'", spec.Name)
+		}
+		if ex.From != "" && ex.From != "body" && ex.From != "url" {
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: extract %s has unknown source '%s'", spec.Name, ex.Name, ex.From)
+		}
+		if ex.From != "url" && !spec.NeedsContent && spec.PrefixLen == 0 {
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: extract %s reads the body but the handler neither needs content nor reads a prefix", spec.Name, ex.Name)
+		}
+		ce := compiledExtract{spec: ex}
+		switch {
+		case ex.Regex != "" && ex.Start != "":
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: extract %s sets both regex and start/end", spec.Name, ex.Name)
+		case ex.Regex != "":
+			if ce.regex, err = regexp.Compile(ex.Regex); err != nil {
+				return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: extract %s has invalid regex: %w", spec.Name, ex.Name, err)
+			}
+		case ex.Start == "" || ex.End == "":
+			return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: extract %s needs a regex or both start and end", spec.Name, ex.Name)
+		}
+		known[ex.Name] = true
+		extracts = append(extracts, ce)
+	}
+
+	urlTemplate := spec.URL
+	if urlTemplate == "" {
+		urlTemplate = "{url}"
+	}
+	templates := []string{urlTemplate}
+	for _, v := range spec.Query {
+		templates = append(templates, v)
+	}
+	for _, t := range templates {
+		for _, m := range specTemplateVar.FindAllStringSubmatch(t, -1) {
+			if !known[m[1]] {
+				return fwcommon.ResponsePrefixHandler{}, fmt.Errorf("prefix handler spec %s: template references unknown value '{%s}'", spec.Name, m[1])
+			}
+		}
+	}
+
+	validator := func(prefix []byte, respUrl string) bool {
+		s := string(prefix)
+		for _, c := range spec.Match.PrefixContains {
+			if !strings.Contains(s, c) {
+				return false
+			}
+		}
+		if prefixRe != nil && !prefixRe.MatchString(s) {
+			return false
+		}
+		if spec.Match.UrlPrefix != "" && !strings.HasPrefix(respUrl, spec.Match.UrlPrefix) {
+			return false
+		}
+		for _, c := range spec.Match.UrlContains {
+			if !strings.Contains(respUrl, c) {
+				return false
+			}
+		}
+		if urlRe != nil && !urlRe.MatchString(respUrl) {
+			return false
+		}
+		return true
+	}
+
+	parser := func(fullBody []byte, respUrl string) (string, error) {
+		body := string(fullBody)
+		values := map[string]string{"url": respUrl}
+
+		for _, ex := range extracts {
+			src := body
+			if ex.spec.From == "url" {
+				src = respUrl
+			}
+
+			var val string
+			var ok bool
+			if ex.regex != nil {
+				if m := ex.regex.FindStringSubmatch(src); m != nil {
+					ok = true
+					val = m[0]
+					if len(m) > 1 {
+						val = m[1]
+					}
+				}
+			} else {
+				val, ok = fwcommon.ExtractBetween(src, ex.spec.Start, ex.spec.End)
+			}
+
+			if !ok {
+				if ex.spec.Optional {
+					values[ex.spec.Name] = ""
+					continue
+				}
+				return "", fmt.Errorf("%s: %s not found", spec.Name, ex.spec.Name)
+			}
+
+			if ex.spec.Trim != "" {
+				val = strings.Trim(val, ex.spec.Trim)
+			}
+			if ex.spec.Unescape {
+				val = html.UnescapeString(val)
+			}
+			values[ex.spec.Name] = val
+		}
+
+		expand := func(t string) string {
+			return specTemplateVar.ReplaceAllStringFunc(t, func(m string) string {
+				return values[m[1:len(m)-1]]
+			})
+		}
+
+		newURL := expand(urlTemplate)
+		if newURL == "" {
+			return "", fmt.Errorf("%s: url template expanded to an empty string", spec.Name)
+		}
+
+		if len(spec.Query) > 0 {
+			parsedURL, err := url.Parse(newURL)
+			if err != nil {
+				return "", fmt.Errorf("%s: failed to parse URL: %w", spec.Name, err)
+			}
+			query := parsedURL.Query()
+			set := 0
+			for key, t := range spec.Query {
+				if v := expand(t); v != "" {
+					query.Set(key, v)
+					set++
+				}
+			}
+			if set == 0 && spec.RequireQuery {
+				return "", fmt.Errorf("%s: no parameters found", spec.Name)
+			}
+			parsedURL.RawQuery = query.Encode()
+			newURL = parsedURL.String()
+		}
+
+		return newURL, nil
+	}
+
+	return fwcommon.ResponsePrefixHandler{
+		Name:                spec.Name,
+		PrefixLen:           spec.PrefixLen,
+		Validator:           validator,
+		Parser:              parser,
+		ContentTypeContains: spec.ContentTypeContains,
+		NeedsContent:        spec.NeedsContent,
+		FilterForUrls:       spec.FilterForUrls,
+	}, nil
+}
+
+// Parses a list of PrefixHandlerSpec from JSON or YAML (JSON is valid YAML so both go through the YAML decoder)
+func ParsePrefixHandlerSpecs(data []byte) ([]fwcommon.PrefixHandlerSpec, error) {
+	var specs []fwcommon.PrefixHandlerSpec
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse prefix handler specs: %w", err)
+	}
+	return specs, nil
+}
+
+// Compiles and registers a spec, replacing any registered handler with the same name so broken host rules can be patched from config
+func (nh *NetHandler) RegisterPrefixHandlerSpec(spec fwcommon.PrefixHandlerSpec) error {
+	h, err := CompilePrefixHandlerSpec(spec)
+	if err != nil {
+		return nh.logThroughError(err)
+	}
+	for i, existing := range nh.prefixHandlers {
+		if existing.Name == h.Name {
+			nh.prefixHandlers[i] = h
+			return nil
+		}
+	}
+	nh.prefixHandlers = append(nh.prefixHandlers, h)
+	return nil
+}
+
+// Parses and registers prefix handler specs from JSON/YAML, returns the registered names so they can be added to NetFetchOptions.EnabledPrefixHandlers
+// Nothing is registered if any of the specs fails to compile
+func (nh *NetHandler) LoadPrefixHandlers(data []byte) ([]string, error) {
+	specs, err := ParsePrefixHandlerSpecs(data)
+	if err != nil {
+		return nil, nh.logThroughError(err)
+	}
+	for _, spec := range specs {
+		if _, err := CompilePrefixHandlerSpec(spec); err != nil {
+			return nil, nh.logThroughError(err)
+		}
+	}
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		nh.RegisterPrefixHandlerSpec(spec)
+		names = append(names, spec.Name)
+	}
+	return names, nil
+}
+
+// Same as LoadPrefixHandlers but reads the specs from a file
+func (nh *NetHandler) LoadPrefixHandlersFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nh.logThroughError(fmt.Errorf("failed to read prefix handler specs: %w", err))
+	}
+	return nh.LoadPrefixHandlers(data)
+}
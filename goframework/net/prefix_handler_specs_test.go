@@ -0,0 +1,126 @@
+package goframework_net
+
+import (
+	"os"
+	"testing"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+type prefixHandlerCase struct {
+	handler string
+	body    string
+	url     string
+}
+
+var prefixHandlerCases = []prefixHandlerCase{
+	{"gdrive", `<!DOCTYPE html><html><head><title>Google Drive - Virus scan warning</title></head><body><form id="download-form" action="https://drive.usercontent.google.com/download" method="get"><input type="hidden" name="id" value="1AbC"><input type="hidden" name="export" value="download"><input type="hidden" name="confirm" value="t"><input type="hidden" name="uuid" value="0000-1111"></form></body></html>`, "https://drive.google.com/uc?id=1AbC&export=download"},
+	{"gdrive", `<!DOCTYPE html><html><head><title>Google Drive - Virus scan warning</title></head><body><form action="https://drive.usercontent.google.com/download"></form></body></html>`, "https://drive.google.com/uc?id=1AbC"},
+	{"gdrive", `<!DOCTYPE html><html><head><title>Some other page</title></head></html>`, "https://drive.google.com/uc?id=1AbC"},
+	{"sprend", ``, "https://sprend.com/download?C=abc123"},
+	{"sprend", ``, "https://sprend.com/en/download?C=abc123"},
+	{"sprend", ``, "https://sprend.com/en/upload"},
+	{"dropbox", ``, "https://www.dropbox.com/scl/fi/xyz/file.zip?rlkey=abc&dl=0"},
+	{"dropbox", ``, "https://www.dropbox.com/scl/fi/xyz/file.zip?rlkey=abc&dl=1"},
+	{"dropbox", ``, "https://www.dropbox.com/scl/fi/xyz?dl=0"},
+	{"mediafire", `<a class="input popsok" aria-label="Download file" href="https://download937.mediafire.com/abc/def/file.zip"
+                id="downloadButton">`, "https://www.mediafire.com/file/def/file.zip/file"},
+	{"mediafire", `<html>nothing here</html>`, "https://www.mediafire.com/file/def/file.zip/file"},
+	{"mediafire", ``, "https://www.mediafire.com/folder/def"},
+}
+
+func TestPrefixHandlerSpecsMatchBuiltins(t *testing.T) {
+	data, err := os.ReadFile("testdata/prefix_handlers.yaml")
+	if err != nil {
+		t.Fatalf("failed to read specs: %v", err)
+	}
+
+	specs := NewNetHandler(nil, nil, nil, nil)
+	builtins := map[string]fwcommon.ResponsePrefixHandler{}
+	for _, h := range specs.prefixHandlers {
+		builtins[h.Name] = h
+	}
+	specs.prefixHandlers = nil
+
+	names, err := specs.LoadPrefixHandlers(data)
+	if err != nil {
+		t.Fatalf("failed to load specs: %v", err)
+	}
+	if len(names) != 4 {
+		t.Fatalf("expected the gdrive, sprend, dropbox and mediafire specs, got %v", names)
+	}
+
+	matched := 0
+	for _, declarative := range specs.prefixHandlers {
+		builtin, ok := builtins[declarative.Name]
+		if !ok {
+			t.Fatalf("spec %s has no builtin counterpart", declarative.Name)
+		}
+		if declarative.PrefixLen != builtin.PrefixLen || declarative.NeedsContent != builtin.NeedsContent || declarative.ContentTypeContains != builtin.ContentTypeContains || len(declarative.FilterForUrls) != len(builtin.FilterForUrls) {
+			t.Errorf("%s: spec settings differ from the builtin", declarative.Name)
+		}
+
+		for _, c := range prefixHandlerCases {
+			if c.handler != declarative.Name {
+				continue
+			}
+			prefix := []byte(c.body)
+			if len(prefix) > builtin.PrefixLen && !builtin.NeedsContent {
+				prefix = prefix[:builtin.PrefixLen]
+			}
+
+			wantMatch := builtin.Validator(prefix, c.url)
+			gotMatch := declarative.Validator(prefix, c.url)
+			if wantMatch != gotMatch {
+				t.Errorf("%s %s: validator got %v, builtin %v", c.handler, c.url, gotMatch, wantMatch)
+				continue
+			}
+			if !wantMatch {
+				continue
+			}
+			matched++
+
+			wantURL, wantErr := builtin.Parser([]byte(c.body), c.url)
+			gotURL, gotErr := declarative.Parser([]byte(c.body), c.url)
+			if wantURL != gotURL || (wantErr == nil) != (gotErr == nil) {
+				t.Errorf("%s %s: parser got (%q, %v), builtin (%q, %v)", c.handler, c.url, gotURL, gotErr, wantURL, wantErr)
+			}
+		}
+	}
+	if matched < 6 {
+		t.Errorf("expected at least 6 cases to reach the parsers, got %d", matched)
+	}
+}
+
+func TestPrefixHandlerSpecValidation(t *testing.T) {
+	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog)      // No logger in these handlers
+	defer fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog) // Re-enable net's debugging
+
+	invalid := []string{
+		`[{name: ""}]`,
+		`[{name: a, match: {url_regex: "("}}]`,
+		`[{name: a, url: "{missing}"}]`,
+		`[{name: a, needs_content: true, extract: [{name: x, start: "a"}]}]`,
+		`[{name: a, extract: [{name: x, start: "a", end: "b"}]}]`,
+	}
+	for _, data := range invalid {
+		nh := NewNetHandler(nil, nil, nil, nil)
+		before := len(nh.prefixHandlers)
+		if _, err := nh.LoadPrefixHandlers([]byte(data)); err == nil {
+			t.Errorf("expected %s to be rejected", data)
+		}
+		if len(nh.prefixHandlers) != before {
+			t.Errorf("%s: handlers were registered despite the error", data)
+		}
+	}
+
+	// JSON goes through the same loader and a spec replaces a builtin of the same name
+	nh := NewNetHandler(nil, nil, nil, nil)
+	before := len(nh.prefixHandlers)
+	if _, err := nh.LoadPrefixHandlers([]byte(`[{"name": "dropbox", "match": {"url_contains": ["dl=0"]}, "query": {"dl": "1"}}]`)); err != nil {
+		t.Fatalf("failed to load JSON spec: %v", err)
+	}
+	if len(nh.prefixHandlers) != before {
+		t.Errorf("expected the dropbox builtin to be replaced, got %d handlers", len(nh.prefixHandlers))
+	}
+}
@@ -1,13 +1,22 @@
 package goframework_net
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"net/http"
 	"net/url"
+	"regexp"
 	"strings"
 
 	fwcommon "github.com/sbamboo/goframework/common"
 )
 
+// Returned (wrapped) by Fetch when a prefix handler resolves to a URL that was already visited in the same chain
+var ErrPrefixHandlerLoop = errors.New("prefix handler loop")
+
 func isGoogleDriveWarning(prefix []byte, _ string) bool {
     s := string(prefix)
     return strings.Contains(s, "<!DOCTYPE html>") &&
@@ -160,4 +169,255 @@ func parseMediafireLink(body []byte, _ string) (string, error) {
     }
 
     return "https://download937.mediafire.com/" + strings.TrimSuffix(strings.TrimSpace(downloadUrl), `"`), nil
-}
\ No newline at end of file
+}
+func isOneDriveLink(_ []byte, respUrl string) bool {
+	// https://onedrive.live.com/redir?resid={id}&authkey={key} | https://onedrive.live.com/embed?... | https://onedrive.live.com/?cid={cid}&id={id}
+	// https://{tenant}.sharepoint.com/:u:/g/personal/{user}/{token}?e={e}
+
+	u, err := url.Parse(respUrl)
+	if err != nil {
+		return false
+	}
+	query := u.Query()
+
+	switch {
+	case u.Host == "onedrive.live.com":
+		return u.Path == "/redir" || u.Path == "/embed" || ((u.Path == "/" || u.Path == "") && query.Get("id") != "")
+	case strings.HasSuffix(u.Host, ".sharepoint.com"):
+		return strings.HasPrefix(u.Path, "/:") && query.Get("download") != "1"
+	}
+	return false
+}
+
+func parseOneDriveLink(_ []byte, respUrl string) (string, error) {
+	u, err := url.Parse(respUrl)
+	if err != nil {
+		return "", fmt.Errorf("onedrive: failed to parse URL: %w", err)
+	}
+	query := u.Query()
+
+	// SharePoint (and OneDrive for Business) share links download with download=1
+	if strings.HasSuffix(u.Host, ".sharepoint.com") {
+		query.Set("download", "1")
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	// The web-app link names the item "id", the download endpoint wants "resid"
+	if query.Get("resid") == "" && query.Get("id") != "" {
+		query.Set("resid", query.Get("id"))
+		query.Del("id")
+	}
+	if query.Get("resid") == "" {
+		return "", fmt.Errorf("onedrive: resid not found")
+	}
+
+	u.Path = "/download"
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// https://wetransfer.com/downloads/{id}/{security_hash} | https://wetransfer.com/downloads/{id}/{recipient_id}/{security_hash}
+func splitWeTransferLink(respUrl string) (id string, recipient string, hash string, ok bool) {
+	u, err := url.Parse(respUrl)
+	if err != nil || (u.Host != "wetransfer.com" && !strings.HasSuffix(u.Host, ".wetransfer.com")) {
+		return "", "", "", false
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) == 0 || parts[0] != "downloads" {
+		return "", "", "", false
+	}
+
+	switch len(parts) {
+	case 3:
+		return parts[1], "", parts[2], true
+	case 4:
+		return parts[1], parts[2], parts[3], true
+	}
+	return "", "", "", false
+}
+
+func isWeTransferLink(_ []byte, respUrl string) bool {
+	_, _, _, ok := splitWeTransferLink(respUrl)
+	return ok
+}
+
+// WeTransfer only hands out the file link through its API, so this parser makes a request of its own (a child of the matched event)
+func (nh *NetHandler) parseWeTransferLink(_ []byte, respUrl string, eventID string) (string, error) {
+	id, recipient, hash, ok := splitWeTransferLink(respUrl)
+	if !ok {
+		return "", fmt.Errorf("wetransfer: not a download link")
+	}
+
+	payload := map[string]string{
+		"security_hash": hash,
+		"intent":        "entire_transfer",
+	}
+	if recipient != "" {
+		payload["recipient_id"] = recipient
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("wetransfer: failed to build request: %w", err)
+	}
+
+	options := (&fwcommon.NetFetchOptions{}).Default()
+	if nh.config != nil && nh.config.NetFetchOptions != nil {
+		configOptions := *nh.config.NetFetchOptions
+		options = &configOptions
+	}
+	headers := http.Header{}
+	if options.Headers != nil {
+		headers = options.Headers.Clone()
+	}
+	headers.Set("Content-Type", "application/json")
+	headers.Set("X-Requested-With", "XMLHttpRequest")
+	options.Headers = &headers
+	options.EnabledPrefixHandlers = []string{}
+
+	apiUrl := strings.TrimSuffix(nh.weTransferAPI, "/") + "/" + url.PathEscape(id) + "/download"
+	rep, err := nh.FetchWithoutHandlers(fwcommon.MethodPost, apiUrl, false, false, nil, nil, bytes.NewReader(payloadBytes), fwcommon.Ptr("Fw.Net.PrefixHandler.wetransfer"), nil, options, &eventID)
+	if err != nil {
+		return "", fmt.Errorf("wetransfer: api request failed: %w", err)
+	}
+
+	var result struct {
+		DirectLink string `json:"direct_link"`
+	}
+	if err := json.Unmarshal(rep.GetNonStreamBytes(), &result); err != nil {
+		return "", fmt.Errorf("wetransfer: failed to parse api response: %w", err)
+	}
+	if result.DirectLink == "" {
+		return "", fmt.Errorf("wetransfer: api response has no direct_link")
+	}
+
+	return result.DirectLink, nil
+}
+
+func isSourceForgeDownloadPage(_ []byte, respUrl string) bool {
+	// https://sourceforge.net/projects/{project}/files/{path}/download
+
+	u, err := url.Parse(respUrl)
+	if err != nil {
+		return false
+	}
+	return u.Host == "sourceforge.net" && strings.HasPrefix(u.Path, "/projects/") && strings.Contains(u.Path, "/files/") && strings.HasSuffix(u.Path, "/download")
+}
+
+var metaTagRegex = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+var metaContentRegex = regexp.MustCompile(`(?is)content\s*=\s*["']([^"']*)["']`)
+var sourceForgeDirectRegex = regexp.MustCompile(`(?is)<a\s[^>]*href="(https://downloads\.sourceforge\.net/[^"]+)"[^>]*class="[^"]*direct-download`)
+
+// Returns the URL of a <meta http-equiv="refresh" content="5; url=..."> tag
+func extractMetaRefresh(s string) (string, bool) {
+	for _, tag := range metaTagRegex.FindAllString(s, -1) {
+		if !strings.Contains(strings.ToLower(tag), "refresh") {
+			continue
+		}
+		m := metaContentRegex.FindStringSubmatch(tag)
+		if m == nil {
+			continue
+		}
+		_, target, found := strings.Cut(m[1], "=")
+		if !found {
+			continue
+		}
+		target = html.UnescapeString(strings.TrimSpace(target))
+		if target != "" {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+func parseSourceForgeDownloadPage(body []byte, _ string) (string, error) {
+	s := string(body)
+
+	// The countdown page refreshes to the mirror link
+	if target, ok := extractMetaRefresh(s); ok {
+		return target, nil
+	}
+
+	// Fallback to the "problems downloading?" direct link
+	if m := sourceForgeDirectRegex.FindStringSubmatch(s); m != nil {
+		return html.UnescapeString(m[1]), nil
+	}
+
+	return "", fmt.Errorf("sourceforge: mirror link not found")
+}
+
+func isPixeldrainLink(_ []byte, respUrl string) bool {
+	// https://pixeldrain.com/u/{id} | https://pixeldrain.com/l/{id}
+
+	u, err := url.Parse(respUrl)
+	if err != nil || (u.Host != "pixeldrain.com" && u.Host != "pixeldrain.net") {
+		return false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	return len(parts) == 2 && (parts[0] == "u" || parts[0] == "l") && parts[1] != ""
+}
+
+func parsePixeldrainLink(_ []byte, respUrl string) (string, error) {
+	u, err := url.Parse(respUrl)
+	if err != nil {
+		return "", fmt.Errorf("pixeldrain: failed to parse URL: %w", err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("pixeldrain: id not found")
+	}
+
+	// Files download directly, lists as a zip of all files
+	if parts[0] == "l" {
+		return "https://" + u.Host + "/api/list/" + parts[1] + "/zip", nil
+	}
+	return "https://" + u.Host + "/api/file/" + parts[1] + "?download", nil
+}
+
+func isGithubBlobLink(_ []byte, respUrl string) bool {
+	// https://github.com/{owner}/{repo}/blob/{ref}/{path}
+
+	u, err := url.Parse(respUrl)
+	if err != nil || u.Host != "github.com" {
+		return false
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	return len(parts) >= 5 && parts[2] == "blob"
+}
+
+func parseGithubBlobLink(_ []byte, respUrl string) (string, error) {
+	u, err := url.Parse(respUrl)
+	if err != nil {
+		return "", fmt.Errorf("github: failed to parse URL: %w", err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 5 {
+		return "", fmt.Errorf("github: not a blob link")
+	}
+
+	// /raw/ redirects to raw.githubusercontent.com, or to media.githubusercontent.com for LFS tracked files
+	parts[2] = "raw"
+	u.Path = "/" + strings.Join(parts, "/")
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+const gitLFSPointerPrefix = "version https://git-lfs.github.com/spec/v1"
+
+func isGithubLFSPointer(prefix []byte, respUrl string) bool {
+	// https://raw.githubusercontent.com/{owner}/{repo}/{ref}/{path} serving a pointer file
+
+	return strings.HasPrefix(respUrl, "https://raw.githubusercontent.com/") && bytes.HasPrefix(prefix, []byte(gitLFSPointerPrefix))
+}
+
+func parseGithubLFSPointer(_ []byte, respUrl string) (string, error) {
+	u, err := url.Parse(respUrl)
+	if err != nil {
+		return "", fmt.Errorf("githublfs: failed to parse URL: %w", err)
+	}
+
+	// media.githubusercontent.com serves the LFS object under the same path
+	return "https://media.githubusercontent.com/media" + u.Path, nil
+}
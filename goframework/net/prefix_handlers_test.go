@@ -0,0 +1,224 @@
+package goframework_net
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+	fwdebug "github.com/sbamboo/goframework/debug"
+	fwlog "github.com/sbamboo/goframework/log"
+)
+
+func newTestNetHandler() *NetHandler {
+	config := &fwcommon.FrameworkConfig{NetFetchOptions: (&fwcommon.NetFetchOptions{}).Default()}
+	deb := fwdebug.NewDebugEmitter(config)
+	return NewNetHandler(config, deb, fwlog.NewLogger(config, deb), nil)
+}
+
+// Picks the handler the same way Fetch does (enabled, content-type, url filter, prefix) and runs its parser
+func resolveWithHandlers(t *testing.T, nh *NetHandler, fixture string, contentType string, respUrl string) (string, string, error) {
+	t.Helper()
+
+	body := []byte{}
+	if fixture != "" {
+		var err error
+		body, err = os.ReadFile("testdata/fixtures/" + fixture)
+		if err != nil {
+			t.Fatalf("failed to read fixture %s: %v", fixture, err)
+		}
+	}
+
+	enabled := (&fwcommon.NetFetchOptions{}).Default().EnabledPrefixHandlers
+	for _, h := range nh.prefixHandlers {
+		if !slices.Contains(enabled, h.Name) {
+			continue
+		}
+		if h.ContentTypeContains != "" && !strings.Contains(contentType, h.ContentTypeContains) {
+			continue
+		}
+		if len(h.FilterForUrls) > 0 && !slices.ContainsFunc(h.FilterForUrls, func(f string) bool { return strings.Contains(respUrl, f) }) {
+			continue
+		}
+		prefix := body
+		if len(prefix) > h.PrefixLen {
+			prefix = prefix[:h.PrefixLen]
+		}
+		if !h.Validator(prefix, respUrl) {
+			continue
+		}
+		if h.EventParser != nil {
+			newURL, err := h.EventParser(body, respUrl, "")
+			return h.Name, newURL, err
+		}
+		newURL, err := h.Parser(body, respUrl)
+		return h.Name, newURL, err
+	}
+	return "", "", nil
+}
+
+func TestBuiltinPrefixHandlers(t *testing.T) {
+	nh := newTestNetHandler()
+
+	cases := []struct {
+		fixture     string
+		contentType string
+		url         string
+		handler     string
+		expected    string
+	}{
+		// OneDrive / SharePoint
+		{"onedrive.html", "text/html; charset=utf-8", "https://onedrive.live.com/redir?resid=ABC123%21105&authkey=%21AKey", "onedrive", "https://onedrive.live.com/download?authkey=%21AKey&resid=ABC123%21105"},
+		{"onedrive.html", "text/html; charset=utf-8", "https://onedrive.live.com/?authkey=%21AKey&cid=ABC123&id=ABC123%21105", "onedrive", "https://onedrive.live.com/download?authkey=%21AKey&cid=ABC123&resid=ABC123%21105"},
+		{"sharepoint.html", "text/html; charset=utf-8", "https://contoso-my.sharepoint.com/:b:/g/personal/jdoe_contoso_com/EaBcDeF?e=xYz12", "onedrive", "https://contoso-my.sharepoint.com/:b:/g/personal/jdoe_contoso_com/EaBcDeF?download=1&e=xYz12"},
+		{"sharepoint.html", "text/html; charset=utf-8", "https://contoso-my.sharepoint.com/personal/jdoe_contoso_com/_layouts/15/onedrive.aspx", "", ""},
+		// SourceForge
+		{"sourceforge.html", "text/html; charset=utf-8", "https://sourceforge.net/projects/example-tool/files/releases/1.2.0/example-tool-1.2.0.zip/download", "sourceforge", "https://downloads.sourceforge.net/project/example-tool/releases/1.2.0/example-tool-1.2.0.zip?ts=gAAAAABlkZ8x&use_mirror=netix&r="},
+		{"sourceforge_direct.html", "text/html; charset=utf-8", "https://sourceforge.net/projects/example-tool/files/releases/1.2.0/example-tool-1.2.0.zip/download", "sourceforge", "https://downloads.sourceforge.net/project/example-tool/releases/1.2.0/example-tool-1.2.0.zip?ts=gAAAAABlkZ8x&use_mirror=netix&r="},
+		{"sourceforge.html", "text/html; charset=utf-8", "https://sourceforge.net/projects/example-tool/files/", "", ""},
+		// pixeldrain
+		{"pixeldrain.html", "text/html; charset=utf-8", "https://pixeldrain.com/u/AbCd1234", "pixeldrain", "https://pixeldrain.com/api/file/AbCd1234?download"},
+		{"pixeldrain.html", "text/html; charset=utf-8", "https://pixeldrain.com/l/LsT987", "pixeldrain", "https://pixeldrain.com/api/list/LsT987/zip"},
+		// GitHub
+		{"github_blob.html", "text/html; charset=utf-8", "https://github.com/example/goframework/blob/main/testdata/sample.bin?plain=1", "githubblob", "https://github.com/example/goframework/raw/main/testdata/sample.bin"},
+		{"github_blob.html", "text/html; charset=utf-8", "https://github.com/example/goframework/tree/main/testdata", "", ""},
+		{"github_lfs_pointer.txt", "text/plain; charset=utf-8", "https://raw.githubusercontent.com/example/goframework/main/testdata/sample.bin", "githublfs", "https://media.githubusercontent.com/media/example/goframework/main/testdata/sample.bin"},
+		{"onedrive.html", "text/plain; charset=utf-8", "https://raw.githubusercontent.com/example/goframework/main/README.md", "", ""},
+	}
+
+	for _, c := range cases {
+		handler, newURL, err := resolveWithHandlers(t, nh, c.fixture, c.contentType, c.url)
+		if err != nil {
+			t.Errorf("%s: parser failed: %v", c.url, err)
+			continue
+		}
+		if handler != c.handler || newURL != c.expected {
+			t.Errorf("%s: got %q -> %q, expected %q -> %q", c.url, handler, newURL, c.handler, c.expected)
+		}
+	}
+}
+
+func TestWeTransferPrefixHandler(t *testing.T) {
+	const transferID = "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d20240101120000"
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		if r.Method != http.MethodPost || r.URL.Path != "/"+transferID+"/download" || payload["security_hash"] != "7e8f9a" || payload["intent"] != "entire_transfer" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"direct_link":"https://download.wetransfer.com/eugv/` + transferID + `/example.zip?token=abc"}`))
+	}))
+	defer api.Close()
+
+	nh := newTestNetHandler()
+	nh.weTransferAPI = api.URL
+
+	handler, newURL, err := resolveWithHandlers(t, nh, "wetransfer.html", "text/html; charset=utf-8", "https://wetransfer.com/downloads/"+transferID+"/7e8f9a")
+	if err != nil {
+		t.Fatalf("parser failed: %v", err)
+	}
+	if handler != "wetransfer" || newURL != "https://download.wetransfer.com/eugv/"+transferID+"/example.zip?token=abc" {
+		t.Errorf("got %q -> %q", handler, newURL)
+	}
+
+	// Not a transfer link
+	if handler, _, _ := resolveWithHandlers(t, nh, "wetransfer.html", "text/html", "https://wetransfer.com/about"); handler != "" {
+		t.Errorf("expected no handler for a non-download page, got %q", handler)
+	}
+}
+
+// The api request is a child of the event the handler matched on, like the fetch of the resolved link
+func TestWeTransferPrefixHandlerEvents(t *testing.T) {
+	const transferID = "1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d20240101120000"
+	page, err := os.ReadFile("testdata/fixtures/wetransfer.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/downloads/" + transferID + "/7e8f9a":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+		case "/api/" + transferID + "/download":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"direct_link":"` + server.URL + `/example.zip"}`))
+		case "/example.zip":
+			w.Write([]byte("transfer"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	nh, deb := newRecordingNetHandler()
+	nh.weTransferAPI = server.URL + "/api"
+
+	// wetransfer.com is served by the test server
+	options := (&fwcommon.NetFetchOptions{}).Default()
+	options.Client = &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+	}}}
+	shareUrl := "http://wetransfer.com/downloads/" + transferID + "/7e8f9a"
+	report, err := nh.Fetch(fwcommon.MethodGet, shareUrl, false, false, nil, nil, nil, nil, nil, options, nil)
+	if err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	if string(report.GetNonStreamBytes()) != "transfer" {
+		t.Errorf("unexpected content %q", report.GetNonStreamBytes())
+	}
+
+	deb.mu.Lock()
+	events := map[string]fwcommon.NetworkEvent{}
+	for _, ev := range deb.created {
+		events[ev.Remote] = ev
+	}
+	deb.mu.Unlock()
+	matched, api, file := events[shareUrl], events[server.URL+"/api/"+transferID+"/download"], events[server.URL+"/example.zip"]
+	if matched.ID == "" || api.ID == "" || file.ID == "" {
+		t.Fatalf("expected events for the share link, the api request and the file, got %d events", len(deb.created))
+	}
+	if api.Parent == nil || *api.Parent != matched.ID {
+		t.Errorf("expected the api request to be a child of %s, got %v", matched.ID, api.Parent)
+	}
+	if file.Parent == nil || *file.Parent != matched.ID {
+		t.Errorf("expected the file fetch to be a child of %s, got %v", matched.ID, file.Parent)
+	}
+}
+
+func TestBuiltinRewriteHandlers(t *testing.T) {
+	nh := newTestNetHandler()
+	options := (&fwcommon.NetFetchOptions{}).Default()
+
+	cases := map[string]string{
+		"https://www.dropbox.com/scl/fi/xyz/file.zip?rlkey=abc&dl=0":           "https://www.dropbox.com/scl/fi/xyz/file.zip?dl=1&rlkey=abc",
+		"https://github.com/example/goframework/blob/main/testdata/sample.bin": "https://github.com/example/goframework/raw/main/testdata/sample.bin",
+		"https://pixeldrain.com/u/AbCd1234":                                    "https://pixeldrain.com/api/file/AbCd1234?download",
+		"https://sprend.com/en/download?C=abc123":                              "https://sprend.com/d?C=abc123",
+		"https://example.com/file.zip":                                         "https://example.com/file.zip",
+	}
+	for reqUrl, expected := range cases {
+		newURL, trace := nh.applyRewriteHandlers(reqUrl, options, nil)
+		if newURL != expected {
+			t.Errorf("%s: rewrote to %q, expected %q", reqUrl, newURL, expected)
+		}
+		if (newURL != reqUrl) != (trace.originalRemote == reqUrl && trace.rewrittenBy != "") {
+			t.Errorf("%s: trace not recorded correctly: %+v", reqUrl, trace)
+		}
+	}
+
+	// Not enabled
+	if newURL, _ := nh.applyRewriteHandlers("https://pixeldrain.com/u/AbCd1234", (&fwcommon.NetFetchOptions{}).Empty(), nil); newURL != "https://pixeldrain.com/u/AbCd1234" {
+		t.Errorf("expected no rewrite without enabled handlers, got %q", newURL)
+	}
+}
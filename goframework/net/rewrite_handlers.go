@@ -0,0 +1,85 @@
+package goframework_net
+
+import (
+	"slices"
+	"strings"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Turns a URL-only prefix handler (one that never looks at the body) into a rewriter
+func rewriterFromPrefixHandler(validator func(prefix []byte, respUrl string) bool, parser func(fullBody []byte, respUrl string) (string, error)) func(reqUrl string) (string, bool) {
+	return func(reqUrl string) (string, bool) {
+		if !validator(nil, reqUrl) {
+			return "", false
+		}
+		newURL, err := parser(nil, reqUrl)
+		if err != nil || newURL == "" {
+			return "", false
+		}
+		return newURL, true
+	}
+}
+
+func builtinRewriteHandlers() []fwcommon.RequestRewriteHandler {
+	return []fwcommon.RequestRewriteHandler{
+		{
+			Name:          "dropbox",
+			FilterForUrls: []string{"www.dropbox.com"},
+			Rewriter:      rewriterFromPrefixHandler(isDropboxDl0link, parseDropboxDl0link),
+		},
+		{
+			Name:          "githubblob",
+			FilterForUrls: []string{"github.com"},
+			Rewriter:      rewriterFromPrefixHandler(isGithubBlobLink, parseGithubBlobLink),
+		},
+		{
+			Name:          "pixeldrain",
+			FilterForUrls: []string{"pixeldrain.com", "pixeldrain.net"},
+			Rewriter:      rewriterFromPrefixHandler(isPixeldrainLink, parsePixeldrainLink),
+		},
+		{
+			Name:          "onedrive",
+			FilterForUrls: []string{"onedrive.live.com", "sharepoint.com"},
+			Rewriter:      rewriterFromPrefixHandler(isOneDriveLink, parseOneDriveLink),
+		},
+		{
+			Name:          "sprend",
+			FilterForUrls: []string{"sprend.com"},
+			Rewriter:      rewriterFromPrefixHandler(isSprendLink, parseSprendLink),
+		},
+	}
+}
+
+// Runs the first matching enabled rewrite handler on the URL, returns the URL to request and the trace to record on its event
+func (nh *NetHandler) applyRewriteHandlers(remoteUrl string, options *fwcommon.NetFetchOptions, chain []fwcommon.PrefixHandlerHop) (string, fetchTrace) {
+	trace := fetchTrace{chain: chain}
+
+	if options == nil {
+		options = nh.config.NetFetchOptions
+	}
+	if options == nil || len(options.EnabledRewriteHandlers) == 0 {
+		return remoteUrl, trace
+	}
+
+	for _, h := range nh.rewriteHandlers {
+		if h.Rewriter == nil || !slices.Contains(options.EnabledRewriteHandlers, h.Name) {
+			continue
+		}
+		if len(h.FilterForUrls) > 0 && !slices.ContainsFunc(h.FilterForUrls, func(filter string) bool { return strings.Contains(remoteUrl, filter) }) {
+			continue
+		}
+
+		newURL, ok := h.Rewriter(remoteUrl)
+		if !ok || newURL == "" || newURL == remoteUrl {
+			continue
+		}
+
+		nh.log.Debug("Rewrote " + remoteUrl + " to " + newURL + " with rewrite handler " + h.Name)
+		trace.originalRemote = remoteUrl
+		trace.rewrittenBy = h.Name
+		return newURL, trace
+	}
+
+	return remoteUrl, trace
+}
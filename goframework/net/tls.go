@@ -0,0 +1,145 @@
+package goframework_net
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) by fetches when a host has pins configured in NetFetchOptions.PinnedSPKI and none of the presented certificates matched
+var ErrCertificatePinMismatch = errors.New("certificate pin mismatch")
+
+// Returns the pin for a certificate as used by NetFetchOptions.PinnedSPKI, base64(sha256(SubjectPublicKeyInfo))
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Returns the SPKI pins for all certificates in a PEM bundle, usefull for generating pins from a servers certificate
+func SPKIPinsFromPEM(pemBytes []byte) ([]string, error) {
+	var pins []string
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		pins = append(pins, SPKIPin(cert))
+	}
+	if len(pins) == 0 {
+		return nil, fmt.Errorf("no certificates found in PEM")
+	}
+	return pins, nil
+}
+
+// Returns the pins configured for a host, ports are ignored and "*.example.com" matches any subdomain
+func pinsForHost(pinned map[string][]string, host string) ([]string, bool) {
+	host = strings.ToLower(host)
+	if pins, ok := pinned[host]; ok {
+		return pins, true
+	}
+	for pattern, pins := range pinned {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return pins, true
+		}
+	}
+	return nil, false
+}
+
+// Builds the tls.Config for a fetch from the TLS related NetFetchOptions, returns nil if no TLS options are set
+// fallbackHost is used for pin lookup when no SNI was sent (ex. when connecting to an IP)
+func buildTLSConfig(options *fwcommon.NetFetchOptions, fallbackHost string) (*tls.Config, error) {
+	if !options.InsecureSkipVerify && len(options.RootCAsPEM) == 0 && len(options.ClientCertPEM) == 0 && len(options.PinnedSPKI) == 0 {
+		return nil, nil
+	}
+
+	conf := &tls.Config{InsecureSkipVerify: options.InsecureSkipVerify}
+
+	// Custom root CAs, these replace the system pool unless RootCAsAppendSystem is set
+	if len(options.RootCAsPEM) > 0 {
+		var pool *x509.CertPool
+		if options.RootCAsAppendSystem {
+			systemPool, err := x509.SystemCertPool()
+			if err == nil && systemPool != nil {
+				pool = systemPool
+			}
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(options.RootCAsPEM) {
+			return nil, fmt.Errorf("no valid certificates found in RootCAsPEM")
+		}
+		conf.RootCAs = pool
+	}
+
+	// Client certificate for mTLS
+	if len(options.ClientCertPEM) > 0 {
+		if len(options.ClientKeyPEM) == 0 {
+			return nil, fmt.Errorf("ClientCertPEM is set but ClientKeyPEM is empty")
+		}
+		cert, err := tls.X509KeyPair(options.ClientCertPEM, options.ClientKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	// Pinning, checked after the normal verification (also runs when InsecureSkipVerify is set)
+	if len(options.PinnedSPKI) > 0 {
+		pinned := options.PinnedSPKI
+		conf.VerifyConnection = func(cs tls.ConnectionState) error {
+			host := cs.ServerName
+			if host == "" {
+				host = fallbackHost
+			}
+			pins, ok := pinsForHost(pinned, host)
+			if !ok {
+				return nil
+			}
+			for _, cert := range pinCandidates(cs) {
+				pin := SPKIPin(cert)
+				for _, want := range pins {
+					if pin == strings.TrimPrefix(want, "sha256/") {
+						return nil
+					}
+				}
+			}
+			return fmt.Errorf("%w for host %s", ErrCertificatePinMismatch, host)
+		}
+	}
+
+	return conf, nil
+}
+
+// The certificates a pin may match: those of the verified chains, or only the leaf when verification was skipped.
+// The rest of what the server sent is unverified, a MITM could append the pinned certificate to its own chain.
+// The handshake itself is signed with the leaf's key (crypto/tls checks that even with InsecureSkipVerify), so a pinned leaf can not be replayed.
+func pinCandidates(cs tls.ConnectionState) []*x509.Certificate {
+	if len(cs.VerifiedChains) > 0 {
+		var certs []*x509.Certificate
+		for _, chain := range cs.VerifiedChains {
+			certs = append(certs, chain...)
+		}
+		return certs
+	}
+	if len(cs.PeerCertificates) > 0 {
+		return cs.PeerCertificates[:1]
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package libgoframework
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseSemVer(t *testing.T) {
+	valid := map[string]string{
+		"1.2.3":                      "1.2.3",
+		"v1.2.3":                     "1.2.3",
+		"0.0.0":                      "0.0.0",
+		"1.0.0-alpha.1":              "1.0.0-alpha.1",
+		"1.0.0-0.3.7":                "1.0.0-0.3.7",
+		"1.0.0-x-y-z.--":             "1.0.0-x-y-z.--",
+		"1.0.0+20130313144700":       "1.0.0+20130313144700",
+		"1.0.0-beta+exp.sha.5114f85": "1.0.0-beta+exp.sha.5114f85",
+	}
+	for in, want := range valid {
+		v, err := ParseSemVer(in)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", in, err)
+			continue
+		}
+		if v.String() != want {
+			t.Errorf("%q: expected %q, got %q", in, want, v.String())
+		}
+	}
+
+	for _, in := range []string{"", "1", "1.2", "1.2.3.4", "01.2.3", "1.02.3", "1.2.3-", "1.2.3-01", "1.2.3+", "1.2.3-a..b", "1.2.x", "1.2.3-a_b"} {
+		if _, err := ParseSemVer(in); !errors.Is(err, ErrInvalidSemVer) {
+			t.Errorf("%q: expected ErrInvalidSemVer, got %v", in, err)
+		}
+	}
+}
+
+func TestSemVerCompare(t *testing.T) {
+	// In ascending precedence, from semver.org
+	ordered := []string{
+		"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0",
+		"1.0.1", "1.1.0", "2.0.0", "10.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := ParseSemVer(ordered[i])
+			b, _ := ParseSemVer(ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s vs %s: expected %d, got %d", ordered[i], ordered[j], want, got)
+			}
+		}
+	}
+
+	a, _ := ParseSemVer("1.0.0+build.1")
+	b, _ := ParseSemVer("1.0.0+build.2")
+	if a.Compare(b) != 0 {
+		t.Errorf("expected build metadata to be ignored")
+	}
+}
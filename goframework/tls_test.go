@@ -0,0 +1,119 @@
+package libgoframework
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	fwnet "github.com/sbamboo/goframework/net"
+)
+
+func TestTLSPinning(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("pinned"))
+	}))
+	defer server.Close()
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	pins, err := fwnet.SPKIPinsFromPEM(certPEM)
+	if err != nil {
+		t.Fatalf("failed to compute pins: %v", err)
+	}
+
+	// --- Custom CA bundle without pins ---
+	netOptions := (&NetFetchOptions{}).Empty()
+	netOptions.RootCAsPEM = certPEM
+	fw := SetupFramework(netOptions)
+
+	report, err := fw.Net.Fetch(MethodGet, server.URL, false, false, nil, nil, nil, Ptr("tls.ca"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("fetch with custom CA failed: %v", err)
+	}
+	if content := report.GetNonStreamContent(); content == nil || *content != "pinned" {
+		t.Errorf("unexpected content: %v", content)
+	}
+
+	// --- Matching pin ---
+	netOptions.PinnedSPKI = map[string][]string{"127.0.0.1": pins}
+	_, err = fw.Net.Fetch(MethodGet, server.URL, false, false, nil, nil, nil, Ptr("tls.pin.ok"), nil, netOptions, nil)
+	if err != nil {
+		t.Fatalf("fetch with matching pin failed: %v", err)
+	}
+
+	// --- Mismatching pin ---
+	netOptions.PinnedSPKI = map[string][]string{"127.0.0.1": {"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}
+	report, err = fw.Net.Fetch(MethodGet, server.URL, false, false, nil, nil, nil, Ptr("tls.pin.bad"), nil, netOptions, nil)
+	if err == nil {
+		t.Fatalf("expected pin mismatch error")
+	}
+	if !errors.Is(err, fwnet.ErrCertificatePinMismatch) {
+		t.Errorf("expected ErrCertificatePinMismatch, got: %v", err)
+	}
+	if report == nil || report.GetNetworkEvent().EventState != NetStateFailed {
+		t.Errorf("expected failed network event")
+	}
+}
+
+func TestTLSPinningIgnoresAppendedCertificates(t *testing.T) {
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	pinnedServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer pinnedServer.Close()
+	pinnedPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pinnedServer.Certificate().Raw})
+	pins, err := fwnet.SPKIPinsFromPEM(pinnedPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A self-signed leaf of another key, sent with the pinned certificate appended after it
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "mitm"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mitm := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mitm"))
+	}))
+	mitm.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf, pinnedServer.Certificate().Raw}, PrivateKey: key}}}
+	mitm.StartTLS()
+	defer mitm.Close()
+
+	// Only the leaf counts without verification, only the verified chain with it
+	skipVerify := (&NetFetchOptions{}).Empty()
+	skipVerify.InsecureSkipVerify = true
+	skipVerify.PinnedSPKI = map[string][]string{"127.0.0.1": pins}
+	verified := (&NetFetchOptions{}).Empty()
+	verified.RootCAsPEM = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf}), pinnedPEM...)
+	verified.PinnedSPKI = map[string][]string{"127.0.0.1": pins}
+
+	fw := SetupFramework(skipVerify)
+	for name, options := range map[string]*NetFetchOptions{"insecure": skipVerify, "verified": verified} {
+		_, err := fw.Net.Fetch(MethodGet, mitm.URL, false, false, nil, nil, nil, Ptr("tls.pin.appended"), nil, options, nil)
+		if !errors.Is(err, fwnet.ErrCertificatePinMismatch) {
+			t.Errorf("%s: expected ErrCertificatePinMismatch, got: %v", name, err)
+		}
+	}
+}
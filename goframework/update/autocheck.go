@@ -0,0 +1,223 @@
+package goframework_update
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Returned by StartAutoCheck when the scheduler is already running
+var ErrAutoCheckRunning = errors.New("auto update check is already running")
+
+// What the auto check scheduler does once it finds a newer release
+type AutoUpdatePolicy int
+
+const (
+	AutoUpdateNotify           AutoUpdatePolicy = iota // Only calls OnAvailable
+	AutoUpdateApplyOnExit                              // Stages the release with DownloadUpdate and applies it when the scheduler is stopped (Framework.Close)
+	AutoUpdateApplyImmediately                         // Downloads and applies right away, the new build runs on the next start
+)
+
+// A daily window in local time from Start up to End (hours 0-23), it may wrap past midnight (ex. 22 to 7)
+type QuietHours struct {
+	Start int
+	End   int
+}
+
+// Contains reports whether t falls inside the window, an empty window (Start == End) contains nothing.
+func (q QuietHours) Contains(t time.Time) bool {
+	if q.Start == q.End {
+		return false
+	}
+	hour := t.Hour()
+	if q.Start < q.End {
+		return hour >= q.Start && hour < q.End
+	}
+	return hour >= q.Start || hour < q.End
+}
+
+// Options for StartAutoCheck. The callbacks are called from the scheduler's goroutine.
+type AutoCheckOptions struct {
+	Interval     time.Duration // Time between checks, defaults to 24 hours
+	Jitter       time.Duration // A random 0..Jitter is added to every wait so installs do not all check at once
+	CheckOnStart bool          // Check right away instead of after the first interval
+	Policy       AutoUpdatePolicy
+	QuietHours   *QuietHours // No checks are made inside this window
+	IsMetered    func() bool // Checks are skipped while it returns true, metered connections can not be detected portably so the app provides it
+
+	OnAvailable  func(release *NetUpReleaseInfo) // A newer release was found, called once per release
+	OnDownloaded func(release *NetUpReleaseInfo) // AutoUpdateApplyOnExit: the release is downloaded and will be applied on exit
+	OnApplied    func(release *NetUpReleaseInfo) // The release was applied and runs on the next start
+	OnError      func(err error)                 // A check, download or apply failed, the scheduler keeps running
+}
+
+type autoCheck struct {
+	nu      *NetUpdater
+	options AutoCheckOptions
+	ctx     context.Context // Cancelled by StopAutoCheck, which aborts the fetches of a check in progress
+	stop    context.CancelFunc
+	done    chan struct{}
+
+	// Only touched by the scheduler's goroutine, and by StopAutoCheck once it has ended
+	notified *NetUpReleaseInfo // The newest release OnAvailable was called for
+	handled  *NetUpReleaseInfo // The newest release the policy was carried out for
+	staged   *StagedUpdate     // AutoUpdateApplyOnExit: the download waiting for exit
+}
+
+// StartAutoCheck checks for updates in the background every Interval (plus Jitter) and handles a newer release by the Policy.
+// It runs until StopAutoCheck, which Framework.Close calls.
+func (nu *NetUpdater) StartAutoCheck(options AutoCheckOptions) error {
+	nu.autoCheckMu.Lock()
+	defer nu.autoCheckMu.Unlock()
+	if nu.autoCheck != nil {
+		return nu.logThroughError(ErrAutoCheckRunning)
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = 24 * time.Hour
+	}
+	ctx, stop := context.WithCancel(nu.fetchContext())
+	ac := &autoCheck{
+		nu:      nu,
+		options: options,
+		ctx:     ctx,
+		stop:    stop,
+		done:    make(chan struct{}),
+	}
+	// An update staged before a restart is applied on this exit unless a newer one turns up
+	if options.Policy == AutoUpdateApplyOnExit {
+		if staged, err := nu.GetStagedUpdate(); err == nil && staged != nil && staged.Release != nil && nu.IsNewer(staged.Release) {
+			ac.staged = staged
+			ac.notified = staged.Release
+			ac.handled = staged.Release
+		}
+	}
+	nu.autoCheck = ac
+	go ac.run()
+	return nil
+}
+
+// StopAutoCheck stops the scheduler, aborting the fetches of a check or download in progress and waiting for it to end.
+// With AutoUpdateApplyOnExit a downloaded release is applied now. Does nothing if the scheduler is not running.
+func (nu *NetUpdater) StopAutoCheck() error {
+	nu.autoCheckMu.Lock()
+	ac := nu.autoCheck
+	nu.autoCheck = nil
+	nu.autoCheckMu.Unlock()
+	if ac == nil {
+		return nil
+	}
+
+	ac.stop()
+	<-ac.done
+
+	if ac.staged == nil {
+		return nil
+	}
+	if err := nu.ApplyStaged(ac.staged); err != nil {
+		return err
+	}
+	if ac.options.OnApplied != nil {
+		ac.options.OnApplied(ac.staged.Release)
+	}
+	return nil
+}
+
+func (ac *autoCheck) run() {
+	defer close(ac.done)
+
+	wait := ac.nextWait()
+	if ac.options.CheckOnStart {
+		wait = 0
+	}
+	for {
+		timer := time.NewTimer(wait)
+		select {
+		case <-ac.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		ac.check()
+		wait = ac.nextWait()
+	}
+}
+
+func (ac *autoCheck) nextWait() time.Duration {
+	wait := ac.options.Interval
+	if ac.options.Jitter > 0 {
+		wait += rand.N(ac.options.Jitter)
+	}
+	return wait
+}
+
+func (ac *autoCheck) fail(err error) {
+	if ac.ctx.Err() != nil {
+		return // Aborted by StopAutoCheck
+	}
+	if ac.options.OnError != nil {
+		ac.options.OnError(err)
+	}
+}
+
+func (ac *autoCheck) check() {
+	nu := ac.nu
+	if ac.options.QuietHours != nil && ac.options.QuietHours.Contains(time.Now()) {
+		nu.log.Debug("Skipping update check during quiet hours")
+		return
+	}
+	if ac.options.IsMetered != nil && ac.options.IsMetered() {
+		nu.log.Debug("Skipping update check on a metered connection")
+		return
+	}
+
+	release, err := nu.checkLatestVersion(ac.ctx)
+	if err != nil {
+		ac.fail(err)
+		return
+	}
+	if !nu.IsNewer(release) || !isAfter(release, ac.handled) {
+		return
+	}
+
+	if isAfter(release, ac.notified) {
+		ac.notified = release
+		nu.log.Info(fmt.Sprintf("Update %s (UIND %d) is available", release.Semver, release.UIND))
+		if ac.options.OnAvailable != nil {
+			ac.options.OnAvailable(release)
+		}
+	}
+
+	switch ac.options.Policy {
+	case AutoUpdateApplyOnExit:
+		staged, err := nu.stageUpdate(ac.ctx, release)
+		if err != nil {
+			// A previously staged download may have been discarded already
+			if current, _ := nu.GetStagedUpdate(); current == nil {
+				ac.staged = nil
+			}
+			ac.fail(err)
+			return
+		}
+		ac.staged = staged
+		if ac.options.OnDownloaded != nil {
+			ac.options.OnDownloaded(release)
+		}
+	case AutoUpdateApplyImmediately:
+		if err := nu.performUpdate(ac.ctx, release); err != nil {
+			ac.fail(err)
+			return
+		}
+		if ac.options.OnApplied != nil {
+			ac.options.OnApplied(release)
+		}
+	}
+	ac.handled = release
+}
+
+// Whether release comes after last, a release of another channel (after SwitchChannel) always does
+func isAfter(release *NetUpReleaseInfo, last *NetUpReleaseInfo) bool {
+	return last == nil || release.Channel != last.Channel || release.UIND > last.UIND
+}
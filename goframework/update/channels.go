@@ -0,0 +1,168 @@
+package goframework_update
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) by ListReleases and SwitchChannel for a channel without any releases
+var ErrUnknownChannel = errors.New("unknown update channel")
+
+// Written to the state dir by SwitchChannel, it overrides the build's Channel on the next starts until switched back
+type channelChoice struct {
+	Channel     string    `json:"channel"`
+	FromChannel string    `json:"from_channel"`
+	Switched    time.Time `json:"switched"`
+}
+
+// The channel updates are currently taken from
+func (nu *NetUpdater) channel() string {
+	nu.channelMu.RLock()
+	defer nu.channelMu.RUnlock()
+	return nu.config.UpdatorAppConfiguration.Channel
+}
+
+// Whether the current channel is the one the running build came from, every channel has its own UINDs
+func (nu *NetUpdater) onBuildChannel() bool {
+	return nu.channel() == nu.buildChannel
+}
+
+func (nu *NetUpdater) loadChannelChoice() {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return
+	}
+	var choice channelChoice
+	ok, err := readUpdateState(paths.channel, &choice)
+	if err != nil {
+		nu.log.Warn(fmt.Sprintf("Ignoring unreadable channel choice: %v", err))
+		return
+	}
+	if ok && choice.Channel != "" {
+		nu.config.UpdatorAppConfiguration.Channel = choice.Channel
+	}
+}
+
+// ListChannels returns the names of all channels with releases, from deploy.json if DeployURL is set
+// and from GitHub ("ugit." and "git." channels) if GithubUpMetaRepo is set.
+func (nu *NetUpdater) ListChannels() ([]string, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	remote := ""
+	if conf.DeployURL != nil {
+		remote = *conf.DeployURL
+	}
+	op := nu.startOperation(nu.fetchContext(), "list", remote, nil)
+	channels, err := nu.listChannels(op)
+	return channels, op.finish(err)
+}
+
+func (nu *NetUpdater) listChannels(op *updateOperation) ([]string, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	if (conf.DeployURL == nil || *conf.DeployURL == "") && conf.GhMetaFetcher == nil {
+		return nil, nu.logThroughError(fmt.Errorf("neither deploy.json nor a github update meta repo is configured"))
+	}
+	op.phase(fwcommon.UpdatePhaseChecking)
+
+	var channels []string
+	if conf.DeployURL != nil && *conf.DeployURL != "" {
+		deployFile, err := nu.fetchDeployFile(op)
+		if err != nil {
+			return nil, err
+		}
+		for channel, releases := range deployFile.Channels {
+			if len(releases) > 0 {
+				channels = append(channels, channel)
+			}
+		}
+	}
+	if conf.GhMetaFetcher != nil {
+		for _, prefix := range []string{"ugit.", "git."} {
+			releases, err := nu.fetchGitHubReleases(op, prefix == "ugit.")
+			if err != nil {
+				return nil, err
+			}
+			// Only channels with the matching prefix are read from this kind of release
+			for _, release := range releases {
+				if strings.HasPrefix(release.Channel, prefix) {
+					channels = append(channels, release.Channel)
+				}
+			}
+		}
+	}
+
+	slices.Sort(channels)
+	return slices.Compact(channels), nil
+}
+
+// ListReleases returns every release of the channel with its notes, newest (highest UIND) first.
+// Unlike GetLatestVersion it does not filter by platform or version, check Sources for the Target.
+func (nu *NetUpdater) ListReleases(channel string) ([]*NetUpReleaseInfo, error) {
+	remote := ""
+	if nu.config.UpdatorAppConfiguration.DeployURL != nil {
+		remote = *nu.config.UpdatorAppConfiguration.DeployURL
+	}
+	op := nu.startOperation(nu.fetchContext(), "list", remote, nil)
+	op.phase(fwcommon.UpdatePhaseChecking)
+	releases, err := nu.listReleases(op, channel)
+	return releases, op.finish(err)
+}
+
+func (nu *NetUpdater) listReleases(op *updateOperation, channel string) ([]*NetUpReleaseInfo, error) {
+	releases, err := nu.fetchReleases(op, channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, nu.logThroughError(fmt.Errorf("%w '%s'", ErrUnknownChannel, channel))
+	}
+	slices.SortFunc(releases, func(a, b *NetUpReleaseInfo) int { return b.UIND - a.UIND })
+	return releases, nil
+}
+
+// SwitchChannel makes GetLatestVersion and the auto check take updates from another channel, the choice is kept in the state dir across restarts.
+// Every channel has its own UINDs, so while on another channel than the running build's, releases are compared by SemVer only
+// and the build stays until the channel has a newer version (or AllowDowngrade is set). A staged update of the old channel is discarded.
+// Switching back to the build's own channel drops the choice.
+func (nu *NetUpdater) SwitchChannel(channel string) error {
+	from := nu.channel()
+	if channel == from {
+		return nil
+	}
+
+	if _, err := nu.ListReleases(channel); err != nil {
+		return err
+	}
+
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nu.logThroughError(err)
+	}
+	if err := nu.DiscardStagedUpdate(); err != nil {
+		return err
+	}
+	if channel == nu.buildChannel {
+		if err := os.Remove(paths.channel); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nu.logThroughError(err)
+		}
+	} else {
+		if err := os.MkdirAll(paths.dir, 0755); err != nil {
+			return nu.logThroughError(fmt.Errorf("failed to create update state dir: %w", err))
+		}
+		if err := writeUpdateState(paths.channel, channelChoice{Channel: channel, FromChannel: from, Switched: time.Now()}); err != nil {
+			return nu.logThroughError(fmt.Errorf("failed to record the channel choice: %w", err))
+		}
+	}
+
+	nu.channelMu.Lock()
+	nu.config.UpdatorAppConfiguration.Channel = channel
+	nu.channelMu.Unlock()
+
+	nu.log.Info(fmt.Sprintf("Switched update channel from '%s' to '%s'", from, channel))
+	return nil
+}
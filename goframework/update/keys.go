@@ -0,0 +1,280 @@
+package goframework_update
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/inconshreveable/go-update"
+	fwchck "github.com/sbamboo/goframework/chck"
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) when a signature names a key that is not trusted or was revoked
+var ErrUntrustedKey = errors.New("signing key is not trusted")
+
+// A statement in deploy.json that makes the updater trust a new key on the strength of an already trusted one.
+// Accepted keys are kept in the state dir, so the old key can be dropped once installs have seen the rotation.
+type KeyRotation struct {
+	ID        string `json:"id"`
+	PublicKey string `json:"public_key"`          // PEM
+	SignedBy  string `json:"signed_by,omitempty"` // ID of the trusted key that signed the statement, empty to try every trusted key
+	Signature string `json:"signature"`           // Base64 signature over KeyRotationMessage
+}
+
+// A statement in deploy.json that revokes a key, signed by the revoked key itself or by a key of the build (PublicKeyPEM, TrustedKeys).
+// Keys rotated in by deploy.json can not revoke other keys, so a leaked rotated in key can not lock out the build's keys.
+type KeyRevocation struct {
+	ID        string `json:"id"`
+	SignedBy  string `json:"signed_by,omitempty"`
+	Signature string `json:"signature"` // Base64 signature over KeyRevocationMessage
+}
+
+// The bytes a KeyRotation signature covers
+func KeyRotationMessage(id string, publicKeyPEM string) []byte {
+	return []byte("goframework key rotation\n" + id + "\n" + publicKeyPEM)
+}
+
+// The bytes a KeyRevocation signature covers
+func KeyRevocationMessage(id string) []byte {
+	return []byte("goframework key revocation\n" + id)
+}
+
+// UpdateKeyID returns the ID of a key that has no explicit one, the first 16 hex characters of the sha256 of its DER
+func UpdateKeyID(publicKeyPEM []byte) (string, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return "", fmt.Errorf("couldn't parse PEM data")
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// Rotated in and revoked keys, kept in the state dir
+type keyState struct {
+	Keys    []KeyRotation `json:"keys"`
+	Revoked []string      `json:"revoked"`
+}
+
+type trustedKey struct {
+	id        string
+	algorithm fwcommon.SigAlgorithm // Empty to go by the key type
+	key       crypto.PublicKey
+	root      bool // PublicKeyPEM or TrustedKeys, keys that may revoke others
+}
+
+// The keys signatures are checked against: PublicKeyPEM, TrustedKeys and the keys rotated in by deploy.json, minus the revoked ones
+type keyring struct {
+	keys    []trustedKey
+	revoked []string
+}
+
+func (r *keyring) add(id string, algorithm fwcommon.SigAlgorithm, publicKeyPEM []byte, root bool) error {
+	if id == "" {
+		var err error
+		if id, err = UpdateKeyID(publicKeyPEM); err != nil {
+			return err
+		}
+	}
+	key, err := fwchck.ParsePublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("invalid public key %s: %w", id, err)
+	}
+	if _, err := fwchck.SigAlgorithmFor(key, algorithm); err != nil {
+		return fmt.Errorf("invalid public key %s: %w", id, err)
+	}
+	r.keys = append(r.keys, trustedKey{id: id, algorithm: algorithm, key: key, root: root})
+	return nil
+}
+
+func (r *keyring) trusts(id string) bool {
+	if slices.Contains(r.revoked, id) {
+		return false
+	}
+	return slices.ContainsFunc(r.keys, func(k trustedKey) bool { return k.id == id })
+}
+
+// Verifies signature over content with the key named keyID, or with any trusted key if keyID is empty.
+// Every key verifies with its own algorithm the way fwchck.VerifyMessage does, Ed25519 keys sign the content itself.
+func (r *keyring) verify(keyID string, content []byte, signature []byte) error {
+	if keyID != "" && !r.trusts(keyID) {
+		return fmt.Errorf("%w: %s", ErrUntrustedKey, keyID)
+	}
+	for _, k := range r.keys {
+		if (keyID != "" && k.id != keyID) || slices.Contains(r.revoked, k.id) {
+			continue
+		}
+		if fwchck.VerifyMessage(k.algorithm, k.key, content, signature) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature did not verify against any trusted key")
+}
+
+func (r *keyring) verifyMessage(keyID string, message []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	return r.verify(keyID, message, sig)
+}
+
+// Verifies a revocation against the keys that may sign it: the revoked key itself and the keys of the build
+func (r *keyring) verifyRevocation(revocation KeyRevocation) error {
+	signers := &keyring{revoked: r.revoked}
+	for _, k := range r.keys {
+		if k.root || k.id == revocation.ID {
+			signers.keys = append(signers.keys, k)
+		}
+	}
+	if revocation.SignedBy != "" && r.trusts(revocation.SignedBy) && !signers.trusts(revocation.SignedBy) {
+		return fmt.Errorf("%w: %s may not revoke %s", ErrUntrustedKey, revocation.SignedBy, revocation.ID)
+	}
+	return signers.verifyMessage(revocation.SignedBy, KeyRevocationMessage(revocation.ID), revocation.Signature)
+}
+
+// A go-update Verifier that checks against the keyring instead of the single Options.PublicKey.
+// go-update only hands over the checksum, so the verifier is bound to the content it belongs to with forContent.
+type keyringVerifier struct {
+	ring    *keyring
+	keyID   string
+	content []byte
+}
+
+func (v *keyringVerifier) forContent(content []byte) *keyringVerifier {
+	return &keyringVerifier{ring: v.ring, keyID: v.keyID, content: content}
+}
+
+func (v *keyringVerifier) VerifySignature(checksum []byte, signature []byte, hash crypto.Hash, _ crypto.PublicKey) error {
+	if v.content == nil {
+		return fmt.Errorf("no content to verify the signature over")
+	}
+	if hash != crypto.SHA256 {
+		return fmt.Errorf("unsupported hash %v, updates are checked with sha256", hash)
+	}
+	if sum := sha256.Sum256(v.content); !bytes.Equal(sum[:], checksum) {
+		return fmt.Errorf("checksum does not belong to the verified content")
+	}
+	return v.ring.verify(v.keyID, v.content, signature)
+}
+
+// Sets up go-update to verify the update against the keyring, with the key named keyID or any trusted key
+func (nu *NetUpdater) setUpdateVerifier(opts *update.Options, keyID string) error {
+	ring, err := nu.keyring()
+	if err != nil {
+		return err
+	}
+	opts.PublicKey = ring // go-update only verifies with a PublicKey set, the keyring verifier picks the key itself
+	opts.Verifier = &keyringVerifier{ring: ring, keyID: keyID}
+	return nil
+}
+
+func (nu *NetUpdater) readKeyState() (*updatePaths, *keyState, error) {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nil, nil, err
+	}
+	var state keyState
+	if _, err := readUpdateState(paths.keys, &state); err != nil {
+		return nil, nil, err
+	}
+	return paths, &state, nil
+}
+
+func (nu *NetUpdater) keyring() (*keyring, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	_, state, err := nu.readKeyState()
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &keyring{revoked: slices.Concat(conf.RevokedKeys, state.Revoked)}
+	if len(conf.PublicKeyPEM) > 0 {
+		if err := ring.add("", conf.SigAlgorithm, conf.PublicKeyPEM, true); err != nil {
+			return nil, fmt.Errorf("failed to set public key: %w", err)
+		}
+	}
+	for _, key := range conf.TrustedKeys {
+		if err := ring.add(key.ID, key.Algorithm, key.PublicKeyPEM, true); err != nil {
+			return nil, err
+		}
+	}
+	for _, rotation := range state.Keys {
+		if err := ring.add(rotation.ID, "", []byte(rotation.PublicKey), false); err != nil {
+			nu.log.Warn(fmt.Sprintf("Ignoring rotated in key %s: %v", rotation.ID, err))
+		}
+	}
+	if len(ring.keys) == 0 {
+		return nil, fmt.Errorf("no public key configured")
+	}
+	return ring, nil
+}
+
+// applyKeyStatements takes in the key rotations of deploy.json that are signed by a trusted key, and the revocations signed by a key allowed to make them.
+// A rotated in key can sign further statements, so they are applied until nothing changes. Accepted statements are kept in the state dir.
+func (nu *NetUpdater) applyKeyStatements(rotations []KeyRotation, revocations []KeyRevocation) error {
+	if len(rotations) == 0 && len(revocations) == 0 {
+		return nil
+	}
+	ring, err := nu.keyring()
+	if err != nil {
+		return nu.logThroughError(err)
+	}
+	paths, state, err := nu.readKeyState()
+	if err != nil {
+		return nu.logThroughError(err)
+	}
+
+	changed := false
+	for progress := true; progress; {
+		progress = false
+		for _, revocation := range revocations {
+			if slices.Contains(ring.revoked, revocation.ID) {
+				continue
+			}
+			if err := ring.verifyRevocation(revocation); err != nil {
+				nu.log.Debug(fmt.Sprintf("Skipping revocation of key %s: %v", revocation.ID, err))
+				continue
+			}
+			nu.log.Warn(fmt.Sprintf("Update signing key %s was revoked", revocation.ID))
+			ring.revoked = append(ring.revoked, revocation.ID)
+			state.Revoked = append(state.Revoked, revocation.ID)
+			progress = true
+		}
+		for _, rotation := range rotations {
+			if slices.Contains(ring.revoked, rotation.ID) || slices.ContainsFunc(ring.keys, func(k trustedKey) bool { return k.id == rotation.ID }) {
+				continue
+			}
+			if err := ring.verifyMessage(rotation.SignedBy, KeyRotationMessage(rotation.ID, rotation.PublicKey), rotation.Signature); err != nil {
+				nu.log.Debug(fmt.Sprintf("Skipping rotation to key %s: %v", rotation.ID, err))
+				continue
+			}
+			if err := ring.add(rotation.ID, "", []byte(rotation.PublicKey), false); err != nil {
+				nu.log.Warn(fmt.Sprintf("Skipping rotation to key %s: %v", rotation.ID, err))
+				continue
+			}
+			nu.log.Info(fmt.Sprintf("Trusting rotated in update signing key %s", rotation.ID))
+			state.Keys = append(state.Keys, rotation)
+			progress = true
+		}
+		changed = changed || progress
+	}
+	if !changed {
+		return nil
+	}
+
+	if err := os.MkdirAll(paths.dir, 0755); err != nil {
+		return nu.logThroughError(fmt.Errorf("failed to create update state dir: %w", err))
+	}
+	if err := writeUpdateState(paths.keys, state); err != nil {
+		return nu.logThroughError(fmt.Errorf("failed to record the update signing keys: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package goframework_update
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Returned (wrapped) when deploy.json is not signed by a trusted key although it has to be, or its signature is invalid
+var ErrManifestSignature = errors.New("deploy.json signature is missing or invalid")
+
+// Returned (wrapped) when a signed deploy.json has no expiry or is past it, so a frozen manifest is not trusted forever
+var ErrManifestExpired = errors.New("deploy.json has expired")
+
+// Returned (wrapped) when a signed deploy.json has a lower version than one accepted before
+var ErrManifestRollback = errors.New("deploy.json is older than the one accepted before")
+
+// A deploy.json with an embedded signature, it covers the raw bytes of "signed" which hold the NetUpDeployFile
+type signedDeployFile struct {
+	Signed    json.RawMessage `json:"signed"`
+	Signature string          `json:"signature"`        // Base64
+	KeyID     string          `json:"key_id,omitempty"` // The trusted key that signed it, empty to try every trusted key
+}
+
+// Written to the state dir when a signed deploy.json is accepted, from then on it has to stay signed and may not go back in version
+type manifestState struct {
+	Version  uint64    `json:"version"`
+	Expires  time.Time `json:"expires"`
+	Accepted time.Time `json:"accepted"`
+}
+
+// Verifies signature over content with the trusted keys (the one named keyID if set), the same way binaries are verified
+func (nu *NetUpdater) verifyManifestSignature(content []byte, signature []byte, keyID string) error {
+	ring, err := nu.keyring()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrManifestSignature, err)
+	}
+	if err := ring.verify(keyID, content, signature); err != nil {
+		if errors.Is(err, ErrUntrustedKey) {
+			return fmt.Errorf("%w: %w", ErrManifestSignature, err)
+		}
+		return fmt.Errorf("%w: %v", ErrManifestSignature, err)
+	}
+	return nil
+}
+
+// parseDeployFile parses deploy.json and checks its signature, either embedded ({"signed": ..., "signature": ...})
+// or detached in deploy.json.sig. The detached signature is only fetched if RequireSignedManifest is set or a signed
+// manifest was accepted before, an unsigned deploy.json is refused in both cases.
+// Key rotations and revocations carry their own signatures, they are taken in before the manifest is verified so it can be signed with a new key.
+func (nu *NetUpdater) parseDeployFile(op *updateOperation, url string, content []byte) (*NetUpDeployFile, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nil, nu.logThroughError(err)
+	}
+	var state manifestState
+	pinned, err := readUpdateState(paths.manifest, &state)
+	if err != nil {
+		return nil, nu.logThroughError(err)
+	}
+
+	var envelope signedDeployFile
+	var signed, signature []byte
+	if json.Unmarshal(content, &envelope) == nil && len(envelope.Signed) > 0 {
+		signed = envelope.Signed
+		if signature, err = base64.StdEncoding.DecodeString(envelope.Signature); err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("%w: failed to decode the signature: %v", ErrManifestSignature, err))
+		}
+	} else if conf.RequireSignedManifest || pinned {
+		report, err := op.fetch(url+".sig", false, false, nil)
+		if err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("%w: failed to fetch deploy.json.sig from %s: %v", ErrManifestSignature, url+".sig", err))
+		}
+		if report.GetResponse().StatusCode != http.StatusOK {
+			return nil, nu.logThroughError(fmt.Errorf("%w: fetching deploy.json.sig returned status code %d", ErrManifestSignature, report.GetResponse().StatusCode))
+		}
+		signed, signature = content, report.GetNonStreamBytes()
+	}
+
+	var deployFile NetUpDeployFile
+	if signed == nil {
+		if err := json.Unmarshal(content, &deployFile); err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("failed to unmarshal deploy.json: %w", err))
+		}
+		return &deployFile, nu.applyKeyStatements(deployFile.Keys, deployFile.RevokedKeys)
+	}
+
+	if err := json.Unmarshal(signed, &deployFile); err != nil {
+		return nil, nu.logThroughError(fmt.Errorf("failed to unmarshal deploy.json: %w", err))
+	}
+	if err := nu.applyKeyStatements(deployFile.Keys, deployFile.RevokedKeys); err != nil {
+		return nil, err
+	}
+	if err := nu.verifyManifestSignature(signed, signature, envelope.KeyID); err != nil {
+		return nil, nu.logThroughError(err)
+	}
+	if deployFile.Expires == nil {
+		return nil, nu.logThroughError(fmt.Errorf("%w: a signed deploy.json needs an expiry", ErrManifestExpired))
+	}
+	if time.Now().After(*deployFile.Expires) {
+		return nil, nu.logThroughError(fmt.Errorf("%w at %s", ErrManifestExpired, deployFile.Expires.Format(time.RFC3339)))
+	}
+	if pinned && deployFile.Version < state.Version {
+		return nil, nu.logThroughError(fmt.Errorf("%w: version %d, accepted %d before", ErrManifestRollback, deployFile.Version, state.Version))
+	}
+
+	if !pinned || deployFile.Version > state.Version {
+		if err := os.MkdirAll(paths.dir, 0755); err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("failed to create update state dir: %w", err))
+		}
+		if err := writeUpdateState(paths.manifest, manifestState{Version: deployFile.Version, Expires: *deployFile.Expires, Accepted: time.Now()}); err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("failed to record the deploy.json version: %w", err))
+		}
+	}
+	return &deployFile, nil
+}
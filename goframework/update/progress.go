@@ -0,0 +1,154 @@
+package goframework_update
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// One update operation (a check, update, download or apply). It is the parent event of the operation's fetches
+// and reports every phase to UpdatorAppConfiguration.Progressor and the debugger (update:progress).
+type updateOperation struct {
+	nu       *NetUpdater
+	ctx      context.Context // The operation's fetches are aborted once it is cancelled
+	mu       sync.Mutex
+	event    fwcommon.NetworkEvent
+	progress fwcommon.UpdateProgress
+	done     bool
+}
+
+// The context operations run in when the caller gives none, NetFetchOptions.Context if set
+func (nu *NetUpdater) fetchContext() context.Context {
+	if options := nu.config.NetFetchOptions; options != nil && options.Context != nil {
+		return *options.Context
+	}
+	return context.Background()
+}
+
+func (nu *NetUpdater) startOperation(ctx context.Context, operation string, remote string, release *NetUpReleaseInfo) *updateOperation {
+	id := fmt.Sprintf("Fw.Update:%d", fwcommon.FrameworkIndexes.GetNewOfIndex("netevent"))
+	op := &updateOperation{
+		nu:  nu,
+		ctx: ctx,
+		event: fwcommon.NetworkEvent{
+			ID:              id,
+			Context:         fwcommon.Ptr("Fw.Update"),
+			Initiator:       fwcommon.Ptr(fwcommon.ElementIdentifier("Fw.Update." + operation)),
+			Method:          fwcommon.MethodGet,
+			NetFetchOptions: nu.config.NetFetchOptions,
+			MetaDirection:   fwcommon.NetOutgoing,
+			Remote:          remote,
+			Size:            -1,
+			EventState:      fwcommon.NetStateWaiting,
+		},
+		progress: fwcommon.UpdateProgress{ID: id, Operation: operation, Size: -1},
+	}
+	if release != nil {
+		op.progress.UIND = release.UIND
+		op.progress.Semver = release.Semver
+	}
+	if nu.deb.IsActive() {
+		nu.deb.NetCreate(op.event)
+	}
+	return op
+}
+
+func (op *updateOperation) id() *string {
+	return fwcommon.Ptr(op.event.ID)
+}
+
+// Sends the current progress, the caller holds op.mu
+func (op *updateOperation) report() {
+	progress := op.progress
+	if fn := op.nu.config.UpdatorAppConfiguration.Progressor; fn != nil {
+		fn(progress)
+	}
+	if op.nu.deb.IsActive() {
+		op.nu.deb.UpdateProgress(progress)
+	}
+}
+
+func (op *updateOperation) setRelease(release *NetUpReleaseInfo) {
+	if release == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.progress.UIND = release.UIND
+	op.progress.Semver = release.Semver
+}
+
+func (op *updateOperation) phase(phase fwcommon.UpdatePhase) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.done {
+		return
+	}
+	op.progress.Phase = phase
+	op.report()
+}
+
+// Relays the bytes of the download while in the downloading phase
+func (op *updateOperation) progressor(progressPtr fwcommon.NetworkProgressReportInterface, err error) {
+	event := progressPtr.GetNetworkEvent()
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.done || op.progress.Phase != fwcommon.UpdatePhaseDownloading {
+		return
+	}
+	op.progress.Transferred = event.Transferred
+	op.progress.Size = event.Size
+	op.report()
+}
+
+// Fetches url as a child of the operation, within the operation's context
+func (op *updateOperation) fetch(url string, stream bool, file bool, fileout *string) (fwcommon.NetworkProgressReportInterface, error) {
+	options := *op.nu.config.NetFetchOptions
+	options.Context = &op.ctx
+	report, err := op.nu.fetcher.Fetch(fwcommon.MethodGet, url, stream, file, fileout, op.progressor, nil, op.event.Context, op.event.Initiator, &options, op.id())
+	if report != nil {
+		if event := report.GetNetworkEvent(); event != nil {
+			op.mu.Lock()
+			op.event.Status = event.Status
+			op.event.Size = event.Size
+			op.event.Transferred = event.Transferred
+			op.mu.Unlock()
+		}
+	}
+	return report, err
+}
+
+// Fetches the whole content of url as a child of the operation
+func (op *updateOperation) fetchBytes(url string) ([]byte, error) {
+	report, err := op.fetch(url, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return report.GetNonStreamBytes(), nil
+}
+
+// Ends the operation with done or failed, only the first call counts. Returns err so it can wrap a return.
+func (op *updateOperation) finish(err error) error {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.done {
+		return err
+	}
+	op.done = true
+
+	op.event.EventSuccess = err == nil
+	op.event.EventState = fwcommon.NetStateFinished
+	op.progress.Phase = fwcommon.UpdatePhaseDone
+	if err != nil {
+		op.event.EventState = fwcommon.NetStateFailed
+		op.progress.Phase = fwcommon.UpdatePhaseFailed
+		op.progress.Error = err.Error()
+	}
+	op.report()
+	if op.nu.deb.IsActive() {
+		op.nu.deb.NetStopWFUpdate(op.event)
+	}
+	return err
+}
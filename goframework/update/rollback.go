@@ -0,0 +1,252 @@
+package goframework_update
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Written to the state dir when an update is applied, removed again by ConfirmUpdate or a rollback
+type PendingUpdate struct {
+	FromUIND    int        `json:"from_uind"`
+	FromSemver  string     `json:"from_semver"`
+	ToUIND      int        `json:"to_uind"`
+	ToSemver    string     `json:"to_semver"`
+	Executable  string     `json:"executable"`
+	Backup      string     `json:"backup"` // The previous binary
+	Applied     time.Time  `json:"applied"`
+	FirstLaunch *time.Time `json:"first_launch,omitempty"`
+	Launches    int        `json:"launches"`
+}
+
+// Describes a rolled back update. CheckPendingUpdate returns it in the failed build that restored the previous binary (RestartRequired)
+// and once more in the restored build on its next start so it can report the failure.
+type UpdateRollback struct {
+	FromUIND        int       `json:"from_uind"`
+	FromSemver      string    `json:"from_semver"`
+	ToUIND          int       `json:"to_uind"`
+	ToSemver        string    `json:"to_semver"`
+	Reason          string    `json:"reason"`
+	RolledBack      time.Time `json:"rolled_back"`
+	RestartRequired bool      `json:"-"` // The running process is the failed build, the app should exit or restart itself
+}
+
+type updatePaths struct {
+	executable string
+	dir        string
+	backup     string // The previous binary, go-update's OldSavePath
+	failed     string // Where a rolled back binary is moved aside
+	pending    string
+	rollback   string
+	staged     string // The StagedUpdate record, the download itself sits beside it
+	channel    string // The channel chosen with SwitchChannel
+	manifest   string // The version of the last signed deploy.json accepted
+	keys       string // Signing keys rotated in or revoked by deploy.json
+}
+
+func (nu *NetUpdater) updatePaths() (*updatePaths, error) {
+	conf := nu.config.UpdatorAppConfiguration
+
+	var exe string
+	if conf.ExecutablePath != nil && *conf.ExecutablePath != "" {
+		exe = *conf.ExecutablePath
+	} else {
+		var err error
+		if exe, err = os.Executable(); err != nil {
+			return nil, fmt.Errorf("failed to locate the executable: %w", err)
+		}
+		if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+			exe = resolved
+		}
+	}
+
+	dir := filepath.Join(filepath.Dir(exe), "."+filepath.Base(exe)+".update")
+	if conf.StateDir != nil && *conf.StateDir != "" {
+		dir = *conf.StateDir
+	}
+
+	ext := filepath.Ext(exe)
+	return &updatePaths{
+		executable: exe,
+		dir:        dir,
+		backup:     filepath.Join(dir, "previous"+ext),
+		failed:     filepath.Join(dir, "failed"+ext),
+		pending:    filepath.Join(dir, "pending.json"),
+		rollback:   filepath.Join(dir, "rollback.json"),
+		staged:     filepath.Join(dir, "staged.json"),
+		channel:    filepath.Join(dir, "channel.json"),
+		manifest:   filepath.Join(dir, "manifest.json"),
+		keys:       filepath.Join(dir, "keys.json"),
+	}, nil
+}
+
+// Reads a JSON state file into v, false if it does not exist
+func readUpdateState(path string, v any) (bool, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return false, fmt.Errorf("invalid update state %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Writes through a temporary file so a crash never leaves a half written state file
+func writeUpdateState(path string, v any) error {
+	content, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// The update waiting to be confirmed, nil if there is none
+func (nu *NetUpdater) GetPendingUpdate() (*PendingUpdate, error) {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nil, err
+	}
+	var pending PendingUpdate
+	ok, err := readUpdateState(paths.pending, &pending)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return &pending, nil
+}
+
+// Called by the new build once it is healthy, until then CheckPendingUpdate may roll it back
+func (nu *NetUpdater) ConfirmUpdate() error {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nu.logThroughError(err)
+	}
+	pending, err := nu.GetPendingUpdate()
+	if err != nil || pending == nil {
+		return nu.logThroughError(err)
+	}
+	if pending.ToUIND != nu.config.UpdatorAppConfiguration.UIND {
+		return nu.logThroughError(fmt.Errorf("pending update is for UIND %d but this is UIND %d", pending.ToUIND, nu.config.UpdatorAppConfiguration.UIND))
+	}
+	if err := os.Remove(paths.pending); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nu.logThroughError(err)
+	}
+	nu.log.Info(fmt.Sprintf("Update to %s (UIND %d) confirmed", pending.ToSemver, pending.ToUIND))
+	return nil
+}
+
+// Should be called early on every start. Counts the launches of an applied update and once it has used up
+// HealthLaunches or HealthTimeout without calling ConfirmUpdate the previous binary is restored.
+// Returns the rollback if one happened now (RestartRequired) or, once, in the build that was restored.
+func (nu *NetUpdater) CheckPendingUpdate() (*UpdateRollback, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nil, nu.logThroughError(err)
+	}
+
+	pending, err := nu.GetPendingUpdate()
+	if err != nil {
+		return nil, nu.logThroughError(err)
+	}
+	if pending == nil {
+		// The restored build reports the rollback once
+		var report UpdateRollback
+		ok, err := readUpdateState(paths.rollback, &report)
+		if !ok || err != nil || report.ToUIND == conf.UIND {
+			return nil, nu.logThroughError(err)
+		}
+		os.Remove(paths.rollback)
+		return &report, nil
+	}
+
+	if pending.ToUIND != conf.UIND {
+		// The applied build is no longer what is running (ex. replaced by hand), nothing to watch over
+		nu.log.Warn(fmt.Sprintf("Pending update to UIND %d is not installed (running UIND %d), dropping it", pending.ToUIND, conf.UIND))
+		return nil, nu.logThroughError(os.Remove(paths.pending))
+	}
+
+	now := time.Now()
+	if pending.FirstLaunch == nil {
+		pending.FirstLaunch = &now
+	}
+	pending.Launches++
+
+	launches := conf.HealthLaunches
+	if launches <= 0 {
+		launches = 3
+	}
+	reason := ""
+	if pending.Launches > launches {
+		reason = fmt.Sprintf("update was not confirmed within %d launches", launches)
+	} else if conf.HealthTimeout > 0 && now.Sub(*pending.FirstLaunch) > time.Duration(conf.HealthTimeout)*time.Second {
+		reason = fmt.Sprintf("update was not confirmed within %d seconds", conf.HealthTimeout)
+	}
+	if reason == "" {
+		return nil, nu.logThroughError(writeUpdateState(paths.pending, pending))
+	}
+	return nu.rollback(paths, pending, reason)
+}
+
+// Restores the previous binary of the pending update right away, for when the app knows the new build is broken
+func (nu *NetUpdater) RollbackUpdate(reason string) (*UpdateRollback, error) {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nil, nu.logThroughError(err)
+	}
+	pending, err := nu.GetPendingUpdate()
+	if err != nil {
+		return nil, nu.logThroughError(err)
+	}
+	if pending == nil {
+		return nil, nu.logThroughError(fmt.Errorf("no pending update to roll back"))
+	}
+	return nu.rollback(paths, pending, reason)
+}
+
+func (nu *NetUpdater) rollback(paths *updatePaths, pending *PendingUpdate, reason string) (*UpdateRollback, error) {
+	if _, err := os.Stat(pending.Backup); err != nil {
+		return nil, nu.logThroughError(fmt.Errorf("can not roll back, previous binary is missing: %w", err))
+	}
+
+	// The failed binary is moved aside first, windows allows renaming a running executable but not replacing it
+	os.Remove(paths.failed)
+	if err := os.Rename(pending.Executable, paths.failed); err != nil {
+		return nil, nu.logThroughError(fmt.Errorf("failed to move the failed update aside: %w", err))
+	}
+	if err := os.Rename(pending.Backup, pending.Executable); err != nil {
+		if rerr := os.Rename(paths.failed, pending.Executable); rerr != nil {
+			return nil, nu.logThroughError(fmt.Errorf("failed to restore the previous binary: %w, and to put the update back: %v", err, rerr))
+		}
+		return nil, nu.logThroughError(fmt.Errorf("failed to restore the previous binary: %w", err))
+	}
+
+	report := &UpdateRollback{
+		FromUIND:   pending.FromUIND,
+		FromSemver: pending.FromSemver,
+		ToUIND:     pending.ToUIND,
+		ToSemver:   pending.ToSemver,
+		Reason:     reason,
+		RolledBack: time.Now(),
+	}
+	if err := writeUpdateState(paths.rollback, report); err != nil {
+		nu.log.Warn(fmt.Sprintf("Failed to record the rollback: %v", err))
+	}
+	if err := os.Remove(paths.pending); err != nil && !errors.Is(err, os.ErrNotExist) {
+		nu.log.Warn(fmt.Sprintf("Failed to remove the pending update marker: %v", err))
+	}
+
+	nu.log.Warn(fmt.Sprintf("Rolled back update to %s (UIND %d): %s", pending.ToSemver, pending.ToUIND, reason))
+	report.RestartRequired = true
+	return report, nil
+}
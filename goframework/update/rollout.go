@@ -0,0 +1,131 @@
+package goframework_update
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) by GetLatestVersion when the newer releases have not been rolled out to this installation yet
+var ErrUpdateRollout = errors.New("release is not rolled out to this installation yet")
+
+// A group of installs a staged rollout is limited to, every set field has to match
+type RolloutCohort struct {
+	Platforms  []string `json:"platforms,omitempty"`   // Targets ("<platform>-<arch>") in the cohort
+	MinVersion *string  `json:"min_version,omitempty"` // The running version has to be at least this
+	Rollout    *float64 `json:"rollout,omitempty"`     // Percentage for this cohort, nil for the release's rollout
+}
+
+func (c *RolloutCohort) matches(target string, current *fwcommon.SemVer) bool {
+	if len(c.Platforms) > 0 && !slices.Contains(c.Platforms, target) {
+		return false
+	}
+	if c.MinVersion != nil && *c.MinVersion != "" {
+		bound, err := fwcommon.ParseSemVer(*c.MinVersion)
+		if err != nil || current == nil || current.Compare(bound) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Where the installation ID is kept
+func (nu *NetUpdater) configDir() (string, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	if conf.ConfigDir != nil && *conf.ConfigDir != "" {
+		return *conf.ConfigDir, nil
+	}
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return "", err
+	}
+	if dir, err := os.UserConfigDir(); err == nil && dir != "" {
+		name := filepath.Base(paths.executable)
+		return filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name))), nil
+	}
+	return paths.dir, nil
+}
+
+// InstallationID returns the random ID of this installation, created on first use and kept in ConfigDir.
+// Staged rollouts are evaluated against it so the same install always gets the same answer.
+func (nu *NetUpdater) InstallationID() (string, error) {
+	nu.installIDMu.Lock()
+	defer nu.installIDMu.Unlock()
+	if nu.installID != "" {
+		return nu.installID, nil
+	}
+
+	dir, err := nu.configDir()
+	if err != nil {
+		return "", nu.logThroughError(err)
+	}
+	path := filepath.Join(dir, "installation-id")
+	if content, err := os.ReadFile(path); err == nil && len(strings.TrimSpace(string(content))) > 0 {
+		nu.installID = strings.TrimSpace(string(content))
+		return nu.installID, nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", nu.logThroughError(fmt.Errorf("failed to read the installation ID: %w", err))
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nu.logThroughError(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", nu.logThroughError(fmt.Errorf("failed to create config dir: %w", err))
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(id)), 0644); err != nil {
+		return "", nu.logThroughError(fmt.Errorf("failed to write the installation ID: %w", err))
+	}
+	nu.installID = hex.EncodeToString(id)
+	return nu.installID, nil
+}
+
+// The rollout bucket (0-100) of this installation for a release. It is derived from the installation ID and the release,
+// so raising the percentage only adds installs and each release picks a different first group.
+func rolloutBucket(installID string, channel string, uind int) float64 {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%d", installID, channel, uind)))
+	return float64(binary.BigEndian.Uint64(sum[:8])%10000) / 100
+}
+
+// inRollout reports whether the release is rolled out to this installation: it has to match one of the release's cohorts
+// (if any) and fall within the cohort's or release's rollout percentage.
+func (nu *NetUpdater) inRollout(release *NetUpReleaseInfo, current *fwcommon.SemVer) (bool, error) {
+	percent := release.Rollout
+	if len(release.Cohorts) > 0 {
+		var cohort *RolloutCohort
+		for i := range release.Cohorts {
+			if release.Cohorts[i].matches(nu.config.UpdatorAppConfiguration.Target, current) {
+				cohort = &release.Cohorts[i]
+				break
+			}
+		}
+		if cohort == nil {
+			return false, nil
+		}
+		if cohort.Rollout != nil {
+			percent = cohort.Rollout
+		}
+	}
+	if percent == nil || *percent >= 100 {
+		return true, nil
+	}
+	if *percent <= 0 {
+		return false, nil
+	}
+
+	id, err := nu.InstallationID()
+	if err != nil {
+		return false, err
+	}
+	return rolloutBucket(id, release.Channel, release.UIND) < *percent, nil
+}
@@ -0,0 +1,204 @@
+package goframework_update
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/inconshreveable/go-update"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) when a downloaded or staged update does not match its checksum or signature
+var ErrUpdateVerification = errors.New("update verification failed")
+
+// Returned (wrapped) by ApplyStaged when the staged update no longer applies to the running build
+var ErrStagedUpdateStale = errors.New("staged update does not apply to the running build")
+
+// A downloaded and verified update waiting in the state dir. It is recorded in staged.json so it survives restarts, see GetStagedUpdate.
+type StagedUpdate struct {
+	Release      *NetUpReleaseInfo `json:"release"`
+	Path         string            `json:"path"` // The downloaded binary or patch
+	IsPatch      bool              `json:"is_patch"`
+	ForUIND      int               `json:"for_uind"`         // The build it was downloaded by, a patch only applies to it
+	FileChecksum string            `json:"file_checksum"`    // Hex sha256 of the file at Path, checked again before applying
+	Checksum     string            `json:"checksum"`         // Hex sha256 of the resulting binary
+	Signature    string            `json:"signature"`        // Base64 signature of the resulting binary
+	KeyID        string            `json:"key_id,omitempty"` // The key the signature was made with, empty for any trusted key
+	Downloaded   time.Time         `json:"downloaded"`
+}
+
+// DownloadUpdate downloads the patch or full binary of the release into the state dir and verifies it, without applying it.
+// Every phase is reported to UpdatorAppConfiguration.Progressor and the debugger, the download is a child event of the operation.
+// Only one update is staged at a time, a previously staged one is discarded.
+func (nu *NetUpdater) DownloadUpdate(release *NetUpReleaseInfo) (*StagedUpdate, error) {
+	return nu.stageUpdate(nu.fetchContext(), release)
+}
+
+// DownloadUpdate with the download aborted once ctx is cancelled
+func (nu *NetUpdater) stageUpdate(ctx context.Context, release *NetUpReleaseInfo) (*StagedUpdate, error) {
+	op := nu.startOperation(ctx, "download", "", release)
+	staged, err := nu.downloadUpdate(op, release)
+	return staged, op.finish(err)
+}
+
+func (nu *NetUpdater) downloadUpdate(op *updateOperation, release *NetUpReleaseInfo) (*StagedUpdate, error) {
+	prepared, err := nu.prepareUpdate(op, release)
+	if err != nil {
+		return nil, err
+	}
+	if err := nu.DiscardStagedUpdate(); err != nil {
+		return nil, err
+	}
+	op.event.Remote = prepared.downloadURL
+
+	isPatch := prepared.opts.Patcher != nil
+	path := filepath.Join(prepared.paths.dir, "staged"+filepath.Ext(prepared.paths.executable))
+	if isPatch {
+		path = filepath.Join(prepared.paths.dir, "staged.patch")
+	}
+	part := path + ".part"
+
+	op.phase(fwcommon.UpdatePhaseDownloading)
+	report, err := op.fetch(prepared.downloadURL, true, true, &part)
+	if report != nil {
+		report.Close()
+	}
+	if err != nil {
+		os.Remove(part)
+		return nil, nu.logThroughError(fmt.Errorf("failed to download update from %s: %w", prepared.downloadURL, err))
+	}
+
+	content, err := os.ReadFile(part)
+	if err != nil {
+		return nil, nu.logThroughError(fmt.Errorf("failed to read the downloaded update: %w", err))
+	}
+	if _, err := nu.patchAndVerify(op, &prepared.opts, content); err != nil {
+		os.Remove(part)
+		return nil, err
+	}
+	if err := os.Rename(part, path); err != nil {
+		return nil, nu.logThroughError(fmt.Errorf("failed to stage the update: %w", err))
+	}
+
+	fileChecksum := sha256.Sum256(content)
+	staged := &StagedUpdate{
+		Release:      release,
+		Path:         path,
+		IsPatch:      isPatch,
+		ForUIND:      nu.config.UpdatorAppConfiguration.UIND,
+		FileChecksum: hex.EncodeToString(fileChecksum[:]),
+		Checksum:     hex.EncodeToString(prepared.opts.Checksum),
+		Signature:    base64.StdEncoding.EncodeToString(prepared.opts.Signature),
+		KeyID:        prepared.keyID,
+		Downloaded:   time.Now(),
+	}
+	if err := writeUpdateState(prepared.paths.staged, staged); err != nil {
+		os.Remove(path)
+		return nil, nu.logThroughError(fmt.Errorf("failed to record the staged update: %w", err))
+	}
+
+	nu.log.Info(fmt.Sprintf("Update %s (UIND %d) downloaded and staged", release.Semver, release.UIND))
+	return staged, nil
+}
+
+// The update staged by DownloadUpdate, also after a restart. Nil if there is none.
+func (nu *NetUpdater) GetStagedUpdate() (*StagedUpdate, error) {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nil, err
+	}
+	var staged StagedUpdate
+	ok, err := readUpdateState(paths.staged, &staged)
+	if !ok || err != nil {
+		return nil, err
+	}
+	return &staged, nil
+}
+
+// Removes the staged update and its download, does nothing if there is none
+func (nu *NetUpdater) DiscardStagedUpdate() error {
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return nu.logThroughError(err)
+	}
+	staged, err := nu.GetStagedUpdate()
+	if err != nil {
+		nu.log.Warn(fmt.Sprintf("Discarding unreadable staged update: %v", err))
+	}
+	if staged != nil {
+		if err := os.Remove(staged.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nu.logThroughError(err)
+		}
+	}
+	if err := os.Remove(paths.staged); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nu.logThroughError(err)
+	}
+	return nil
+}
+
+// ApplyStaged applies an update staged by DownloadUpdate and removes it from the state dir.
+// The download is checked against its recorded checksum again and go-update verifies the result before replacing the executable.
+// A staged update that no longer fits the running build (an older release, one of another channel, or a patch for another build) is discarded with ErrStagedUpdateStale.
+func (nu *NetUpdater) ApplyStaged(staged *StagedUpdate) error {
+	if staged == nil || staged.Release == nil {
+		return nu.logThroughError(fmt.Errorf("no staged update"))
+	}
+	op := nu.startOperation(nu.fetchContext(), "apply", staged.Path, staged.Release)
+	return op.finish(nu.applyStaged(op, staged))
+}
+
+func (nu *NetUpdater) applyStaged(op *updateOperation, staged *StagedUpdate) error {
+	uind := nu.config.UpdatorAppConfiguration.UIND
+	otherChannel := staged.Release.Channel != "" && staged.Release.Channel != nu.channel()
+	if otherChannel || !nu.IsNewer(staged.Release) || (staged.IsPatch && staged.ForUIND != uind) {
+		nu.DiscardStagedUpdate()
+		return nu.logThroughError(fmt.Errorf("%w: staged UIND %d on channel '%s' (downloaded by UIND %d), running UIND %d on channel '%s'", ErrStagedUpdateStale, staged.Release.UIND, staged.Release.Channel, staged.ForUIND, uind, nu.channel()))
+	}
+
+	op.phase(fwcommon.UpdatePhaseVerifying)
+	content, err := os.ReadFile(staged.Path)
+	if err != nil {
+		return nu.logThroughError(fmt.Errorf("failed to read the staged update: %w", err))
+	}
+	if fileChecksum := sha256.Sum256(content); hex.EncodeToString(fileChecksum[:]) != staged.FileChecksum {
+		nu.DiscardStagedUpdate()
+		return nu.logThroughError(fmt.Errorf("%w: the staged file was modified", ErrUpdateVerification))
+	}
+
+	opts, paths, previousPending, err := nu.newUpdateOptions(staged.KeyID)
+	if err != nil {
+		return err
+	}
+	if opts.Checksum, err = hex.DecodeString(staged.Checksum); err != nil {
+		return nu.logThroughError(fmt.Errorf("invalid staged checksum: %w", err))
+	}
+	if opts.Signature, err = base64.StdEncoding.DecodeString(staged.Signature); err != nil {
+		return nu.logThroughError(fmt.Errorf("invalid staged signature: %w", err))
+	}
+	if staged.IsPatch {
+		opts.Patcher = update.NewBSDiffPatcher()
+	}
+
+	updated, err := nu.patchAndVerify(op, &opts, content)
+	if err != nil {
+		return err
+	}
+	err = nu.applyUpdate(op, &preparedUpdate{
+		release:  staged.Release,
+		opts:     opts,
+		paths:    paths,
+		previous: previousPending,
+	}, updated)
+	if err != nil {
+		return err
+	}
+	return nu.DiscardStagedUpdate()
+}
@@ -1,16 +1,20 @@
 package goframework_update
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/inconshreveable/go-update"
 	"gopkg.in/yaml.v3"
@@ -39,8 +43,8 @@ func NewGithubUpdateFetcher(owner, repo string, fetcher fwcommon.FetcherInterfac
 
 // FetchUpMetaReleases fetches releases from GitHub, parses their bodies
 // for UpMeta, and attaches asset URLs, returning processed release data.
-func (ghup *GithubUpdateFetcher) FetchUpMetaReleases() ([]fwcommon.UpdateReleaseData, error) {
-	releases, err := ghup.fetchReleases()
+func (ghup *GithubUpdateFetcher) FetchUpMetaReleases(fetch fwcommon.GithubReleasesFetchFn) ([]fwcommon.UpdateReleaseData, error) {
+	releases, err := ghup.fetchReleases(fetch)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching releases: %w", err)
 	}
@@ -50,7 +54,7 @@ func (ghup *GithubUpdateFetcher) FetchUpMetaReleases() ([]fwcommon.UpdateRelease
 	for _, rel := range releases {
 		notes, upmeta, err := ghup.parseReleaseBodyForUpMeta(rel.Body)
 		if err != nil {
-			fmt.Printf("ERROR parsing release body for tag %s: %v\n", rel.TagName, err)
+			ghup.logger.Warn(fmt.Sprintf("Failed to parse the release body of tag %s: %v", rel.TagName, err))
 			continue
 		}
 
@@ -86,8 +90,8 @@ func (ghup *GithubUpdateFetcher) FetchUpMetaReleases() ([]fwcommon.UpdateRelease
 }
 
 // FetchAssetReleases fetches releases from GitHub, parses their tags and assets for metadata.
-func (ghup *GithubUpdateFetcher) FetchAssetReleases() ([]fwcommon.UpdateReleaseData, error) {
-	releases, err := ghup.fetchReleases()
+func (ghup *GithubUpdateFetcher) FetchAssetReleases(fetch fwcommon.GithubReleasesFetchFn) ([]fwcommon.UpdateReleaseData, error) {
+	releases, err := ghup.fetchReleases(fetch)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching releases: %w", err)
 	}
@@ -102,7 +106,7 @@ func (ghup *GithubUpdateFetcher) FetchAssetReleases() ([]fwcommon.UpdateReleaseD
 		if strings.HasPrefix(rel.TagName, "ci-") {
 			upmeta, parseErr = ghup.parseAssetReleaseForMeta(rel.TagName)
 			if parseErr != nil {
-				fmt.Printf("ERROR parsing tag %s: %v\n", rel.TagName, parseErr)
+				ghup.logger.Warn(fmt.Sprintf("Failed to parse tag %s: %v", rel.TagName, parseErr))
 				// Continue processing the release even if tag parsing fails, just won't have upmeta
 				upmeta = nil
 			}
@@ -134,7 +138,7 @@ func (ghup *GithubUpdateFetcher) FetchAssetReleases() ([]fwcommon.UpdateReleaseD
 				// Derive the source key (platform-arch)
 				sourceKey := extractPlatformArch(asset.Name)
 				if sourceKey == "" {
-					fmt.Printf("WARNING: Could not determine platform-arch for asset '%s'. Skipping.\n", asset.Name)
+					ghup.logger.Debug(fmt.Sprintf("Could not determine platform-arch for asset '%s', skipping", asset.Name))
 					continue
 				}
 
@@ -158,7 +162,7 @@ func (ghup *GithubUpdateFetcher) FetchAssetReleases() ([]fwcommon.UpdateReleaseD
 				if digestParts := strings.SplitN(asset.Digest, ":", 2); len(digestParts) == 2 && digestParts[0] == "sha256" {
 					source.Checksum = digestParts[1]
 				} else {
-					fmt.Printf("WARNING: Unexpected digest format for asset %s: %s\n", asset.Name, asset.Digest)
+					ghup.logger.Warn(fmt.Sprintf("Unexpected digest format for asset %s: %s", asset.Name, asset.Digest))
 					source.Checksum = ""
 				}
 
@@ -254,16 +258,19 @@ func (ghup *GithubUpdateFetcher) parseAssetReleaseForMeta(tagName string) (*fwco
 }
 
 // fetchReleases fetches raw GithubReleaseAssets data from the GitHub API for the
-// configured owner and repository.
-func (ghup *GithubUpdateFetcher) fetchReleases() ([]fwcommon.GithubReleaseAssets, error) {
+// configured owner and repository, through fetch or a plain GET if it is nil.
+func (ghup *GithubUpdateFetcher) fetchReleases(fetch fwcommon.GithubReleasesFetchFn) ([]fwcommon.GithubReleaseAssets, error) {
 	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases", ghup.Owner, ghup.Repo)
-	fmt.Println("Fetching releases from:", url)
+	ghup.logger.Debug(fmt.Sprintf("Fetching releases from: %s", url))
 
-	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog) // Disable net's debugging since we handle it
-	report, err := ghup.fetcher.GET(url, false, false, nil)
-	fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog) // Re-enable net's debugging
+	if fetch == nil {
+		fetch = func(url string) (fwcommon.NetworkProgressReportInterface, error) {
+			return ghup.fetcher.GET(url, false, false, nil)
+		}
+	}
+	report, err := fetch(url)
 	if err != nil {
-		return nil, fmt.Errorf("fetcher.GET failed for %s: %w", url, err)
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
 	}
 
 	if report.GetResponse().StatusCode != http.StatusOK {
@@ -345,30 +352,6 @@ func fetchFileContent(fetcher fwcommon.FetcherInterface, url string) (string, er
 }
 */
 
-// fetchBinaryFileContent fetches the content of a file from a given URL as bytes.
-func fetchBinaryFileContent(fetcher fwcommon.FetcherInterface, url string) ([]byte, error) {
-	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog)      // Disable net's debugging since we handle it
-	report, err := fetcher.GET(url, true, false, nil)              // Stream the body
-	defer fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog) // Re-enable net's debugging
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch content from %s: %w", url, err)
-	}
-
-	if report.GetResponse().StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP status %d fetching %s", report.GetResponse().StatusCode, url)
-	}
-
-	// report works as an io.Reader, so we can read the content directly
-	content, err := io.ReadAll(report)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read content from %s: %w", url, err)
-	}
-	defer report.Close()
-
-	return content, nil
-}
-
 // getFileExtension extracts the file extension from a filename.
 func getFileExtension(filename string) string {
 	dotIndex := strings.LastIndex(filename, ".")
@@ -447,15 +430,38 @@ func extractPlatformArch(filename string) string {
 type NetUpReleaseInfo struct {
 	UIND     int                                  `json:"uind"`
 	Semver   string                               `json:"semver"`
+	Channel  string                               `json:"channel,omitempty"` // Set when listed, deploy.json keeps releases under their channel
 	Released string                               `json:"released"`
 	Notes    string                               `json:"notes"`
 	Sources  map[string]fwcommon.UpdateSourceInfo `json:"sources"` // Map for platform-specific URLs
+
+	// Version constraints against the running build's SemVer, see selectRelease
+	MinVersion            *string `json:"min_version,omitempty"`             // The running version has to be at least this to update directly
+	MaxVersion            *string `json:"max_version,omitempty"`             // The running version has to be at most this
+	RequiresSteppingStone bool    `json:"requires_stepping_stone,omitempty"` // Older installs have to update to this release before any newer one
+
+	// Staged rollout, see inRollout
+	Rollout *float64        `json:"rollout,omitempty"` // Percentage (0-100) of installs that get the release, nil for all
+	Cohorts []RolloutCohort `json:"cohorts,omitempty"` // If set only installs matching a cohort get the release
+}
+
+// The parsed Semver of the release
+func (r *NetUpReleaseInfo) ParsedSemver() (fwcommon.SemVer, error) {
+	return fwcommon.ParseSemVer(r.Semver)
 }
 
 // NetUpDeployFile represents the structure of the deploy.json file.
 type NetUpDeployFile struct {
 	Format   int                           `json:"format"`
 	Channels map[string][]NetUpReleaseInfo `json:"channels"`
+
+	// Required when signed, see parseDeployFile
+	Version uint64     `json:"version,omitempty"` // Increased with every published manifest, a lower one than seen before is refused
+	Expires *time.Time `json:"expires,omitempty"` // A signed manifest past this is refused
+
+	// Signing key statements, see applyKeyStatements
+	Keys        []KeyRotation   `json:"keys,omitempty"`
+	RevokedKeys []KeyRevocation `json:"revoked_keys,omitempty"`
 }
 
 // NetUpdater provides methods for checking and applying updates from a remote source.
@@ -463,14 +469,27 @@ type NetUpdater struct {
 	config  *fwcommon.FrameworkConfig
 	fetcher fwcommon.FetcherInterface
 	log     fwcommon.LoggerInterface
+	deb     fwcommon.DebuggerInterface
+
+	channelMu    sync.RWMutex
+	buildChannel string // The Channel the running build was built for, UINDs are only comparable within it
+
+	installIDMu sync.Mutex
+	installID   string // Loaded on first use, see InstallationID
+
+	autoCheckMu sync.Mutex
+	autoCheck   *autoCheck // Set while the StartAutoCheck scheduler runs
 }
 
 // NewNetUpdater creates and initializes a new NetUpdater instance.
-func NewNetUpdater(config *fwcommon.FrameworkConfig, fetcherPtr fwcommon.FetcherInterface, logPtr fwcommon.LoggerInterface) *NetUpdater {
+func NewNetUpdater(config *fwcommon.FrameworkConfig, fetcherPtr fwcommon.FetcherInterface, logPtr fwcommon.LoggerInterface, debPtr fwcommon.DebuggerInterface) *NetUpdater {
 	nu := &NetUpdater{
 		config:  config,
 		fetcher: fetcherPtr,
 		log:     logPtr,
+		deb:     debPtr,
+
+		buildChannel: config.UpdatorAppConfiguration.Channel,
 	}
 
 	if config.UpdatorAppConfiguration.GithubUpMetaRepo != nil && strings.Contains(*config.UpdatorAppConfiguration.GithubUpMetaRepo, "/") {
@@ -481,6 +500,8 @@ func NewNetUpdater(config *fwcommon.FrameworkConfig, fetcherPtr fwcommon.Fetcher
 		}
 	}
 
+	nu.loadChannelChoice()
+
 	return nu
 }
 
@@ -494,30 +515,89 @@ func (nu *NetUpdater) logThroughError(err error) error {
 // GetLatestVersion fetches the deploy file or GitHub releases and determines the latest compatible release
 // for the updater's current channel and platform.
 func (nu *NetUpdater) GetLatestVersion() (*NetUpReleaseInfo, error) {
-	if strings.HasPrefix(nu.config.UpdatorAppConfiguration.Channel, "ugit.") {
-		if nu.config.UpdatorAppConfiguration.GhMetaFetcher == nil {
-			return nil, nu.logThroughError(fmt.Errorf("github update meta repo not configured for 'ugit.' channel"))
+	return nu.checkLatestVersion(nu.fetchContext())
+}
+
+// GetLatestVersion with the fetches aborted once ctx is cancelled
+func (nu *NetUpdater) checkLatestVersion(ctx context.Context) (*NetUpReleaseInfo, error) {
+	remote := ""
+	if nu.config.UpdatorAppConfiguration.DeployURL != nil {
+		remote = *nu.config.UpdatorAppConfiguration.DeployURL
+	}
+	op := nu.startOperation(ctx, "check", remote, nil)
+	op.phase(fwcommon.UpdatePhaseChecking)
+	release, err := nu.getLatestVersion(op)
+	op.setRelease(release)
+	return release, op.finish(err)
+}
+
+func (nu *NetUpdater) getLatestVersion(op *updateOperation) (*NetUpReleaseInfo, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	channel := nu.channel()
+	releases, err := nu.fetchReleases(op, channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, nu.logThroughError(fmt.Errorf("no releases found for channel '%s'", channel))
+	}
+
+	var compatible []*NetUpReleaseInfo
+	for _, release := range releases {
+		// Ensure the release has source info for the current platform
+		if _, ok := release.Sources[conf.Target]; ok {
+			compatible = append(compatible, release)
+		} else {
+			nu.log.Debug(fmt.Sprintf("Skipping release %s (UIND %d) - no build found for %s", release.Semver, release.UIND, conf.Target))
 		}
-		return nu.getLatestVersionFromGitHub(true)
-	} else if strings.HasPrefix(nu.config.UpdatorAppConfiguration.Channel, "git.") {
+	}
+	if len(compatible) == 0 {
+		return nil, nu.logThroughError(fmt.Errorf("no compatible releases found for channel '%s' on %s", channel, conf.Target))
+	}
+
+	return nu.selectRelease(compatible)
+}
+
+// fetchReleases returns every release of the channel from the source its prefix selects,
+// GitHub UpMeta for "ugit.", GitHub release assets for "git." and deploy.json otherwise.
+func (nu *NetUpdater) fetchReleases(op *updateOperation, channel string) ([]*NetUpReleaseInfo, error) {
+	if upMeta := strings.HasPrefix(channel, "ugit."); upMeta || strings.HasPrefix(channel, "git.") {
 		if nu.config.UpdatorAppConfiguration.GhMetaFetcher == nil {
-			return nil, nu.logThroughError(fmt.Errorf("github update meta repo not configured for 'git.' channel"))
+			return nil, nu.logThroughError(fmt.Errorf("github update meta repo not configured for '%s' channel", channel[:strings.Index(channel, ".")+1]))
 		}
-		return nu.getLatestVersionFromGitHub(false)
-	} else {
-		return nu.getLatestVersionFromJsonDeploy()
+		ghReleases, err := nu.fetchGitHubReleases(op, upMeta)
+		if err != nil {
+			return nil, err
+		}
+		var releases []*NetUpReleaseInfo
+		for _, release := range ghReleases {
+			if release.Channel == channel {
+				releases = append(releases, release)
+			}
+		}
+		return releases, nil
+	}
+
+	deployFile, err := nu.fetchDeployFile(op)
+	if err != nil {
+		return nil, err
+	}
+	var releases []*NetUpReleaseInfo
+	for i := range deployFile.Channels[channel] {
+		release := &deployFile.Channels[channel][i]
+		release.Channel = channel
+		releases = append(releases, release)
 	}
+	return releases, nil
 }
 
-// getLatestVersionFromJsonDeploy fetches update metadata from a deploy.json file.
-func (nu *NetUpdater) getLatestVersionFromJsonDeploy() (*NetUpReleaseInfo, error) {
+// fetchDeployFile fetches, verifies and parses the deploy.json file.
+func (nu *NetUpdater) fetchDeployFile(op *updateOperation) (*NetUpDeployFile, error) {
 	if nu.config.UpdatorAppConfiguration.DeployURL == nil || *nu.config.UpdatorAppConfiguration.DeployURL == "" {
 		return nil, nu.logThroughError(fmt.Errorf("deploy.json URL is not configured"))
 	}
-	fmt.Println("Fetching deploy.json from:", *nu.config.UpdatorAppConfiguration.DeployURL)
-	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog) // Disable net's debugging since we handle it
-	report, err := nu.fetcher.GET(*nu.config.UpdatorAppConfiguration.DeployURL, false, false, nil)
-	fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog) // Re-enable net's debugging
+	nu.log.Debug(fmt.Sprintf("Fetching deploy.json from: %s", *nu.config.UpdatorAppConfiguration.DeployURL))
+	report, err := op.fetch(*nu.config.UpdatorAppConfiguration.DeployURL, false, false, nil)
 	if err != nil {
 		return nil, nu.logThroughError(fmt.Errorf("failed to fetch deploy.json from %s: %w", *nu.config.UpdatorAppConfiguration.DeployURL, err))
 	}
@@ -530,113 +610,116 @@ func (nu *NetUpdater) getLatestVersionFromJsonDeploy() (*NetUpReleaseInfo, error
 		return nil, nu.logThroughError(fmt.Errorf("received empty content for deploy.json"))
 	}
 
-	var deployFile NetUpDeployFile
-	err = json.Unmarshal([]byte(*report.GetNonStreamContent()), &deployFile)
-	if err != nil {
-		return nil, nu.logThroughError(fmt.Errorf("failed to unmarshal deploy.json: %w", err))
-	}
-
-	releases, ok := deployFile.Channels[nu.config.UpdatorAppConfiguration.Channel]
-	if !ok || len(releases) == 0 {
-		return nil, nu.logThroughError(fmt.Errorf("no releases found for channel '%s'", nu.config.UpdatorAppConfiguration.Channel))
-	}
-
-	var latest *NetUpReleaseInfo
-	for i := range releases {
-		release := &releases[i]
-		// Ensure the release has source info for the current platform
-		if _, ok := release.Sources[nu.config.UpdatorAppConfiguration.Target]; ok {
-			if latest == nil || release.UIND > latest.UIND {
-				latest = release
-			}
-		} else {
-			fmt.Printf("Skipping release %s (UIND %d) - no build found for %s\n", release.Semver, release.UIND, nu.config.UpdatorAppConfiguration.Target)
-		}
-	}
-	if latest == nil {
-		return nil, nu.logThroughError(fmt.Errorf("no compatible releases found for channel '%s' on %s", nu.config.UpdatorAppConfiguration.Channel, nu.config.UpdatorAppConfiguration.Target))
-	}
-
-	return latest, nil
+	return nu.parseDeployFile(op, *nu.config.UpdatorAppConfiguration.DeployURL, []byte(*report.GetNonStreamContent()))
 }
 
-// getLatestVersionFromGitHub fetches update metadata from GitHub releases.
-func (nu *NetUpdater) getLatestVersionFromGitHub(upMeta bool) (*NetUpReleaseInfo, error) {
+// fetchGitHubReleases fetches the GitHub releases that carry update metadata, from their UpMeta or from their tags and assets.
+// The GitHub API is fetched as a child of the operation.
+func (nu *NetUpdater) fetchGitHubReleases(op *updateOperation, upMeta bool) ([]*NetUpReleaseInfo, error) {
 	var ghReleases []fwcommon.UpdateReleaseData
 	var err error
 
+	fetch := func(url string) (fwcommon.NetworkProgressReportInterface, error) {
+		return op.fetch(url, false, false, nil)
+	}
 	if upMeta {
-		ghReleases, err = nu.config.UpdatorAppConfiguration.GhMetaFetcher.FetchUpMetaReleases()
+		ghReleases, err = nu.config.UpdatorAppConfiguration.GhMetaFetcher.FetchUpMetaReleases(fetch)
 	} else {
-		ghReleases, err = nu.config.UpdatorAppConfiguration.GhMetaFetcher.FetchAssetReleases()
+		ghReleases, err = nu.config.UpdatorAppConfiguration.GhMetaFetcher.FetchAssetReleases(fetch)
 	}
 
 	if err != nil {
 		return nil, nu.logThroughError(fmt.Errorf("failed to fetch GitHub releases: %w", err))
 	}
 
-	var latestReleaseInfo *NetUpReleaseInfo
+	var releases []*NetUpReleaseInfo
 
 	for _, rel := range ghReleases {
 		if rel.UpMeta == nil {
 			continue // No upmeta found for this release, skip
 		}
 
-		// Filter by channel
-		if rel.UpMeta.Channel != nu.config.UpdatorAppConfiguration.Channel {
-			continue
+		// Convert SourceInfo from UpMeta to NetUpReleaseInfo's Sources format
+		sources := make(map[string]fwcommon.UpdateSourceInfo)
+		for platform, source := range rel.UpMeta.Sources {
+			// No conversion needed, as SourceInfo is now the common struct
+			sources[platform] = source
 		}
 
-		// Check if source exists for current platform
-		if _, ok := rel.UpMeta.Sources[nu.config.UpdatorAppConfiguration.Target]; !ok {
-			fmt.Printf("Skipping GitHub release %s (UIND %d) - no build found for %s\n", rel.UpMeta.Semver, rel.UpMeta.Uind, nu.config.UpdatorAppConfiguration.Target)
-			continue
-		}
-
-		// Convert SourceInfo from UpMeta to NetUpReleaseInfo's Sources format if it's the latest
-		if latestReleaseInfo == nil || rel.UpMeta.Uind > latestReleaseInfo.UIND {
-			sources := make(map[string]fwcommon.UpdateSourceInfo)
-			for platform, source := range rel.UpMeta.Sources {
-				// No conversion needed, as SourceInfo is now the common struct
-				sources[platform] = source
-			}
-
-			latestReleaseInfo = &NetUpReleaseInfo{
-				UIND:     rel.UpMeta.Uind,
-				Semver:   rel.UpMeta.Semver,
-				Released: rel.Released,
-				Notes:    rel.Notes,
-				Sources:  sources,
-			}
-		}
+		releases = append(releases, &NetUpReleaseInfo{
+			UIND:                  rel.UpMeta.Uind,
+			Semver:                rel.UpMeta.Semver,
+			Channel:               rel.UpMeta.Channel,
+			Released:              rel.Released,
+			Notes:                 rel.Notes,
+			Sources:               sources,
+			MinVersion:            rel.UpMeta.MinVersion,
+			MaxVersion:            rel.UpMeta.MaxVersion,
+			RequiresSteppingStone: rel.UpMeta.RequiresSteppingStone,
+		})
 	}
 
-	if latestReleaseInfo == nil {
-		return nil, nu.logThroughError(fmt.Errorf("no compatible GitHub releases found for channel '%s' on %s", nu.config.UpdatorAppConfiguration.Channel, nu.config.UpdatorAppConfiguration.Target))
-	}
+	return releases, nil
+}
 
-	return latestReleaseInfo, nil
+// A release resolved for this platform: where to download it from and how go-update should verify and apply it
+type preparedUpdate struct {
+	release     *NetUpReleaseInfo
+	keyID       string // The key the signature was made with, empty for any trusted key
+	opts        update.Options
+	downloadURL string
+	paths       *updatePaths
+	previous    *PendingUpdate // The update being replaced if it was never confirmed
 }
 
-// PerformUpdate downloads and applies the specified release. It attempts a patch update
-// if applicable, otherwise a full binary update.
-func (nu *NetUpdater) PerformUpdate(latestRelease *NetUpReleaseInfo) error {
+// newUpdateOptions sets up go-update to verify against the trusted keys (the one named keyID if set) and to replace the executable,
+// keeping the previous binary so CheckPendingUpdate can roll back to it.
+func (nu *NetUpdater) newUpdateOptions(keyID string) (update.Options, *updatePaths, *PendingUpdate, error) {
 	opts := update.Options{}
 
-	// Set public key for signature verification
-	err := opts.SetPublicKeyPEM(nu.config.UpdatorAppConfiguration.PublicKeyPEM)
+	// Set the trusted keys for signature verification
+	if err := nu.setUpdateVerifier(&opts, keyID); err != nil {
+		return opts, nil, nil, nu.logThroughError(err)
+	}
+
+	opts.Hash = crypto.SHA256 // Default, but good to explicitly set
+
+	paths, err := nu.updatePaths()
+	if err != nil {
+		return opts, nil, nil, nu.logThroughError(err)
+	}
+	if err := os.MkdirAll(paths.dir, 0755); err != nil {
+		return opts, nil, nil, nu.logThroughError(fmt.Errorf("failed to create update state dir: %w", err))
+	}
+	// Updating an unconfirmed update keeps the backup of the last confirmed build
+	previousPending, err := nu.GetPendingUpdate()
 	if err != nil {
-		return nu.logThroughError(fmt.Errorf("failed to set public key: %w", err))
+		nu.log.Warn(fmt.Sprintf("Ignoring unreadable pending update: %v", err))
+		previousPending = nil
 	}
+	opts.TargetPath = paths.executable
+	if previousPending == nil {
+		opts.OldSavePath = paths.backup
+	}
+	return opts, paths, previousPending, nil
+}
 
+// prepareUpdate picks the patch or full binary of the release for this platform along with its checksum and signature.
+func (nu *NetUpdater) prepareUpdate(op *updateOperation, latestRelease *NetUpReleaseInfo) (*preparedUpdate, error) {
 	// Get platform-specific source URLs
 	latestPlatformSource, ok := latestRelease.Sources[nu.config.UpdatorAppConfiguration.Target] // Changed variable name
 	if !ok {
-		return nu.logThroughError(fmt.Errorf("no update source found for current platform: %s", nu.config.UpdatorAppConfiguration.Target))
+		return nil, nu.logThroughError(fmt.Errorf("no update source found for current platform: %s", nu.config.UpdatorAppConfiguration.Target))
 	}
 
-	opts.Hash = crypto.SHA256                 // Default, but good to explicitly set
-	opts.Verifier = update.NewECDSAVerifier() // Default, but good to explicitly set
+	keyID := ""
+	if latestPlatformSource.KeyID != nil {
+		keyID = *latestPlatformSource.KeyID
+	}
+	opts, paths, previousPending, err := nu.newUpdateOptions(keyID)
+	if err != nil {
+		return nil, err
+	}
 
 	var downloadURL string
 	var expectedChecksum []byte
@@ -654,36 +737,36 @@ func (nu *NetUpdater) PerformUpdate(latestRelease *NetUpReleaseInfo) error {
 	if shouldAttemptPatch {
 		// Is the patch for us?
 		if *latestPlatformSource.PatchFor == nu.config.UpdatorAppConfiguration.UIND {
-			fmt.Printf("Attempting to download and apply patch from: %s\n", *latestPlatformSource.PatchURL)
+			nu.log.Info(fmt.Sprintf("Attempting to download and apply patch from: %s", *latestPlatformSource.PatchURL))
 			downloadURL = *latestPlatformSource.PatchURL
 			opts.Patcher = update.NewBSDiffPatcher()
 
 			// Set checksum and signature for the patch file
 			expectedChecksum, err = hex.DecodeString(*latestPlatformSource.PatchChecksum)
 			if err != nil {
-				return nu.logThroughError(fmt.Errorf("failed to decode patch checksum: %w", err))
+				return nil, nu.logThroughError(fmt.Errorf("failed to decode patch checksum: %w", err))
 			}
 			// If latestPlatformSource.PatchSignature is not nil, we need to do a base64 decode on .PatchSignature
 			if latestPlatformSource.PatchSignature != nil && *latestPlatformSource.PatchSignature != "" {
 				expectedSignature, err = base64.StdEncoding.DecodeString(*latestPlatformSource.PatchSignature) // Dereference here
 				if err != nil {
-					return nu.logThroughError(fmt.Errorf("failed to decode full binary signature: %w", err))
+					return nil, nu.logThroughError(fmt.Errorf("failed to decode full binary signature: %w", err))
 				}
 			} else if latestPlatformSource.PatchSignatureURL != nil {
 				// Attempt binary fetch of PatchSignatureURL
-				patchSigContent, err := fetchBinaryFileContent(nu.fetcher, *latestPlatformSource.PatchSignatureURL)
+				patchSigContent, err := op.fetchBytes(*latestPlatformSource.PatchSignatureURL)
 				if err != nil {
-					return nu.logThroughError(fmt.Errorf("failed to fetch patch signature for %s: %v", nu.config.UpdatorAppConfiguration.Target, err))
+					return nil, nu.logThroughError(fmt.Errorf("failed to fetch patch signature for %s: %v", nu.config.UpdatorAppConfiguration.Target, err))
 				}
 				expectedSignature = patchSigContent
 			} else {
-				return nu.logThroughError(fmt.Errorf("patch signature is missing for %s", nu.config.UpdatorAppConfiguration.Target))
+				return nil, nu.logThroughError(fmt.Errorf("patch signature is missing for %s", nu.config.UpdatorAppConfiguration.Target))
 			}
 			// Mark that we are attempting a patch update
 			isPatchAttempt = true
 		} else {
 			// Warn the user that the patch is not for the current UIND and fallback to a full update
-			fmt.Printf("Warning: Patch is for UIND %d, but current UIND is %d. Falling back to full update.\n", *latestPlatformSource.PatchFor, nu.config.UpdatorAppConfiguration.UIND)
+			nu.log.Warn(fmt.Sprintf("Patch is for UIND %d, but current UIND is %d. Falling back to full update.", *latestPlatformSource.PatchFor, nu.config.UpdatorAppConfiguration.UIND))
 			shouldAttemptPatch = false // Force fallback
 		}
 	}
@@ -692,38 +775,38 @@ func (nu *NetUpdater) PerformUpdate(latestRelease *NetUpReleaseInfo) error {
 		// If isPatchAttempt is false, it means we will proceed with a full update.
 		if latestPlatformSource.IsPatch {
 			if latestPlatformSource.PatchURL == nil || *latestPlatformSource.PatchURL == "" {
-				fmt.Println("Warning: Release is marked as patch but no patch_url for current platform. Falling back to full update.")
+				nu.log.Warn("Release is marked as patch but no patch_url for current platform. Falling back to full update.")
 			} else if latestPlatformSource.PatchFor == nil || *latestPlatformSource.PatchFor != nu.config.UpdatorAppConfiguration.UIND {
 				// It implies shouldAttemptPatch was false because PatchFor didn't match.
 			} else { // Missing patch checksum or signature
-				fmt.Println("Warning: Patch is available but missing checksum/signature. Falling back to full update.")
+				nu.log.Warn("Patch is available but missing checksum/signature. Falling back to full update.")
 			}
 		}
 
-		fmt.Printf("Downloading full binary from: %s\n", latestPlatformSource.URL)
+		nu.log.Info(fmt.Sprintf("Downloading full binary from: %s", latestPlatformSource.URL))
 		downloadURL = latestPlatformSource.URL
 		opts.Patcher = nil // No patcher needed for full binary update
 
 		// Set checksum and signature for the full binary
 		expectedChecksum, err = hex.DecodeString(latestPlatformSource.Checksum)
 		if err != nil {
-			return nu.logThroughError(fmt.Errorf("failed to decode full binary checksum: %w", err))
+			return nil, nu.logThroughError(fmt.Errorf("failed to decode full binary checksum: %w", err))
 		}
 
 		// If latestPlatformSource.Signature is not nil, we need to do a base64 decode on .Signature
 		if latestPlatformSource.Signature != nil && *latestPlatformSource.Signature != "" {
 			expectedSignature, err = base64.StdEncoding.DecodeString(*latestPlatformSource.Signature) // Dereference here
 			if err != nil {
-				return nu.logThroughError(fmt.Errorf("failed to decode full binary signature: %w", err))
+				return nil, nu.logThroughError(fmt.Errorf("failed to decode full binary signature: %w", err))
 			}
 		} else if latestPlatformSource.SignatureURL != nil {
-			sigContent, err := fetchBinaryFileContent(nu.fetcher, *latestPlatformSource.SignatureURL)
+			sigContent, err := op.fetchBytes(*latestPlatformSource.SignatureURL)
 			if err != nil {
-				return nu.logThroughError(fmt.Errorf("failed to fetch signature for %s: %v", nu.config.UpdatorAppConfiguration.Target, err))
+				return nil, nu.logThroughError(fmt.Errorf("failed to fetch signature for %s: %v", nu.config.UpdatorAppConfiguration.Target, err))
 			}
 			expectedSignature = sigContent
 		} else {
-			return nu.logThroughError(fmt.Errorf("full binary signature is missing for %s", nu.config.UpdatorAppConfiguration.Target))
+			return nil, nu.logThroughError(fmt.Errorf("full binary signature is missing for %s", nu.config.UpdatorAppConfiguration.Target))
 		}
 	}
 
@@ -731,29 +814,110 @@ func (nu *NetUpdater) PerformUpdate(latestRelease *NetUpReleaseInfo) error {
 	opts.Checksum = expectedChecksum
 	opts.Signature = expectedSignature
 
-	fwcommon.FrameworkFlags.Disable(fwcommon.Net_InternalErrorLog)      // Disable net's debugging since we handle it
-	report, err := nu.fetcher.GET(downloadURL, true, false, nil)   // Stream the body
-	defer fwcommon.FrameworkFlags.Enable(fwcommon.Net_InternalErrorLog) // Re-enable net's debugging
+	return &preparedUpdate{
+		release:     latestRelease,
+		keyID:       keyID,
+		opts:        opts,
+		downloadURL: downloadURL,
+		paths:       paths,
+		previous:    previousPending,
+	}, nil
+}
 
-	if err != nil {
-		return nu.logThroughError(fmt.Errorf("failed to download update from %s: %w", downloadURL, err))
+// patchAndVerify checks the downloaded content the way update.Apply would and returns the resulting binary,
+// a patch is applied to the current executable in memory first.
+func (nu *NetUpdater) patchAndVerify(op *updateOperation, opts *update.Options, content []byte) ([]byte, error) {
+	updated := content
+	if opts.Patcher != nil {
+		op.phase(fwcommon.UpdatePhasePatching)
+		old, err := os.Open(opts.TargetPath)
+		if err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("%w: can not read the executable to patch: %v", ErrUpdateVerification, err))
+		}
+		defer old.Close()
+		var patched bytes.Buffer
+		if err := opts.Patcher.Patch(old, &patched, bytes.NewReader(content)); err != nil {
+			return nil, nu.logThroughError(fmt.Errorf("%w: failed to apply patch: %v", ErrUpdateVerification, err))
+		}
+		updated = patched.Bytes()
 	}
 
-	if report.GetResponse().StatusCode != http.StatusOK {
-		report.Close()
-		return nu.logThroughError(fmt.Errorf("failed to download update from %s, status code: %d", downloadURL, report.GetResponse().StatusCode))
+	op.phase(fwcommon.UpdatePhaseVerifying)
+	hash := opts.Hash.New()
+	hash.Write(updated)
+	checksum := hash.Sum(nil)
+	if !bytes.Equal(checksum, opts.Checksum) {
+		return nil, nu.logThroughError(fmt.Errorf("%w: checksum mismatch, expected %x, got %x", ErrUpdateVerification, opts.Checksum, checksum))
+	}
+	if v, ok := opts.Verifier.(*keyringVerifier); ok {
+		opts.Verifier = v.forContent(updated) // Also used by update.Apply in applyUpdate
 	}
+	if err := opts.Verifier.VerifySignature(checksum, opts.Signature, opts.Hash, opts.PublicKey); err != nil {
+		return nil, nu.logThroughError(fmt.Errorf("%w: %v", ErrUpdateVerification, err))
+	}
+	return updated, nil
+}
 
-	err = update.Apply(report, opts) // Pass the NetProgressReport as io.Reader
-	report.Close()
+// applyUpdate replaces the executable with the binary returned by patchAndVerify and records it as pending.
+func (nu *NetUpdater) applyUpdate(op *updateOperation, prepared *preparedUpdate, updated []byte) error {
+	op.phase(fwcommon.UpdatePhaseApplying)
+	opts := prepared.opts
+	opts.Patcher = nil // Already patched, go-update still verifies the checksum and signature
+	err := update.Apply(bytes.NewReader(updated), opts)
 	if err != nil {
 		return nu.logThroughError(fmt.Errorf("failed to apply update: %w", err))
 	}
 
-	fmt.Println("Update applied successfully!")
+	// The new build has to call ConfirmUpdate, else CheckPendingUpdate restores the previous binary
+	pending := &PendingUpdate{
+		FromUIND:   nu.config.UpdatorAppConfiguration.UIND,
+		FromSemver: nu.config.UpdatorAppConfiguration.SemVer,
+		ToUIND:     prepared.release.UIND,
+		ToSemver:   prepared.release.Semver,
+		Executable: prepared.paths.executable,
+		Backup:     prepared.paths.backup,
+		Applied:    time.Now(),
+	}
+	if prepared.previous != nil {
+		pending.FromUIND = prepared.previous.FromUIND
+		pending.FromSemver = prepared.previous.FromSemver
+	}
+	if err := writeUpdateState(prepared.paths.pending, pending); err != nil {
+		return nu.logThroughError(fmt.Errorf("update applied but the pending update marker could not be written, it will not be rolled back: %w", err))
+	}
+
+	nu.log.Info(fmt.Sprintf("Update %s (UIND %d) applied", prepared.release.Semver, prepared.release.UIND))
 	return nil
 }
 
+// PerformUpdate downloads and applies the specified release. It attempts a patch update
+// if applicable, otherwise a full binary update.
+// Every phase is reported to UpdatorAppConfiguration.Progressor and the debugger.
+func (nu *NetUpdater) PerformUpdate(latestRelease *NetUpReleaseInfo) error {
+	return nu.performUpdate(nu.fetchContext(), latestRelease)
+}
+
+// PerformUpdate with the download aborted once ctx is cancelled
+func (nu *NetUpdater) performUpdate(ctx context.Context, latestRelease *NetUpReleaseInfo) error {
+	op := nu.startOperation(ctx, "update", "", latestRelease)
+	prepared, err := nu.prepareUpdate(op, latestRelease)
+	if err != nil {
+		return op.finish(err)
+	}
+	op.event.Remote = prepared.downloadURL
+
+	op.phase(fwcommon.UpdatePhaseDownloading)
+	content, err := op.fetchBytes(prepared.downloadURL)
+	if err != nil {
+		return op.finish(nu.logThroughError(fmt.Errorf("failed to download update from %s: %w", prepared.downloadURL, err)))
+	}
+	updated, err := nu.patchAndVerify(op, &prepared.opts, content)
+	if err != nil {
+		return op.finish(err)
+	}
+	return op.finish(nu.applyUpdate(op, prepared, updated))
+}
+
 // General helpers
 func (nu *NetUpdater) GetUpdateConfig() *fwcommon.UpdatorAppConfiguration {
 	return nu.config.UpdatorAppConfiguration
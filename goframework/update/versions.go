@@ -0,0 +1,146 @@
+package goframework_update
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+
+	fwcommon "github.com/sbamboo/goframework/common"
+)
+
+// Returned (wrapped) by GetLatestVersion when only releases older than the running build are left and AllowDowngrade is off
+var ErrUpdateDowngrade = errors.New("release is older than the running build")
+
+// Returned (wrapped) by GetLatestVersion when no release has version constraints the running build satisfies
+var ErrUpdateConstraints = errors.New("no release allows updating from the running version")
+
+// Checks a min_version/max_version constraint of release against the running version, cmp is -1 for min and 1 for max
+func checkVersionConstraint(release *NetUpReleaseInfo, constraint *string, current *fwcommon.SemVer, cmp int) error {
+	if constraint == nil || *constraint == "" {
+		return nil
+	}
+	bound, err := fwcommon.ParseSemVer(*constraint)
+	if err != nil {
+		return fmt.Errorf("release %s (UIND %d) has an invalid version constraint: %w", release.Semver, release.UIND, err)
+	}
+	if current == nil {
+		return fmt.Errorf("release %s (UIND %d) has a version constraint but the running SemVer is not valid", release.Semver, release.UIND)
+	}
+	if current.Compare(bound) == cmp {
+		if cmp < 0 {
+			return fmt.Errorf("release %s (UIND %d) requires at least %s", release.Semver, release.UIND, bound)
+		}
+		return fmt.Errorf("release %s (UIND %d) allows at most %s", release.Semver, release.UIND, bound)
+	}
+	return nil
+}
+
+// compareToRunning orders the release against the running build: by UIND on the build's own channel,
+// by SemVer on another channel. ok is false if the SemVers of a release on another channel can not be compared.
+func (nu *NetUpdater) compareToRunning(release *NetUpReleaseInfo) (int, bool) {
+	conf := nu.config.UpdatorAppConfiguration
+	if nu.onBuildChannel() {
+		return cmp.Compare(release.UIND, conf.UIND), true
+	}
+	current, err := conf.ParsedSemVer()
+	if err != nil {
+		return 0, false
+	}
+	v, err := release.ParsedSemver()
+	if err != nil {
+		return 0, false
+	}
+	return v.Compare(current), true
+}
+
+// IsNewer reports whether the release is newer than the running build, see compareToRunning.
+// Use it instead of comparing UINDs, they mean nothing across channels.
+func (nu *NetUpdater) IsNewer(release *NetUpReleaseInfo) bool {
+	c, ok := nu.compareToRunning(release)
+	return ok && c > 0
+}
+
+// selectRelease picks the release to update to from the compatible releases of the channel:
+//   - releases older than the running build (by UIND or SemVer) are dropped unless AllowDowngrade is set,
+//     after SwitchChannel the UINDs of the channel are not comparable so only the SemVer counts
+//   - a newer release marked requires_stepping_stone has to be installed before any release after it
+//   - min_version and max_version have to include the running version, else an older release is taken as a hop
+//   - a staged rollout (rollout, cohorts) has to include this installation, a held back stepping stone still caps
+//
+// Of what is left the highest UIND wins, which may be the running build itself.
+func (nu *NetUpdater) selectRelease(releases []*NetUpReleaseInfo) (*NetUpReleaseInfo, error) {
+	conf := nu.config.UpdatorAppConfiguration
+	var current *fwcommon.SemVer
+	if v, err := conf.ParsedSemVer(); err == nil {
+		current = &v
+	} else {
+		nu.log.Debug(fmt.Sprintf("Running SemVer %q is not valid, versions are compared by UIND only", conf.SemVer))
+	}
+
+	releases = slices.Clone(releases)
+	slices.SortFunc(releases, func(a, b *NetUpReleaseInfo) int { return a.UIND - b.UIND })
+
+	channel := nu.channel()
+
+	// The first stepping stone after the running build caps how far we may go
+	limit := -1
+	for _, release := range releases {
+		if release.RequiresSteppingStone && nu.IsNewer(release) {
+			limit = release.UIND
+			break
+		}
+	}
+
+	var selected *NetUpReleaseInfo
+	downgrades, constrained, heldBack := 0, 0, 0
+	for _, release := range releases {
+		if limit >= 0 && release.UIND > limit {
+			nu.log.Debug(fmt.Sprintf("Skipping release %s (UIND %d) - the stepping stone UIND %d has to be installed first", release.Semver, release.UIND, limit))
+			continue
+		}
+		c, comparable := nu.compareToRunning(release)
+		if !conf.AllowDowngrade {
+			downgrade := !comparable || c < 0
+			if v, err := release.ParsedSemver(); err == nil && current != nil && v.Compare(*current) < 0 {
+				downgrade = true
+			}
+			if downgrade {
+				downgrades++
+				continue
+			}
+		}
+		if !comparable || c != 0 {
+			err := checkVersionConstraint(release, release.MinVersion, current, -1)
+			if err == nil {
+				err = checkVersionConstraint(release, release.MaxVersion, current, 1)
+			}
+			if err != nil {
+				nu.log.Debug(fmt.Sprintf("Skipping %v", err))
+				constrained++
+				continue
+			}
+			rolledOut, err := nu.inRollout(release, current)
+			if err != nil {
+				return nil, err
+			}
+			if !rolledOut {
+				nu.log.Debug(fmt.Sprintf("Skipping release %s (UIND %d) - not rolled out to this installation yet", release.Semver, release.UIND))
+				heldBack++
+				continue
+			}
+		}
+		selected = release
+	}
+
+	if selected == nil {
+		if constrained > 0 {
+			return nil, nu.logThroughError(fmt.Errorf("%w %s (UIND %d) on channel '%s'", ErrUpdateConstraints, conf.SemVer, conf.UIND, channel))
+		}
+		if heldBack > 0 {
+			return nil, nu.logThroughError(fmt.Errorf("%w: %d release(s) on channel '%s'", ErrUpdateRollout, heldBack, channel))
+		}
+		return nil, nu.logThroughError(fmt.Errorf("%w: %d release(s) on channel '%s' are older than %s (UIND %d)", ErrUpdateDowngrade, downgrades, channel, conf.SemVer, conf.UIND))
+	}
+	return selected, nil
+}
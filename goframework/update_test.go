@@ -0,0 +1,1289 @@
+package libgoframework
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fwnet "github.com/sbamboo/goframework/net"
+	fwupdate "github.com/sbamboo/goframework/update"
+)
+
+// A release of content signed the way go-update verifies it (ECDSA over the sha256)
+func signedTestRelease(t *testing.T, key *ecdsa.PrivateKey, uind int, content []byte, url string) *NetUpReleaseInfo {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &NetUpReleaseInfo{
+		UIND:   uind,
+		Semver: fmt.Sprintf("1.0.%d", uind),
+		Sources: map[string]UpdateSourceInfo{
+			"test-target": {URL: url, Checksum: hex.EncodeToString(sum[:]), Signature: Ptr(base64.StdEncoding.EncodeToString(sig))},
+		},
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	oldBinary, newBinary := []byte("old build"), []byte("new build")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(newBinary)
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	release := signedTestRelease(t, key, 2, newBinary, server.URL)
+
+	// A framework running as the given build of the binary at exe
+	build := func(uind int) *Framework {
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           uind,
+				SemVer:         fmt.Sprintf("1.0.%d", uind),
+				Channel:        "test",
+				Target:         "test-target",
+				PublicKeyPEM:   pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+				ExecutablePath: Ptr(exe),
+				HealthLaunches: 2,
+			},
+		})
+	}
+	apply := func() {
+		t.Helper()
+		if err := os.WriteFile(exe, oldBinary, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := build(1).Update.PerformUpdate(release); err != nil {
+			t.Fatalf("update failed: %v", err)
+		}
+		if content, _ := os.ReadFile(exe); string(content) != string(newBinary) {
+			t.Fatalf("expected the new binary in place, got %q", content)
+		}
+	}
+	binary := func() string {
+		content, _ := os.ReadFile(exe)
+		return string(content)
+	}
+
+	// --- Not confirmed within the allowed launches ---
+	apply()
+	pending, err := build(2).Update.GetPendingUpdate()
+	if err != nil || pending == nil || pending.FromUIND != 1 || pending.ToUIND != 2 {
+		t.Fatalf("expected a pending update from 1 to 2, got %+v (%v)", pending, err)
+	}
+	for launch := 1; launch <= 2; launch++ {
+		if rb, err := build(2).Update.CheckPendingUpdate(); rb != nil || err != nil {
+			t.Fatalf("launch %d: expected no rollback yet, got %+v (%v)", launch, rb, err)
+		}
+	}
+	rb, err := build(2).Update.CheckPendingUpdate()
+	if err != nil || rb == nil || !rb.RestartRequired || rb.ToUIND != 2 {
+		t.Fatalf("expected the third launch to roll back, got %+v (%v)", rb, err)
+	}
+	if binary() != string(oldBinary) {
+		t.Errorf("expected the previous binary to be restored, got %q", binary())
+	}
+
+	// The restored build reports the failure once
+	rb, err = build(1).Update.CheckPendingUpdate()
+	if err != nil || rb == nil || rb.RestartRequired || rb.Reason == "" {
+		t.Errorf("expected the restored build to get the rollback report, got %+v (%v)", rb, err)
+	}
+	if rb, _ := build(1).Update.CheckPendingUpdate(); rb != nil {
+		t.Errorf("expected the rollback to be reported only once, got %+v", rb)
+	}
+
+	// --- Confirmed ---
+	apply()
+	if rb, err := build(2).Update.CheckPendingUpdate(); rb != nil || err != nil {
+		t.Fatalf("expected no rollback on the first launch, got %+v (%v)", rb, err)
+	}
+	if err := build(2).Update.ConfirmUpdate(); err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	for launch := 0; launch < 4; launch++ {
+		if rb, err := build(2).Update.CheckPendingUpdate(); rb != nil || err != nil {
+			t.Fatalf("expected a confirmed update to stay, got %+v (%v)", rb, err)
+		}
+	}
+	if binary() != string(newBinary) {
+		t.Errorf("expected the confirmed binary to stay, got %q", binary())
+	}
+
+	// --- Rolled back by the app ---
+	apply()
+	if _, err := build(2).Update.RollbackUpdate("crashed on startup"); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	if binary() != string(oldBinary) {
+		t.Errorf("expected the previous binary after a manual rollback, got %q", binary())
+	}
+}
+
+func TestUpdateAutoCheck(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	oldBinary, newBinary := []byte("old build"), []byte("new build")
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	var checks atomic.Int32
+	var deploy []byte
+	var hang atomic.Bool
+	downloading := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deploy.json":
+			checks.Add(1)
+			w.Write(deploy)
+		case "/app":
+			if hang.Load() {
+				w.Header().Set("Content-Length", strconv.Itoa(len(newBinary)))
+				w.Write(newBinary[:1])
+				w.(http.Flusher).Flush()
+				downloading <- struct{}{}
+				select {
+				case <-r.Context().Done():
+				case <-time.After(10 * time.Second):
+				}
+				return
+			}
+			w.Write(newBinary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	release := signedTestRelease(t, key, 2, newBinary, server.URL+"/app")
+	deploy, _ = json.Marshal(map[string]any{"format": 1, "channels": map[string][]*NetUpReleaseInfo{"test": {release}}})
+
+	newFramework := func() *Framework {
+		if err := os.WriteFile(exe, oldBinary, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.RemoveAll(filepath.Join(dir, ".app.update"))
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           1,
+				Channel:        "test",
+				Target:         "test-target",
+				DeployURL:      Ptr(server.URL + "/deploy.json"),
+				PublicKeyPEM:   pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+				ExecutablePath: Ptr(exe),
+			},
+		})
+	}
+	binary := func() string {
+		content, _ := os.ReadFile(exe)
+		return string(content)
+	}
+	waitFor := func(what string, ch <-chan *NetUpReleaseInfo) {
+		t.Helper()
+		select {
+		case rel := <-ch:
+			if rel.UIND != 2 {
+				t.Errorf("%s: expected UIND 2, got %d", what, rel.UIND)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s was not called", what)
+		}
+	}
+
+	// --- Notify only, once per release ---
+	fw := newFramework()
+	available := make(chan *NetUpReleaseInfo, 16)
+	err := fw.Update.StartAutoCheck(AutoCheckOptions{
+		Interval:     5 * time.Millisecond,
+		Jitter:       5 * time.Millisecond,
+		CheckOnStart: true,
+		OnAvailable:  func(rel *NetUpReleaseInfo) { available <- rel },
+		OnError:      func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Update.StartAutoCheck(AutoCheckOptions{}); !errors.Is(err, ErrAutoCheckRunning) {
+		t.Errorf("expected ErrAutoCheckRunning, got %v", err)
+	}
+	waitFor("OnAvailable", available)
+	for checks.Load() < 3 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(available) != 0 {
+		t.Errorf("expected OnAvailable once, got %d more calls", len(available))
+	}
+	if binary() != string(oldBinary) {
+		t.Errorf("expected notify-only to leave the binary alone, got %q", binary())
+	}
+
+	// --- Downloaded in the background, applied on exit ---
+	fw = newFramework()
+	downloaded, applied := make(chan *NetUpReleaseInfo, 1), make(chan *NetUpReleaseInfo, 1)
+	fw.Update.StartAutoCheck(AutoCheckOptions{
+		Interval:     time.Hour,
+		CheckOnStart: true,
+		Policy:       AutoUpdateApplyOnExit,
+		OnDownloaded: func(rel *NetUpReleaseInfo) { downloaded <- rel },
+		OnApplied:    func(rel *NetUpReleaseInfo) { applied <- rel },
+		OnError:      func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	waitFor("OnDownloaded", downloaded)
+	if binary() != string(oldBinary) {
+		t.Errorf("expected the binary to stay until exit, got %q", binary())
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("apply on exit failed: %v", err)
+	}
+	waitFor("OnApplied", applied)
+	if binary() != string(newBinary) {
+		t.Errorf("expected the update to be applied on exit, got %q", binary())
+	}
+
+	// --- Applied right away ---
+	fw = newFramework()
+	applied = make(chan *NetUpReleaseInfo, 1)
+	fw.Update.StartAutoCheck(AutoCheckOptions{
+		Interval:     time.Hour,
+		CheckOnStart: true,
+		Policy:       AutoUpdateApplyImmediately,
+		OnApplied:    func(rel *NetUpReleaseInfo) { applied <- rel },
+		OnError:      func(err error) { t.Errorf("unexpected error: %v", err) },
+	})
+	waitFor("OnApplied", applied)
+	if binary() != string(newBinary) {
+		t.Errorf("expected the update to be applied immediately, got %q", binary())
+	}
+	fw.Close()
+
+	// --- Stopping aborts a download in progress ---
+	hang.Store(true)
+	for _, policy := range []AutoUpdatePolicy{AutoUpdateApplyOnExit, AutoUpdateApplyImmediately} {
+		fw = newFramework()
+		fw.Update.StartAutoCheck(AutoCheckOptions{
+			Interval:     time.Hour,
+			CheckOnStart: true,
+			Policy:       policy,
+			OnDownloaded: func(*NetUpReleaseInfo) { t.Errorf("policy %d: expected the download to be aborted", policy) },
+			OnApplied:    func(*NetUpReleaseInfo) { t.Errorf("policy %d: expected nothing to be applied", policy) },
+			OnError:      func(err error) { t.Errorf("policy %d: expected no error once stopped, got %v", policy, err) },
+		})
+		select {
+		case <-downloading:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("policy %d: the download did not start", policy)
+		}
+		start := time.Now()
+		if err := fw.Close(); err != nil {
+			t.Errorf("policy %d: %v", policy, err)
+		}
+		if took := time.Since(start); took > 5*time.Second {
+			t.Errorf("policy %d: expected Close to abort the download, it took %v", policy, took)
+		}
+		if binary() != string(oldBinary) {
+			t.Errorf("policy %d: expected the binary to stay, got %q", policy, binary())
+		}
+	}
+	hang.Store(false)
+
+	// --- Metered connections and quiet hours skip the check ---
+	now := time.Now()
+	for name, options := range map[string]AutoCheckOptions{
+		"metered":     {IsMetered: func() bool { return true }},
+		"quiet hours": {QuietHours: &QuietHours{Start: now.Hour(), End: (now.Hour() + 2) % 24}},
+	} {
+		fw = newFramework()
+		before := checks.Load()
+		options.Interval = 5 * time.Millisecond
+		options.CheckOnStart = true
+		options.OnAvailable = func(*NetUpReleaseInfo) { t.Errorf("%s: expected no check", name) }
+		fw.Update.StartAutoCheck(options)
+		time.Sleep(50 * time.Millisecond)
+		fw.Close()
+		if checks.Load() != before {
+			t.Errorf("%s: expected deploy.json not to be fetched", name)
+		}
+	}
+}
+
+func TestQuietHours(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2024, 1, 1, hour, 30, 0, 0, time.Local) }
+	cases := []struct {
+		quiet QuietHours
+		hour  int
+		want  bool
+	}{
+		{QuietHours{Start: 1, End: 5}, 1, true},
+		{QuietHours{Start: 1, End: 5}, 4, true},
+		{QuietHours{Start: 1, End: 5}, 5, false},
+		{QuietHours{Start: 22, End: 7}, 23, true},
+		{QuietHours{Start: 22, End: 7}, 3, true},
+		{QuietHours{Start: 22, End: 7}, 12, false},
+		{QuietHours{Start: 8, End: 8}, 8, false},
+	}
+	for _, c := range cases {
+		if got := c.quiet.Contains(at(c.hour)); got != c.want {
+			t.Errorf("%+v at %d: expected %v, got %v", c.quiet, c.hour, c.want, got)
+		}
+	}
+}
+
+func TestUpdateStaged(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	oldBinary, newBinary := []byte("old build"), []byte("new build")
+
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		w.Write(newBinary)
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	release := signedTestRelease(t, key, 2, newBinary, server.URL)
+
+	build := func(uind int) *Framework {
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           uind,
+				Channel:        "test",
+				Target:         "test-target",
+				PublicKeyPEM:   pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+				ExecutablePath: Ptr(exe),
+			},
+		})
+	}
+	reset := func() {
+		if err := os.WriteFile(exe, oldBinary, 0755); err != nil {
+			t.Fatal(err)
+		}
+		os.RemoveAll(filepath.Join(dir, ".app.update"))
+	}
+	binary := func() string {
+		content, _ := os.ReadFile(exe)
+		return string(content)
+	}
+
+	// --- Downloaded now, applied after a restart ---
+	reset()
+	staged, err := build(1).Update.DownloadUpdate(release)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if content, _ := os.ReadFile(staged.Path); string(content) != string(newBinary) || staged.IsPatch {
+		t.Errorf("expected the full binary to be staged, got %q", content)
+	}
+	if binary() != string(oldBinary) {
+		t.Errorf("expected the binary to stay until applied, got %q", binary())
+	}
+
+	fw := build(1)
+	restored, err := fw.Update.GetStagedUpdate()
+	if err != nil || restored == nil || restored.Release.UIND != 2 || restored.Path != staged.Path {
+		t.Fatalf("expected the staged update to survive a restart, got %+v (%v)", restored, err)
+	}
+	before := downloads.Load()
+	if err := fw.Update.ApplyStaged(restored); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if downloads.Load() != before {
+		t.Errorf("expected applying to use the staged file, not download again")
+	}
+	if binary() != string(newBinary) {
+		t.Errorf("expected the staged update to be applied, got %q", binary())
+	}
+	if s, _ := fw.Update.GetStagedUpdate(); s != nil {
+		t.Errorf("expected the staged update to be removed once applied, got %+v", s)
+	}
+	if pending, _ := build(2).Update.GetPendingUpdate(); pending == nil || pending.ToUIND != 2 {
+		t.Errorf("expected an applied staged update to be pending confirmation, got %+v", pending)
+	}
+
+	// --- The staged file is modified ---
+	reset()
+	staged, err = build(1).Update.DownloadUpdate(release)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	os.WriteFile(staged.Path, []byte("evil build"), 0644)
+	if err := build(1).Update.ApplyStaged(staged); !errors.Is(err, ErrUpdateVerification) {
+		t.Errorf("expected ErrUpdateVerification for a modified staged file, got %v", err)
+	}
+	if binary() != string(oldBinary) {
+		t.Errorf("expected a modified staged file not to be applied, got %q", binary())
+	}
+
+	// --- The running build moved past the staged release ---
+	reset()
+	staged, _ = build(1).Update.DownloadUpdate(release)
+	if err := build(2).Update.ApplyStaged(staged); !errors.Is(err, ErrStagedUpdateStale) {
+		t.Errorf("expected ErrStagedUpdateStale, got %v", err)
+	}
+	if s, _ := build(2).Update.GetStagedUpdate(); s != nil {
+		t.Errorf("expected a stale staged update to be discarded")
+	}
+
+	// --- A download with a bad signature is never staged ---
+	reset()
+	forged := signedTestRelease(t, otherKey, 2, newBinary, server.URL)
+	if _, err := build(1).Update.DownloadUpdate(forged); !errors.Is(err, ErrUpdateVerification) {
+		t.Errorf("expected ErrUpdateVerification for a forged signature, got %v", err)
+	}
+	if s, _ := build(1).Update.GetStagedUpdate(); s != nil {
+		t.Errorf("expected nothing to be staged, got %+v", s)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, ".app.update")); len(entries) != 0 {
+		t.Errorf("expected no leftover files, got %v", entries)
+	}
+}
+
+// Records the update progress and network events an updater reports to the debugger
+type updateRecordingDebugger struct {
+	DebuggerInterface
+	mu       sync.Mutex
+	progress []UpdateProgress
+	created  []NetworkEvent
+	stopped  []NetworkEvent
+}
+
+func (d *updateRecordingDebugger) IsActive() bool { return true }
+
+func (d *updateRecordingDebugger) UpdateProgress(progress UpdateProgress) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.progress = append(d.progress, progress)
+	return nil
+}
+
+func (d *updateRecordingDebugger) NetCreate(ev NetworkEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.created = append(d.created, ev)
+	return nil
+}
+
+func (d *updateRecordingDebugger) NetStopWFUpdate(ev NetworkEvent) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopped = append(d.stopped, ev)
+	return nil
+}
+
+func TestUpdateProgress(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+	FrameworkFlags.Disable(Net_InternalErrorLog)
+	defer FrameworkFlags.Enable(Net_InternalErrorLog)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	newBinary := []byte("new build")
+
+	var deploy []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/deploy.json" {
+			w.Write(deploy)
+			return
+		}
+		w.Write(newBinary)
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	release := signedTestRelease(t, key, 2, newBinary, server.URL+"/app")
+	deploy, _ = json.Marshal(map[string]any{"format": 1, "channels": map[string][]*NetUpReleaseInfo{"test": {release}}})
+
+	var progressed []UpdateProgress
+	config := &FrameworkConfig{
+		NetFetchOptions: (&NetFetchOptions{}).Default(),
+		UpdatorAppConfiguration: &UpdatorAppConfiguration{
+			UIND:           1,
+			Channel:        "test",
+			Target:         "test-target",
+			DeployURL:      Ptr(server.URL + "/deploy.json"),
+			PublicKeyPEM:   pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+			ExecutablePath: Ptr(exe),
+			Progressor:     func(p UpdateProgress) { progressed = append(progressed, p) },
+		},
+	}
+	fw := NewFramework(config)
+	deb := &updateRecordingDebugger{DebuggerInterface: fw.Debugger}
+	updater := fwupdate.NewNetUpdater(config, fwnet.NewNetHandler(config, deb, fw.Log, nil), fw.Log, deb)
+
+	// Phases in order without repeats
+	phases := func() []UpdatePhase {
+		var out []UpdatePhase
+		for _, p := range progressed {
+			if len(out) == 0 || out[len(out)-1] != p.Phase {
+				out = append(out, p.Phase)
+			}
+		}
+		return out
+	}
+
+	// --- Check ---
+	if _, err := updater.GetLatestVersion(); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if got := phases(); !slices.Equal(got, []UpdatePhase{UpdatePhaseChecking, UpdatePhaseDone}) {
+		t.Errorf("unexpected check phases %v", got)
+	}
+	if last := progressed[len(progressed)-1]; last.Operation != "check" || last.UIND != 2 {
+		t.Errorf("expected the check to end with the found release, got %+v", last)
+	}
+
+	// --- Update ---
+	os.WriteFile(exe, []byte("old build"), 0755)
+	progressed = nil
+	if err := updater.PerformUpdate(release); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if got := phases(); !slices.Equal(got, []UpdatePhase{UpdatePhaseDownloading, UpdatePhaseVerifying, UpdatePhaseApplying, UpdatePhaseDone}) {
+		t.Errorf("unexpected update phases %v", got)
+	}
+	id := progressed[0].ID
+	var downloaded int64
+	for _, p := range progressed {
+		if p.ID != id {
+			t.Errorf("expected every phase under %s, got %s", id, p.ID)
+		}
+		if p.Phase == UpdatePhaseDownloading {
+			downloaded = p.Transferred
+		}
+	}
+	if downloaded != int64(len(newBinary)) {
+		t.Errorf("expected the download progress to reach %d bytes, got %d", len(newBinary), downloaded)
+	}
+
+	// The update is a parent event with the download under it, the debugger got the same progress
+	deb.mu.Lock()
+	children := 0
+	for _, ev := range deb.created {
+		if ev.Parent != nil && *ev.Parent == id {
+			children++
+		}
+	}
+	var stopped *NetworkEvent
+	for i := range deb.stopped {
+		if deb.stopped[i].ID == id {
+			stopped = &deb.stopped[i]
+		}
+	}
+	signals := len(deb.progress)
+	deb.mu.Unlock()
+	if children == 0 {
+		t.Errorf("expected the download to be a child of %s", id)
+	}
+	if stopped == nil || stopped.EventState != NetStateFinished || !stopped.EventSuccess {
+		t.Errorf("expected the update event to finish successfully, got %+v", stopped)
+	}
+	if signals == 0 {
+		t.Errorf("expected update:progress signals")
+	}
+
+	// --- A failing update ends failed ---
+	progressed = nil
+	forged := signedTestRelease(t, otherKey, 3, newBinary, server.URL+"/app")
+	if err := updater.PerformUpdate(forged); !errors.Is(err, ErrUpdateVerification) {
+		t.Fatalf("expected ErrUpdateVerification, got %v", err)
+	}
+	last := progressed[len(progressed)-1]
+	if last.Phase != UpdatePhaseFailed || last.Error == "" {
+		t.Errorf("expected the update to end failed with the error, got %+v", last)
+	}
+}
+
+// A GithubUpdateFetcherInterface that reads its releases from a test server through the given fetch
+type testGithubFetcher struct {
+	url     string
+	release *NetUpReleaseInfo
+}
+
+func (f *testGithubFetcher) FetchUpMetaReleases(fetch GithubReleasesFetchFn) ([]UpdateReleaseData, error) {
+	if _, err := fetch(f.url); err != nil {
+		return nil, err
+	}
+	return []UpdateReleaseData{{Tag: "v" + f.release.Semver, UpMeta: &UpdateUpMeta{Uind: f.release.UIND, Semver: f.release.Semver, Channel: "ugit.test", Sources: f.release.Sources}}}, nil
+}
+
+func (f *testGithubFetcher) FetchAssetReleases(fetch GithubReleasesFetchFn) ([]UpdateReleaseData, error) {
+	return nil, nil
+}
+
+func TestUpdateGitHubCheckUnderOperation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	config := &FrameworkConfig{
+		NetFetchOptions: (&NetFetchOptions{}).Default(),
+		UpdatorAppConfiguration: &UpdatorAppConfiguration{
+			UIND:           1,
+			SemVer:         "1.0.1",
+			Channel:        "ugit.test",
+			Target:         "test-target",
+			ExecutablePath: Ptr(filepath.Join(t.TempDir(), "app")),
+			GhMetaFetcher:  &testGithubFetcher{url: server.URL + "/releases", release: signedTestRelease(t, key, 2, []byte("new build"), server.URL+"/app")},
+		},
+	}
+	fw := NewFramework(config)
+	deb := &updateRecordingDebugger{DebuggerInterface: fw.Debugger}
+	updater := fwupdate.NewNetUpdater(config, fwnet.NewNetHandler(config, deb, fw.Log, nil), fw.Log, deb)
+
+	release, err := updater.GetLatestVersion()
+	if err != nil || release.UIND != 2 {
+		t.Fatalf("expected the GitHub release, got %+v (%v)", release, err)
+	}
+
+	// The GitHub fetch hangs under the check's operation event
+	deb.mu.Lock()
+	defer deb.mu.Unlock()
+	var op, releases *NetworkEvent
+	for i := range deb.created {
+		if strings.HasPrefix(deb.created[i].ID, "Fw.Update") {
+			op = &deb.created[i]
+		} else if deb.created[i].Remote == server.URL+"/releases" {
+			releases = &deb.created[i]
+		}
+	}
+	if op == nil || releases == nil || releases.Parent == nil || *releases.Parent != op.ID {
+		t.Errorf("expected the releases fetch under the check event, got %+v under %+v", releases, op)
+	}
+}
+
+func TestUpdateVersionConstraints(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	release := func(uind int, semver string) NetUpReleaseInfo {
+		return NetUpReleaseInfo{UIND: uind, Semver: semver, Sources: map[string]UpdateSourceInfo{"test-target": {URL: "https://example.invalid/app"}}}
+	}
+	withMin := func(r NetUpReleaseInfo, min string) NetUpReleaseInfo { r.MinVersion = &min; return r }
+	withMax := func(r NetUpReleaseInfo, max string) NetUpReleaseInfo { r.MaxVersion = &max; return r }
+	stone := func(r NetUpReleaseInfo) NetUpReleaseInfo { r.RequiresSteppingStone = true; return r }
+
+	deploy, _ := json.Marshal(NetUpDeployFile{Format: 1, Channels: map[string][]NetUpReleaseInfo{
+		"min":        {release(1, "1.0.0"), release(2, "1.1.0"), withMin(release(3, "2.0.0"), "1.1.0")},
+		"stone":      {release(1, "1.0.0"), stone(release(2, "1.1.0")), release(3, "1.2.0"), release(4, "1.3.0")},
+		"max":        {withMax(release(3, "1.3.0"), "1.1.0")},
+		"older":      {release(1, "1.0.0")},
+		"semver":     {release(5, "0.9.0")},
+		"prerelease": {release(3, "1.2.0-beta.1")},
+	}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(deploy)
+	}))
+	defer server.Close()
+
+	cases := []struct {
+		channel   string
+		uind      int
+		semver    string
+		downgrade bool
+		want      int
+		err       error
+	}{
+		{"min", 1, "1.0.0", false, 2, nil}, // Hops through 1.1.0
+		{"min", 2, "1.1.0", false, 3, nil},
+		{"stone", 1, "1.0.0", false, 2, nil},
+		{"stone", 2, "1.1.0", false, 4, nil},
+		{"max", 2, "1.2.0", false, 0, ErrUpdateConstraints},
+		{"max", 1, "1.0.0", false, 3, nil},
+		{"older", 2, "1.1.0", false, 0, ErrUpdateDowngrade},
+		{"older", 2, "1.1.0", true, 1, nil},
+		{"semver", 2, "1.1.0", false, 0, ErrUpdateDowngrade}, // A higher UIND with a lower SemVer
+		{"prerelease", 2, "1.2.0", false, 0, ErrUpdateDowngrade},
+		{"prerelease", 2, "1.1.0", false, 3, nil},
+	}
+	for _, c := range cases {
+		fw := NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           c.uind,
+				SemVer:         c.semver,
+				Channel:        c.channel,
+				Target:         "test-target",
+				DeployURL:      Ptr(server.URL),
+				AllowDowngrade: c.downgrade,
+			},
+		})
+		got, err := fw.Update.GetLatestVersion()
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s from %s: expected %v, got %+v (%v)", c.channel, c.semver, c.err, got, err)
+			}
+			continue
+		}
+		if err != nil || got.UIND != c.want {
+			t.Errorf("%s from %s: expected UIND %d, got %+v (%v)", c.channel, c.semver, c.want, got, err)
+		}
+	}
+}
+
+func TestUpdateChannels(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	dir := t.TempDir()
+	release := func(uind int, semver string, target string) NetUpReleaseInfo {
+		return NetUpReleaseInfo{UIND: uind, Semver: semver, Notes: fmt.Sprintf("notes %d", uind), Sources: map[string]UpdateSourceInfo{target: {URL: "https://example.invalid/app"}}}
+	}
+	deploy, _ := json.Marshal(NetUpDeployFile{Format: 1, Channels: map[string][]NetUpReleaseInfo{
+		"stable": {release(10, "1.0.0", "test-target"), release(12, "1.1.0", "test-target")},
+		"beta":   {release(3, "1.2.0-beta.1", "test-target"), release(4, "1.2.0-beta.2", "other-target")},
+		"empty":  {},
+	}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(deploy)
+	}))
+	defer server.Close()
+
+	newFramework := func(semver string) *Framework {
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           12,
+				SemVer:         semver,
+				Channel:        "stable",
+				Target:         "test-target",
+				DeployURL:      Ptr(server.URL),
+				ExecutablePath: Ptr(filepath.Join(dir, "app")),
+			},
+		})
+	}
+	fw := newFramework("1.1.0")
+
+	channels, err := fw.Update.ListChannels()
+	if err != nil || !slices.Equal(channels, []string{"beta", "stable"}) {
+		t.Fatalf("expected channels [beta stable], got %v (%v)", channels, err)
+	}
+	releases, err := fw.Update.ListReleases("beta")
+	if err != nil || len(releases) != 2 || releases[0].UIND != 4 || releases[1].UIND != 3 {
+		t.Fatalf("expected beta releases 4 and 3, got %+v (%v)", releases, err)
+	}
+	if releases[0].Channel != "beta" || releases[0].Notes != "notes 4" {
+		t.Errorf("expected the release's channel and notes, got %+v", releases[0])
+	}
+	if _, err := fw.Update.ListReleases("nightly"); !errors.Is(err, ErrUnknownChannel) {
+		t.Errorf("expected ErrUnknownChannel, got %v", err)
+	}
+	if err := fw.Update.SwitchChannel("empty"); !errors.Is(err, ErrUnknownChannel) {
+		t.Errorf("expected ErrUnknownChannel switching to an empty channel, got %v", err)
+	}
+
+	latest, err := fw.Update.GetLatestVersion()
+	if err != nil || latest.UIND != 12 || fw.Update.IsNewer(latest) {
+		t.Fatalf("expected the running build on stable, got %+v (%v)", latest, err)
+	}
+
+	// Beta has its own lower UINDs, only the SemVer tells it is newer
+	if err := fw.Update.SwitchChannel("beta"); err != nil {
+		t.Fatal(err)
+	}
+	latest, err = fw.Update.GetLatestVersion()
+	if err != nil || latest.UIND != 3 || !fw.Update.IsNewer(latest) {
+		t.Fatalf("expected beta UIND 3 to be newer, got %+v (%v)", latest, err)
+	}
+
+	// The choice is kept across restarts, and a build newer than the channel stays
+	restarted := newFramework("1.3.0")
+	if channel := restarted.Update.GetUpdateConfig().Channel; channel != "beta" {
+		t.Fatalf("expected the beta channel after a restart, got %q", channel)
+	}
+	if _, err := restarted.Update.GetLatestVersion(); !errors.Is(err, ErrUpdateDowngrade) {
+		t.Errorf("expected ErrUpdateDowngrade from a newer build, got %v", err)
+	}
+
+	if err := fw.Update.SwitchChannel("stable"); err != nil {
+		t.Fatal(err)
+	}
+	if channel := newFramework("1.1.0").Update.GetUpdateConfig().Channel; channel != "stable" {
+		t.Errorf("expected switching back to drop the choice, got %q", channel)
+	}
+}
+
+func TestUpdateRollout(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	release := func(uind int, rollout float64, cohorts ...RolloutCohort) NetUpReleaseInfo {
+		return NetUpReleaseInfo{UIND: uind, Semver: fmt.Sprintf("1.%d.0", uind), Rollout: &rollout, Cohorts: cohorts, Sources: map[string]UpdateSourceInfo{"test-target": {URL: "https://example.invalid/app"}}}
+	}
+	deploy, _ := json.Marshal(NetUpDeployFile{Format: 1, Channels: map[string][]NetUpReleaseInfo{
+		"half":     {release(1, 100), release(2, 50)},
+		"none":     {release(2, 0)},
+		"platform": {release(2, 100, RolloutCohort{Platforms: []string{"other-target"}})},
+		"cohort":   {release(2, 0, RolloutCohort{MinVersion: Ptr("1.0.0"), Rollout: Ptr(100.0)})},
+	}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(deploy)
+	}))
+	defer server.Close()
+
+	newFramework := func(channel string, configDir string) *Framework {
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:      1,
+				SemVer:    "1.1.0",
+				Channel:   channel,
+				Target:    "test-target",
+				DeployURL: Ptr(server.URL),
+				ConfigDir: Ptr(configDir),
+			},
+		})
+	}
+
+	// Every install gets a consistent answer, about half of them get the release
+	rolledOut := 0
+	for range 100 {
+		dir := t.TempDir()
+		first, err := newFramework("half", dir).Update.GetLatestVersion()
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := newFramework("half", dir).Update.GetLatestVersion()
+		if err != nil || again.UIND != first.UIND {
+			t.Fatalf("expected the same answer for the same install, got %d then %+v (%v)", first.UIND, again, err)
+		}
+		if first.UIND == 2 {
+			rolledOut++
+		}
+	}
+	if rolledOut < 25 || rolledOut > 75 {
+		t.Errorf("expected about half of the installs in a 50%% rollout, got %d of 100", rolledOut)
+	}
+
+	dir := t.TempDir()
+	fw := newFramework("none", dir)
+	if _, err := fw.Update.GetLatestVersion(); !errors.Is(err, ErrUpdateRollout) {
+		t.Errorf("expected ErrUpdateRollout for a 0%% rollout, got %v", err)
+	}
+	id, err := fw.Update.InstallationID()
+	if content, _ := os.ReadFile(filepath.Join(dir, "installation-id")); err != nil || id == "" || string(content) != id {
+		t.Errorf("expected the installation ID %q to be kept in the config dir, got %q (%v)", id, content, err)
+	}
+	if _, err := newFramework("platform", t.TempDir()).Update.GetLatestVersion(); !errors.Is(err, ErrUpdateRollout) {
+		t.Errorf("expected ErrUpdateRollout outside the cohort's platforms, got %v", err)
+	}
+	if got, err := newFramework("cohort", t.TempDir()).Update.GetLatestVersion(); err != nil || got.UIND != 2 {
+		t.Errorf("expected the cohort's rollout to include the install, got %+v (%v)", got, err)
+	}
+}
+
+func TestUpdateSignedManifest(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	dir := t.TempDir()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pubDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	sign := func(content []byte) []byte {
+		sum := sha256.Sum256(content)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	manifest := func(version uint64, expires time.Duration) []byte {
+		content, _ := json.Marshal(NetUpDeployFile{Format: 1, Version: version, Expires: Ptr(time.Now().Add(expires)), Channels: map[string][]NetUpReleaseInfo{
+			"test": {{UIND: 1, Semver: "1.0.0", Sources: map[string]UpdateSourceInfo{"test-target": {URL: "https://example.invalid/app"}}}},
+		}})
+		return content
+	}
+	embedded := func(signed []byte, signature []byte) []byte {
+		content, _ := json.Marshal(map[string]any{"signed": json.RawMessage(signed), "signature": base64.StdEncoding.EncodeToString(signature)})
+		return content
+	}
+
+	var deploy, detached []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/deploy.json":
+			w.Write(deploy)
+		case r.URL.Path == "/deploy.json.sig" && detached != nil:
+			w.Write(detached)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	newFramework := func(require bool) *Framework {
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:                  1,
+				SemVer:                "1.0.0",
+				Channel:               "test",
+				Target:                "test-target",
+				DeployURL:             Ptr(server.URL + "/deploy.json"),
+				PublicKeyPEM:          pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}),
+				ExecutablePath:        Ptr(filepath.Join(dir, "app")),
+				RequireSignedManifest: require,
+			},
+		})
+	}
+	fw := newFramework(false)
+	check := func(name string, want error) {
+		t.Helper()
+		if _, err := fw.Update.GetLatestVersion(); !errors.Is(err, want) && !(want == nil && err == nil) {
+			t.Errorf("%s: expected %v, got %v", name, want, err)
+		}
+	}
+
+	unsigned := manifest(1, time.Hour)
+	deploy = unsigned
+	check("unsigned before any signed manifest", nil)
+
+	signed := manifest(2, time.Hour)
+	deploy = embedded(signed, sign(signed))
+	check("embedded signature", nil)
+	if _, err := os.Stat(filepath.Join(dir, ".app.update", "manifest.json")); err != nil {
+		t.Errorf("expected the manifest version to be recorded: %v", err)
+	}
+
+	deploy = embedded(manifest(3, time.Hour), sign(signed))
+	check("tampered manifest", ErrManifestSignature)
+
+	older := manifest(1, time.Hour)
+	deploy = embedded(older, sign(older))
+	check("older version", ErrManifestRollback)
+
+	expired := manifest(3, -time.Hour)
+	deploy = embedded(expired, sign(expired))
+	check("expired", ErrManifestExpired)
+
+	deploy = unsigned
+	check("unsigned after a signed manifest", ErrManifestSignature)
+
+	deploy = manifest(3, time.Hour)
+	detached = sign(deploy)
+	check("detached signature", nil)
+
+	os.RemoveAll(filepath.Join(dir, ".app.update"))
+	fw = newFramework(true)
+	deploy, detached = unsigned, nil
+	check("unsigned with RequireSignedManifest", ErrManifestSignature)
+}
+
+func TestUpdateKeyRotation(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	oldBinary, newBinary := []byte("old build"), []byte("new build")
+
+	newKey := func() (*ecdsa.PrivateKey, string) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		return key, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	sign := func(key *ecdsa.PrivateKey, content []byte) []byte {
+		sum := sha256.Sum256(content)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sig
+	}
+	keyA, pemA := newKey()
+	keyB, pemB := newKey()
+	keyC, pemC := newKey()
+	idA, err := UpdateKeyID([]byte(pemA))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deploy []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deploy.json":
+			w.Write(deploy)
+		case "/app":
+			w.Write(newBinary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// A release of newBinary signed by key, and a manifest around it signed by signer
+	publish := func(key *ecdsa.PrivateKey, keyID string, signer *ecdsa.PrivateKey, signerID string, version uint64, rotations []KeyRotation, revocations []KeyRevocation) {
+		sum := sha256.Sum256(newBinary)
+		release := NetUpReleaseInfo{UIND: 2, Semver: "1.0.2", Sources: map[string]UpdateSourceInfo{
+			"test-target": {URL: server.URL + "/app", Checksum: hex.EncodeToString(sum[:]), Signature: Ptr(base64.StdEncoding.EncodeToString(sign(key, newBinary))), KeyID: Ptr(keyID)},
+		}}
+		signed, _ := json.Marshal(NetUpDeployFile{Format: 1, Version: version, Expires: Ptr(time.Now().Add(time.Hour)), Keys: rotations, RevokedKeys: revocations, Channels: map[string][]NetUpReleaseInfo{"test": {release}}})
+		deploy, _ = json.Marshal(map[string]any{"signed": json.RawMessage(signed), "signature": base64.StdEncoding.EncodeToString(sign(signer, signed)), "key_id": signerID})
+	}
+	rotation := func(signer *ecdsa.PrivateKey, signerID string, id string, publicKey string) KeyRotation {
+		return KeyRotation{ID: id, PublicKey: publicKey, SignedBy: signerID, Signature: base64.StdEncoding.EncodeToString(sign(signer, KeyRotationMessage(id, publicKey)))}
+	}
+	newFramework := func(revoked ...string) *Framework {
+		if err := os.WriteFile(exe, oldBinary, 0755); err != nil {
+			t.Fatal(err)
+		}
+		return NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           1,
+				SemVer:         "1.0.1",
+				Channel:        "test",
+				Target:         "test-target",
+				DeployURL:      Ptr(server.URL + "/deploy.json"),
+				PublicKeyPEM:   []byte(pemA),
+				ExecutablePath: Ptr(exe),
+				RevokedKeys:    revoked,
+			},
+		})
+	}
+
+	// Key A vouches for key B, which signs both the manifest and the binary
+	publish(keyB, "b", keyB, "b", 1, []KeyRotation{rotation(keyA, idA, "b", pemB)}, nil)
+	fw := newFramework()
+	release, err := fw.Update.GetLatestVersion()
+	if err != nil {
+		t.Fatalf("expected the rotated in key to be trusted: %v", err)
+	}
+	if err := fw.Update.PerformUpdate(release); err != nil {
+		t.Fatalf("expected a binary signed by the rotated in key to apply: %v", err)
+	}
+	if content, _ := os.ReadFile(exe); string(content) != string(newBinary) {
+		t.Errorf("expected the new binary, got %q", content)
+	}
+
+	// The rotation is remembered once the manifest drops it
+	publish(keyB, "b", keyB, "b", 2, nil, nil)
+	if _, err := newFramework().Update.GetLatestVersion(); err != nil {
+		t.Errorf("expected key B to stay trusted: %v", err)
+	}
+
+	// A key can not vouch for itself
+	publish(keyC, "c", keyC, "c", 3, []KeyRotation{rotation(keyC, "c", "c", pemC)}, nil)
+	if _, err := newFramework().Update.GetLatestVersion(); !errors.Is(err, ErrManifestSignature) || !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("expected an untrusted key to be refused, got %v", err)
+	}
+
+	// A rotated in key can not revoke another key, named as the signer or not
+	revocations := []KeyRevocation{
+		{ID: "b", SignedBy: "c", Signature: base64.StdEncoding.EncodeToString(sign(keyC, KeyRevocationMessage("b")))},
+		{ID: "b", Signature: base64.StdEncoding.EncodeToString(sign(keyC, KeyRevocationMessage("b")))},
+	}
+	publish(keyB, "b", keyB, "b", 3, []KeyRotation{rotation(keyA, idA, "c", pemC)}, revocations)
+	if _, err := newFramework().Update.GetLatestVersion(); err != nil {
+		t.Fatal(err)
+	}
+	publish(keyB, "b", keyB, "b", 4, nil, nil)
+	if _, err := newFramework().Update.GetLatestVersion(); err != nil {
+		t.Errorf("expected key B to stay trusted after a revocation by a rotated in key: %v", err)
+	}
+
+	// Key A revokes key B, its signatures are refused from then on
+	revocation := KeyRevocation{ID: "b", SignedBy: idA, Signature: base64.StdEncoding.EncodeToString(sign(keyA, KeyRevocationMessage("b")))}
+	publish(keyB, "b", keyA, idA, 5, nil, []KeyRevocation{revocation})
+	fw = newFramework()
+	if release, err = fw.Update.GetLatestVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Update.PerformUpdate(release); !errors.Is(err, ErrUpdateVerification) {
+		t.Errorf("expected a binary signed by a revoked key to fail verification, got %v", err)
+	}
+	publish(keyB, "b", keyB, "b", 6, nil, nil)
+	if _, err := newFramework().Update.GetLatestVersion(); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("expected a manifest signed by a revoked key to be refused, got %v", err)
+	}
+
+	// Keys revoked in the build are never trusted
+	os.RemoveAll(filepath.Join(dir, ".app.update"))
+	publish(keyA, idA, keyA, idA, 7, nil, nil)
+	if _, err := newFramework(idA).Update.GetLatestVersion(); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("expected a key revoked in the build to be refused, got %v", err)
+	}
+}
+
+func TestUpdateSignatureAlgorithms(t *testing.T) {
+	FrameworkFlags.Disable(Update_InternalErrorLog)
+	defer FrameworkFlags.Enable(Update_InternalErrorLog)
+
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "app")
+	oldBinary, newBinary := []byte("old build"), []byte("new build")
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	publicPEM := func(key any) []byte {
+		der, _ := x509.MarshalPKIXPublicKey(key)
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	// ECDSA and RSA sign the sha256 of the content, Ed25519 the content itself
+	type signer struct {
+		name      string
+		publicKey []byte
+		sign      func(content []byte) ([]byte, error)
+	}
+	signers := []signer{
+		{"ecdsa", publicPEM(&ecKey.PublicKey), func(content []byte) ([]byte, error) {
+			sum := sha256.Sum256(content)
+			return ecdsa.SignASN1(rand.Reader, ecKey, sum[:])
+		}},
+		{"ed25519", publicPEM(edPub), func(content []byte) ([]byte, error) { return ed25519.Sign(edKey, content), nil }},
+		{"rsa", publicPEM(&rsaKey.PublicKey), func(content []byte) ([]byte, error) {
+			sum := sha256.Sum256(content)
+			return rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+		}},
+		{"rsa-pss", publicPEM(&rsaKey.PublicKey), func(content []byte) ([]byte, error) {
+			sum := sha256.Sum256(content)
+			return rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, sum[:], nil)
+		}},
+	}
+	sign := func(s signer, content []byte) string {
+		sig, err := s.sign(content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+
+	var deploy []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/deploy.json":
+			w.Write(deploy)
+		case "/app":
+			w.Write(newBinary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	// A signed manifest with a release of newBinary, both signed by s
+	publish := func(s signer) {
+		sum := sha256.Sum256(newBinary)
+		release := NetUpReleaseInfo{UIND: 2, Semver: "1.0.2", Sources: map[string]UpdateSourceInfo{
+			"test-target": {URL: server.URL + "/app", Checksum: hex.EncodeToString(sum[:]), Signature: Ptr(sign(s, newBinary))},
+		}}
+		signed, _ := json.Marshal(NetUpDeployFile{Format: 1, Version: 1, Expires: Ptr(time.Now().Add(time.Hour)), Channels: map[string][]NetUpReleaseInfo{"test": {release}}})
+		deploy, _ = json.Marshal(map[string]any{"signed": json.RawMessage(signed), "signature": sign(s, signed)})
+	}
+	update := func(s signer, algorithm SigAlgorithm) error {
+		os.RemoveAll(filepath.Join(dir, ".app.update"))
+		if err := os.WriteFile(exe, oldBinary, 0755); err != nil {
+			t.Fatal(err)
+		}
+		publish(s)
+		fw := NewFramework(&FrameworkConfig{
+			NetFetchOptions: (&NetFetchOptions{}).Default(),
+			UpdatorAppConfiguration: &UpdatorAppConfiguration{
+				UIND:           1,
+				SemVer:         "1.0.1",
+				Channel:        "test",
+				Target:         "test-target",
+				DeployURL:      Ptr(server.URL + "/deploy.json"),
+				PublicKeyPEM:   s.publicKey,
+				SigAlgorithm:   algorithm,
+				ExecutablePath: Ptr(exe),
+			},
+		})
+		release, err := fw.Update.GetLatestVersion()
+		if err != nil {
+			return err
+		}
+		return fw.Update.PerformUpdate(release)
+	}
+
+	// The algorithm goes by the key type, or is set explicitly
+	for _, s := range signers {
+		for _, algorithm := range []SigAlgorithm{"", SigAlgorithm(s.name)} {
+			if err := update(s, algorithm); err != nil {
+				t.Errorf("%s (configured %q): expected the update to apply: %v", s.name, algorithm, err)
+			} else if content, _ := os.ReadFile(exe); string(content) != string(newBinary) {
+				t.Errorf("%s (configured %q): expected the new binary, got %q", s.name, algorithm, content)
+			}
+		}
+	}
+
+	// An explicit algorithm only accepts its own signatures
+	if err := update(signers[3], RSA); !errors.Is(err, ErrManifestSignature) {
+		t.Errorf("expected a PSS signature to fail with RSA configured, got %v", err)
+	}
+	if err := update(signers[1], ECDSA); err == nil {
+		t.Error("expected an Ed25519 key configured as ECDSA to be refused")
+	}
+
+	// An Ed25519 signature over the digest instead of the content is refused
+	digestSigner := signer{"ed25519", signers[1].publicKey, func(content []byte) ([]byte, error) {
+		sum := sha256.Sum256(content)
+		return ed25519.Sign(edKey, sum[:]), nil
+	}}
+	if err := update(digestSigner, ""); !errors.Is(err, ErrManifestSignature) {
+		t.Errorf("expected an Ed25519 signature over the digest to fail, got %v", err)
+	}
+
+	// Chck verifies the same signatures
+	fw := NewFramework(&FrameworkConfig{NetFetchOptions: (&NetFetchOptions{}).Default()})
+	content := []byte("signed content")
+	for _, s := range signers {
+		sig, _ := s.sign(content)
+		if !fw.Chck.SigBuff(content, SigAlgorithm(s.name), s.publicKey, sig) || !fw.Chck.SigBuff(content, "", s.publicKey, sig) {
+			t.Errorf("%s: expected Chck to verify the signature", s.name)
+		}
+	}
+	pssSig, _ := signers[3].sign(content)
+	if fw.Chck.SigBuff(content, RSA, signers[3].publicKey, pssSig) {
+		t.Error("expected Chck to verify a PSS signature only as RSA_PSS")
+	}
+}
@@ -69,6 +69,13 @@ func SetupFramework() *libfw.Framework {
 			DeployURL:        Ptr(AppDeployURL),
 			GithubUpMetaRepo: _AppGithubRepo,
 			Target:           fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH),
+			Progressor: func(p libfw.UpdateProgress) {
+				if p.Phase == libfw.UpdatePhaseDownloading {
+					fmt.Printf("\rUpdate %s: downloading %d/%d bytes", p.Operation, p.Transferred, p.Size)
+				} else {
+					fmt.Printf("\nUpdate %s: %s %s\n", p.Operation, p.Phase, p.Error)
+				}
+			},
 		},
 
 		LogFrameworkInternalErrors: true,
@@ -84,6 +91,17 @@ func main() {
 
 	fw.Debugger.Activate()
 
+	// Roll back an update that never confirmed it started fine
+	if rb, err := fw.Update.CheckPendingUpdate(); err != nil {
+		fmt.Printf("Error checking pending update: %v\n", err)
+	} else if rb != nil {
+		fmt.Printf("Update to %s (UIND: %d) was rolled back: %s\n", rb.ToSemver, rb.ToUIND, rb.Reason)
+		if rb.RestartRequired {
+			fmt.Println("The previous version was restored, please restart the application.")
+			os.Exit(1)
+		}
+	}
+
 	upconf := fw.Update.GetUpdateConfig()
 
 	// Main code
@@ -102,7 +120,7 @@ func main() {
 	latestRelease, err := fw.Update.GetLatestVersion()
 	if err != nil {
 		fmt.Printf("Error checking for updates: %v\n", err)
-	} else if latestRelease != nil && latestRelease.UIND > upconf.UIND {
+	} else if latestRelease != nil && fw.Update.IsNewer(latestRelease) {
 		fmt.Printf("\n--- Update Available! ---\n")
 		fmt.Printf("New Version: %s (UIND: %d)\n", latestRelease.Semver, latestRelease.UIND)
 		fmt.Printf("Notes: %s\n", latestRelease.Notes)
@@ -111,9 +129,12 @@ func main() {
 		fmt.Println("You are running the latest version for your channel.")
 	}
 
+	// Started fine, keep this version
+	fw.Update.ConfirmUpdate()
+
 	reader := bufio.NewReader(os.Stdin)
 	for {
-		fmt.Print("Enter channel name, 'update', or 'exit': ")
+		fmt.Print("Enter channel name, 'channels', 'update', or 'exit': ")
 		input, err := reader.ReadString('\n')
 		if err != nil {
 			if err == io.EOF {
@@ -131,7 +152,7 @@ func main() {
 		}
 
 		if input == "update" {
-			if latestRelease == nil || latestRelease.UIND <= upconf.UIND {
+			if latestRelease == nil || !fw.Update.IsNewer(latestRelease) {
 				fmt.Println("No update available or you are already on the latest version.")
 				continue
 			}
@@ -146,15 +167,27 @@ func main() {
 				fmt.Println("Update successful! Please restart the application.")
 				break // Exit after successful update to encourage restart
 			}
+		} else if input == "channels" {
+			channels, err := fw.Update.ListChannels()
+			if err != nil {
+				fmt.Printf("Error listing channels: %v\n", err)
+				continue
+			}
+			for _, channel := range channels {
+				fmt.Printf("- %s\n", channel)
+			}
 		} else {
-			// Update the updater's channel property for the current session
-			upconf.Channel = input
+			// Switch the updater's channel, the choice is kept for the next starts
+			if err := fw.Update.SwitchChannel(input); err != nil {
+				fmt.Printf("Error switching to channel '%s': %v\n", input, err)
+				continue
+			}
 			fmt.Printf("Switching to channel: %s\n", upconf.Channel)
 			// Re-check for the latest release in the newly set channel
 			latestRelease, err = fw.Update.GetLatestVersion()
 			if err != nil {
 				fmt.Printf("Error checking for updates in channel '%s': %v\n", upconf.Channel, err)
-			} else if latestRelease != nil && latestRelease.UIND > upconf.UIND {
+			} else if latestRelease != nil && fw.Update.IsNewer(latestRelease) {
 				fmt.Printf("\n--- Update Available for Channel %s! ---\n", upconf.Channel)
 				fmt.Printf("New Version: %s (UIND: %d)\n", latestRelease.Semver, latestRelease.UIND)
 				fmt.Printf("Notes: %s\n", latestRelease.Notes)